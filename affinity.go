@@ -0,0 +1,129 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultTopologyKey spreads the pods across nodes.
+const defaultTopologyKey = "kubernetes.io/hostname"
+
+// antiAffinityWeight is the weight of the preferred anti-affinity term.
+const antiAffinityWeight = 100
+
+// podAffinity returns the affinity of the pods of the cluster: the affinity
+// of the scheduling spec when it sets one, or else an anti-affinity on the
+// pods of the cluster, preferred across nodes unless the spec tunes it.
+func podAffinity(cluster *RedisCluster) *corev1.Affinity {
+    if scheduling := cluster.Spec.Scheduling; scheduling != nil && scheduling.Affinity != nil {
+        return scheduling.Affinity
+    }
+    spec := cluster.Spec.AntiAffinity
+    if spec == nil {
+        spec = &RedisAntiAffinitySpec{}
+    }
+
+    topologyKey := spec.TopologyKey
+    if topologyKey == "" {
+        topologyKey = defaultTopologyKey
+    }
+    term := corev1.PodAffinityTerm{
+        LabelSelector: &metav1.LabelSelector{
+            MatchLabels: map[string]string{"app": cluster.ObjectMeta.Name},
+        },
+        TopologyKey: topologyKey,
+    }
+
+    antiAffinity := &corev1.PodAntiAffinity{}
+    if spec.Required {
+        antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = []corev1.PodAffinityTerm{term}
+    } else {
+        antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []corev1.WeightedPodAffinityTerm{{
+            Weight:          antiAffinityWeight,
+            PodAffinityTerm: term,
+        }}
+    }
+    return &corev1.Affinity{PodAntiAffinity: antiAffinity}
+}
+
+// topologySpreadConstraints returns the topology spread constraints of the
+// pods of the cluster. A constraint without a label selector spreads the
+// pods of the cluster.
+func topologySpreadConstraints(cluster *RedisCluster) []corev1.TopologySpreadConstraint {
+    if cluster.Spec.Scheduling == nil {
+        return nil
+    }
+    constraints := []corev1.TopologySpreadConstraint{}
+    for _, constraint := range cluster.Spec.Scheduling.TopologySpreadConstraints {
+        if constraint.LabelSelector == nil {
+            constraint.LabelSelector = &metav1.LabelSelector{
+                MatchLabels: map[string]string{"app": cluster.ObjectMeta.Name},
+            }
+        }
+        constraints = append(constraints, constraint)
+    }
+    return constraints
+}
+
+// setScheduling places the pods of a pod spec on the nodes the scheduling
+// spec selects and tolerates.
+func setScheduling(podSpec *corev1.PodSpec, spec RedisClusterSpec) {
+    if spec.Scheduling == nil {
+        return
+    }
+    podSpec.NodeSelector = spec.Scheduling.NodeSelector
+    podSpec.Tolerations = spec.Scheduling.Tolerations
+    podSpec.PriorityClassName = spec.Scheduling.PriorityClassName
+}
+
+// updateScheduling brings the scheduling fields of an existing pod template
+// in line with the desired one and reports whether it changed anything.
+func updateScheduling(existing *corev1.PodTemplateSpec, template corev1.PodTemplateSpec) bool {
+    changed := false
+    if !reflect.DeepEqual(existing.Spec.Affinity, template.Spec.Affinity) {
+        existing.Spec.Affinity = template.Spec.Affinity
+        changed = true
+    }
+    if len(existing.Spec.NodeSelector) != 0 || len(template.Spec.NodeSelector) != 0 {
+        if !reflect.DeepEqual(existing.Spec.NodeSelector, template.Spec.NodeSelector) {
+            existing.Spec.NodeSelector = template.Spec.NodeSelector
+            changed = true
+        }
+    }
+    if len(existing.Spec.Tolerations) != 0 || len(template.Spec.Tolerations) != 0 {
+        if !reflect.DeepEqual(existing.Spec.Tolerations, template.Spec.Tolerations) {
+            existing.Spec.Tolerations = template.Spec.Tolerations
+            changed = true
+        }
+    }
+    if len(existing.Spec.TopologySpreadConstraints) != 0 || len(template.Spec.TopologySpreadConstraints) != 0 {
+        if !reflect.DeepEqual(existing.Spec.TopologySpreadConstraints, template.Spec.TopologySpreadConstraints) {
+            existing.Spec.TopologySpreadConstraints = template.Spec.TopologySpreadConstraints
+            changed = true
+        }
+    }
+    if existing.Spec.PriorityClassName != template.Spec.PriorityClassName {
+        existing.Spec.PriorityClassName = template.Spec.PriorityClassName
+        changed = true
+    }
+    return changed
+}
+
+// validateScheduling checks that the spec does not place the pods in two
+// conflicting ways.
+func validateScheduling(spec RedisClusterSpec) error {
+    if spec.Scheduling == nil {
+        return nil
+    }
+    if spec.Scheduling.Affinity != nil && spec.AntiAffinity != nil {
+        return fmt.Errorf("scheduling affinity cannot be set along with antiAffinity")
+    }
+    for _, constraint := range spec.Scheduling.TopologySpreadConstraints {
+        if constraint.TopologyKey == "" || constraint.MaxSkew < 1 {
+            return fmt.Errorf("topology spread constraints need a topologyKey and a maxSkew of at least 1")
+        }
+    }
+    return nil
+}
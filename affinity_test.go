@@ -0,0 +1,61 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+)
+
+func TestPodAntiAffinity(t *testing.T) {
+    tests := []struct {
+        name        string
+        spec        *RedisAntiAffinitySpec
+        required    bool
+        topologyKey string
+    }{
+        {"default", nil, false, defaultTopologyKey},
+        {"preferred across zones", &RedisAntiAffinitySpec{TopologyKey: "topology.kubernetes.io/zone"}, false, "topology.kubernetes.io/zone"},
+        {"required across nodes", &RedisAntiAffinitySpec{Required: true}, true, defaultTopologyKey},
+    }
+    for _, test := range tests {
+        cluster := newTestCluster(3)
+        cluster.Spec.AntiAffinity = test.spec
+        affinity := podAffinity(cluster)
+        if affinity == nil || affinity.PodAntiAffinity == nil {
+            t.Fatalf("%s: got affinity %v, want a pod anti-affinity", test.name, affinity)
+        }
+        antiAffinity := affinity.PodAntiAffinity
+
+        var term corev1.PodAffinityTerm
+        if test.required {
+            if len(antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 1 || len(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution) != 0 {
+                t.Fatalf("%s: got %+v, want a single required term", test.name, antiAffinity)
+            }
+            term = antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0]
+        } else {
+            preferred := antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+            if len(preferred) != 1 || len(antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 0 {
+                t.Fatalf("%s: got %+v, want a single preferred term", test.name, antiAffinity)
+            }
+            if preferred[0].Weight != antiAffinityWeight {
+                t.Errorf("%s: got weight %d, want %d", test.name, preferred[0].Weight, antiAffinityWeight)
+            }
+            term = preferred[0].PodAffinityTerm
+        }
+        if term.TopologyKey != test.topologyKey {
+            t.Errorf("%s: got topology key %s, want %s", test.name, term.TopologyKey, test.topologyKey)
+        }
+        if !reflect.DeepEqual(term.LabelSelector.MatchLabels, map[string]string{"app": cluster.ObjectMeta.Name}) {
+            t.Errorf("%s: got selector %v, want the pods of the cluster", test.name, term.LabelSelector.MatchLabels)
+        }
+    }
+}
+
+func TestSchedulingAffinityOverridesAntiAffinity(t *testing.T) {
+    cluster := newTestCluster(3)
+    affinity := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}}
+    cluster.Spec.Scheduling = &RedisSchedulingSpec{Affinity: affinity}
+    if got := podAffinity(cluster); got != affinity {
+        t.Errorf("got affinity %v, want the one of the scheduling spec", got)
+    }
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "sync"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+// redisPasswordEnv is the environment variable of the redis container holding
+// the password.
+const redisPasswordEnv = "REDIS_PASSWORD"
+
+// authSecretKey is the key of the auth Secret holding the password.
+const authSecretKey = "password"
+
+// generatedPasswordBytes is the number of random bytes of a generated password.
+const generatedPasswordBytes = 32
+
+var (
+    // passwordsMu guards passwords.
+    passwordsMu sync.Mutex
+
+    // passwords are the Redis passwords of the clusters, read from their
+    // Secrets when the clusters are reconciled.
+    passwords = map[types.NamespacedName]string{}
+)
+
+// passwordSecretRef returns the Secret key holding the Redis password of the
+// spec, or nil if the spec does not protect the cluster.
+func passwordSecretRef(spec RedisClusterSpec) *corev1.SecretKeySelector {
+    if spec.PasswordSecretRef != nil {
+        return spec.PasswordSecretRef
+    }
+    if spec.Auth != nil && spec.Auth.SecretName != "" {
+        return &corev1.SecretKeySelector{
+            LocalObjectReference: corev1.LocalObjectReference{Name: spec.Auth.SecretName},
+            Key:                  authSecretKey,
+        }
+    }
+    return nil
+}
+
+// validateAuth checks that the spec sets the password one way only.
+func validateAuth(spec RedisClusterSpec) error {
+    if spec.Auth != nil && spec.PasswordSecretRef != nil {
+        return fmt.Errorf("auth and passwordSecretRef cannot both be set")
+    }
+    return nil
+}
+
+// authSecretName returns the name of the Secret generated for a cluster.
+func authSecretName(cluster *RedisCluster) string {
+    return cluster.ObjectMeta.Name + "-auth"
+}
+
+// generatePassword returns a random password.
+func generatePassword() (string, error) {
+    password := make([]byte, generatedPasswordBytes)
+    _, err := rand.Read(password)
+    if err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(password), nil
+}
+
+// reconcileAuthSecret generates the auth Secret of a cluster whose auth does
+// not name one, and records its name in the spec. The Secret is owned by the
+// cluster and kept as is once it exists.
+func reconcileAuthSecret(namespace string, cluster *RedisCluster) error {
+    if cluster.Spec.Auth == nil || cluster.Spec.Auth.SecretName != "" {
+        return nil
+    }
+
+    // Generate the password
+    password, err := generatePassword()
+    if err != nil {
+        return err
+    }
+
+    // Create the Secret unless a previous reconcile did
+    secret := &corev1.Secret{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            authSecretName(cluster),
+            Namespace:       namespace,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        StringData: map[string]string{authSecretKey: password},
+    }
+    _, err = createOrUpdate(secret, &corev1.Secret{}, func() bool { return false })
+    if err != nil {
+        return err
+    }
+
+    // Record the Secret in the spec
+    cluster.Spec.Auth.SecretName = secret.Name
+    return sdk.Update(cluster)
+}
+
+// redisPassword returns the Redis password of the spec, or an empty string if
+// the spec does not reference one. A missing Secret or key is an error, so
+// that a cluster meant to be protected never starts without a password.
+func redisPassword(namespace string, spec RedisClusterSpec) (string, error) {
+    ref := passwordSecretRef(spec)
+    if ref == nil {
+        return "", nil
+    }
+
+    secret := &corev1.Secret{}
+    err := getObject(secret, namespace, ref.Name)
+    if apierrors.IsNotFound(err) {
+        return "", fmt.Errorf("password secret %s not found", ref.Name)
+    }
+    if err != nil {
+        return "", err
+    }
+    password, ok := secret.Data[ref.Key]
+    if !ok || len(password) == 0 {
+        return "", fmt.Errorf("password secret %s has no key %s", ref.Name, ref.Key)
+    }
+    return string(password), nil
+}
+
+// passwordEnv returns the environment of the redis container exposing the
+// password from the referenced Secret.
+func passwordEnv(spec RedisClusterSpec) []corev1.EnvVar {
+    ref := passwordSecretRef(spec)
+    if ref == nil {
+        return nil
+    }
+    return []corev1.EnvVar{{
+        Name: redisPasswordEnv,
+        ValueFrom: &corev1.EnvVarSource{
+            SecretKeyRef: ref,
+        },
+    }}
+}
+
+// setClusterPassword records the Redis password of a cluster. An empty
+// password forgets it.
+func setClusterPassword(namespace, name, password string) {
+    passwordsMu.Lock()
+    defer passwordsMu.Unlock()
+
+    key := types.NamespacedName{Namespace: namespace, Name: name}
+    if password == "" {
+        delete(passwords, key)
+        return
+    }
+    passwords[key] = password
+}
+
+// podPassword returns the Redis password of the cluster the pod belongs to,
+// reading it from the Secret if the cluster has not been reconciled yet.
+func podPassword(pod *corev1.Pod) string {
+    key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Labels["controller"]}
+    passwordsMu.Lock()
+    password, ok := passwords[key]
+    passwordsMu.Unlock()
+    if ok {
+        return password
+    }
+
+    // Look the password up from the cluster
+    cluster := &RedisCluster{}
+    err := sdk.Get(cluster, key.Namespace, key.Name)
+    if err != nil {
+        return ""
+    }
+    password, err = redisPassword(key.Namespace, cluster.Spec)
+    if err != nil {
+        return ""
+    }
+    setClusterPassword(key.Namespace, key.Name, password)
+    return password
+}
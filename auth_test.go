@@ -0,0 +1,89 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// argValue returns the value following the flag in the arguments, or an
+// empty string if the flag is not set.
+func argValue(args []string, flag string) string {
+    for i := 0; i < len(args)-1; i++ {
+        if args[i] == flag {
+            return args[i+1]
+        }
+    }
+    return ""
+}
+
+func TestPasswordEnvAndArgs(t *testing.T) {
+    ref := &corev1.SecretKeySelector{
+        LocalObjectReference: corev1.LocalObjectReference{Name: "cache-password"},
+        Key:                  "redis",
+    }
+    tests := []struct {
+        name string
+        spec RedisClusterSpec
+        want *corev1.SecretKeySelector
+    }{
+        {"no password", RedisClusterSpec{}, nil},
+        {"password secret", RedisClusterSpec{PasswordSecretRef: ref}, ref},
+        {"generated password", RedisClusterSpec{Auth: &RedisAuthSpec{SecretName: "cache-auth"}}, &corev1.SecretKeySelector{
+            LocalObjectReference: corev1.LocalObjectReference{Name: "cache-auth"},
+            Key:                  authSecretKey,
+        }},
+    }
+    for _, test := range tests {
+        env := passwordEnv(test.spec)
+        args := redisArgs(test.spec)
+        if test.want == nil {
+            if len(env) != 0 || argValue(args, "--requirepass") != "" {
+                t.Errorf("%s: got env %v and args %v, want no password", test.name, env, args)
+            }
+            continue
+        }
+        if len(env) != 1 || env[0].Name != redisPasswordEnv || env[0].ValueFrom == nil || *env[0].ValueFrom.SecretKeyRef != *test.want {
+            t.Errorf("%s: got env %v, want %s from %v", test.name, env, redisPasswordEnv, test.want)
+        }
+        for _, flag := range []string{"--requirepass", "--masterauth"} {
+            if value := argValue(args, flag); value != "$("+redisPasswordEnv+")" {
+                t.Errorf("%s: got %s %q, want it read from %s", test.name, flag, value, redisPasswordEnv)
+            }
+        }
+        if strings.Contains(strings.Join(args, " "), "cache-") {
+            t.Errorf("%s: got args %v, want the Secret kept out of them", test.name, args)
+        }
+    }
+}
+
+func TestRedisPassword(t *testing.T) {
+    spec := RedisClusterSpec{PasswordSecretRef: &corev1.SecretKeySelector{
+        LocalObjectReference: corev1.LocalObjectReference{Name: "cache-password"},
+        Key:                  "redis",
+    }}
+
+    newFakeClient(t)
+    _, err := redisPassword("default", spec)
+    if err == nil || !strings.Contains(err.Error(), "not found") {
+        t.Errorf("got %v, want the missing Secret reported", err)
+    }
+
+    secret := &corev1.Secret{
+        ObjectMeta: metav1.ObjectMeta{Name: "cache-password", Namespace: "default"},
+        Data:       map[string][]byte{"other": []byte("secret")},
+    }
+    newFakeClient(t, secret)
+    _, err = redisPassword("default", spec)
+    if err == nil || !strings.Contains(err.Error(), "no key redis") {
+        t.Errorf("got %v, want the missing key reported", err)
+    }
+
+    secret.Data["redis"] = []byte("s3cret")
+    newFakeClient(t, secret)
+    password, err := redisPassword("default", spec)
+    if err != nil || password != "s3cret" {
+        t.Errorf("got %q and %v, want the password of the Secret", password, err)
+    }
+}
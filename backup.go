@@ -0,0 +1,400 @@
+package main
+
+import (
+    "fmt"
+    "net/url"
+    "reflect"
+    "regexp"
+    "strings"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    batchv1 "k8s.io/api/batch/v1"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+    // defaultBackupImage uploads the snapshots when the spec does not set an image.
+    defaultBackupImage = "amazon/aws-cli:latest"
+
+    // backupLabel marks the jobs and pods of the backup of a cluster. The
+    // backup pods must not carry the labels of the Redis pods.
+    backupLabel = "yaro.io/backup"
+
+    // backupVolumeName and backupMountPath hold the snapshot between the
+    // dump and the upload.
+    backupVolumeName = "backup"
+    backupMountPath  = "/backup"
+
+    // backupFile is the name of the snapshot in the backup volume.
+    backupFile = "dump.rdb"
+
+    // bucketEnv, keyEnv and endpointEnv locate the snapshot for the scripts
+    // copying it, which quote them instead of having the shell parse the
+    // values of the spec.
+    bucketEnv   = "YARO_BUCKET"
+    keyEnv      = "YARO_KEY"
+    endpointEnv = "YARO_ENDPOINT"
+
+    // ReasonBackupFailed is the reason of the event recorded when a backup job fails.
+    ReasonBackupFailed = "BackupFailed"
+)
+
+// bucketPattern matches the names of S3 buckets.
+var bucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// backupCredentialKeys are the keys the backup credentials Secret must hold.
+var backupCredentialKeys = []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}
+
+// backupName returns the name of the backup CronJob of the cluster.
+func backupName(cluster *RedisCluster) string {
+    return cluster.ObjectMeta.Name + "-backup"
+}
+
+// backupImage returns the image uploading the snapshots.
+func backupImage(spec *RedisBackupSpec) string {
+    if spec.Image == "" {
+        return defaultBackupImage
+    }
+    return spec.Image
+}
+
+// backupDumpScript returns the script fetching an RDB snapshot from the
+// master through the master Service, so the snapshot holds the latest writes.
+func backupDumpScript(cluster *RedisCluster) string {
+    cli := "redis-cli"
+    if cluster.Spec.TLS != nil {
+        cli += " " + tlsCLIArgs()
+    }
+    return fmt.Sprintf("%s -h %s -p %d --rdb %s/%s", cli, roleServiceName(cluster, RoleMaster), clientPort(cluster.Spec), backupMountPath, backupFile)
+}
+
+// backupKeyPrefix returns the prefix of the keys of the snapshots of the
+// cluster in the bucket.
+func backupKeyPrefix(cluster *RedisCluster) string {
+    return strings.Trim(cluster.Spec.Backup.Prefix+"/"+cluster.ObjectMeta.Namespace+"/"+cluster.ObjectMeta.Name, "/")
+}
+
+// objectStorageEnv returns the environment locating a snapshot in a bucket.
+func objectStorageEnv(bucket, key, endpoint string) []corev1.EnvVar {
+    env := []corev1.EnvVar{
+        {Name: bucketEnv, Value: bucket},
+        {Name: keyEnv, Value: key},
+    }
+    if endpoint != "" {
+        env = append(env, corev1.EnvVar{Name: endpointEnv, Value: endpoint})
+    }
+    return env
+}
+
+// s3CopyScript returns the command copying a snapshot from source to
+// destination, through the endpoint of the environment if there is one.
+func s3CopyScript(source, destination, endpoint string) string {
+    script := fmt.Sprintf("aws s3 cp %s %s", source, destination)
+    if endpoint != "" {
+        script += ` --endpoint-url "$` + endpointEnv + `"`
+    }
+    return script
+}
+
+// validateObjectStorage checks the bucket, key and endpoint locating
+// snapshots.
+func validateObjectStorage(bucket, key, endpoint string) error {
+    if !bucketPattern.MatchString(bucket) {
+        return fmt.Errorf("bucket %q is not a valid bucket name", bucket)
+    }
+    if strings.IndexFunc(key, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0 {
+        return fmt.Errorf("key %q holds control characters", key)
+    }
+    if endpoint != "" {
+        u, err := url.Parse(endpoint)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return fmt.Errorf("endpoint %q is not an http or https URL", endpoint)
+        }
+    }
+    return nil
+}
+
+// backupUploadScript returns the script uploading the snapshot to the bucket
+// under a timestamped key.
+func backupUploadScript(cluster *RedisCluster) string {
+    source := backupMountPath + "/" + backupFile
+    destination := `"s3://$` + bucketEnv + `/$` + keyEnv + `/$(date -u +%Y%m%dT%H%M%SZ).rdb"`
+    return s3CopyScript(source, destination, cluster.Spec.Backup.Endpoint)
+}
+
+// newBackupCronJob builds the CronJob backing the cluster up on the schedule
+// of the spec. An init container dumps a snapshot from the cluster, which the
+// container then uploads.
+func newBackupCronJob(cluster *RedisCluster, namespace string) *batchv1.CronJob {
+    spec := cluster.Spec.Backup
+    jobLabels := map[string]string{backupLabel: cluster.ObjectMeta.Name}
+
+    dump := corev1.Container{
+        Name:            "dump",
+        Image:           redisImage(cluster.Spec),
+        ImagePullPolicy: cluster.Spec.ImagePullPolicy,
+        Command:         []string{"sh", "-c", backupDumpScript(cluster)},
+        SecurityContext: containerSecurityContext(cluster.Spec),
+        VolumeMounts: []corev1.VolumeMount{{
+            Name:      backupVolumeName,
+            MountPath: backupMountPath,
+        }},
+    }
+    if ref := passwordSecretRef(cluster.Spec); ref != nil {
+        dump.Env = []corev1.EnvVar{{
+            Name: "REDISCLI_AUTH",
+            ValueFrom: &corev1.EnvVarSource{
+                SecretKeyRef: ref,
+            },
+        }}
+    }
+    volumes := []corev1.Volume{{
+        Name: backupVolumeName,
+        VolumeSource: corev1.VolumeSource{
+            EmptyDir: &corev1.EmptyDirVolumeSource{},
+        },
+    }}
+    if cluster.Spec.TLS != nil {
+        volume, mount := tlsVolume(cluster.Spec)
+        volumes = append(volumes, volume)
+        dump.VolumeMounts = append(dump.VolumeMounts, mount)
+    }
+
+    upload := corev1.Container{
+        Name:            "upload",
+        Image:           backupImage(spec),
+        Command:         []string{"sh", "-c", backupUploadScript(cluster)},
+        SecurityContext: containerSecurityContext(cluster.Spec),
+        EnvFrom: []corev1.EnvFromSource{{
+            SecretRef: &corev1.SecretEnvSource{
+                LocalObjectReference: spec.CredentialsSecretRef,
+            },
+        }},
+        VolumeMounts: []corev1.VolumeMount{{
+            Name:      backupVolumeName,
+            MountPath: backupMountPath,
+            ReadOnly:  true,
+        }},
+    }
+    upload.Env = objectStorageEnv(spec.Bucket, backupKeyPrefix(cluster), spec.Endpoint)
+    if spec.Region != "" {
+        upload.Env = append(upload.Env, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: spec.Region})
+    }
+
+    return &batchv1.CronJob{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            backupName(cluster),
+            Namespace:       namespace,
+            Labels:          jobLabels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: batchv1.CronJobSpec{
+            Schedule:          spec.Schedule,
+            ConcurrencyPolicy: batchv1.ForbidConcurrent,
+            JobTemplate: batchv1.JobTemplateSpec{
+                ObjectMeta: metav1.ObjectMeta{
+                    Labels: jobLabels,
+                },
+                Spec: batchv1.JobSpec{
+                    Template: corev1.PodTemplateSpec{
+                        ObjectMeta: metav1.ObjectMeta{
+                            Labels: jobLabels,
+                        },
+                        Spec: corev1.PodSpec{
+                            RestartPolicy:      corev1.RestartPolicyOnFailure,
+                            ServiceAccountName: serviceAccountName(cluster),
+                            ImagePullSecrets:   cluster.Spec.ImagePullSecrets,
+                            SecurityContext:    podSecurityContext(cluster.Spec),
+                            InitContainers:     []corev1.Container{dump},
+                            Containers:         []corev1.Container{upload},
+                            Volumes:            volumes,
+                        },
+                    },
+                },
+            },
+        },
+    }
+}
+
+// validateBackup checks the backup settings of the spec and that the
+// credentials Secret holds the keys the upload needs.
+func validateBackup(namespace string, spec RedisClusterSpec) error {
+    backup := spec.Backup
+    if backup == nil {
+        return nil
+    }
+    if len(strings.Fields(backup.Schedule)) != 5 && !strings.HasPrefix(backup.Schedule, "@") {
+        return fmt.Errorf("backup schedule %q is not a cron schedule", backup.Schedule)
+    }
+    if backup.Bucket == "" {
+        return fmt.Errorf("backup bucket must be set")
+    }
+    err := validateObjectStorage(backup.Bucket, backup.Prefix, backup.Endpoint)
+    if err != nil {
+        return fmt.Errorf("backup %v", err)
+    }
+    if spec.Mode == ModeCluster {
+        return fmt.Errorf("backups of clusters in cluster mode are not supported, each shard would need its own snapshot")
+    }
+
+    // Check the credentials
+    secret := &corev1.Secret{}
+    err = getObject(secret, namespace, backup.CredentialsSecretRef.Name)
+    if apierrors.IsNotFound(err) {
+        return fmt.Errorf("backup credentials secret %s not found", backup.CredentialsSecretRef.Name)
+    }
+    if err != nil {
+        return err
+    }
+    for _, key := range backupCredentialKeys {
+        if len(secret.Data[key]) == 0 {
+            return fmt.Errorf("backup credentials secret %s has no key %s", backup.CredentialsSecretRef.Name, key)
+        }
+    }
+    return nil
+}
+
+// reconcileBackup makes sure the backup CronJob of the cluster matches the
+// spec, removing it when backups are disabled, and records the outcome of the
+// backups.
+func (h *RedisClusterHandler) reconcileBackup(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    if cluster.Spec.Backup == nil {
+        return deleteIfExists(&batchv1.CronJob{}, namespace, backupName(cluster))
+    }
+
+    // Create or update the CronJob
+    cronJob := newBackupCronJob(cluster, namespace)
+    existing := &batchv1.CronJob{}
+    _, err := createOrUpdate(cronJob, existing, func() bool {
+        changed := false
+        if existing.Spec.Schedule != cronJob.Spec.Schedule {
+            existing.Spec.Schedule = cronJob.Spec.Schedule
+            changed = true
+        }
+        existingPod, desiredPod := existing.Spec.JobTemplate.Spec.Template.Spec, cronJob.Spec.JobTemplate.Spec.Template.Spec
+        if !sameContainers(existingPod, desiredPod) || existingPod.ServiceAccountName != desiredPod.ServiceAccountName {
+            existing.Spec.JobTemplate = cronJob.Spec.JobTemplate
+            changed = true
+        }
+        return changed
+    })
+    if err != nil {
+        return err
+    }
+
+    return h.updateBackupStatus(ctx, namespace, cluster, existing)
+}
+
+// sameContainers reports whether two pod specs run the same named containers
+// with the same images, commands, arguments, environments, volume mounts,
+// resources and security contexts. The other fields are defaulted by the API
+// server and would always differ.
+func sameContainers(existing, desired corev1.PodSpec) bool {
+    if len(existing.InitContainers) != len(desired.InitContainers) || len(existing.Containers) != len(desired.Containers) {
+        return false
+    }
+    pairs := [][2][]corev1.Container{{existing.InitContainers, desired.InitContainers}, {existing.Containers, desired.Containers}}
+    for _, pair := range pairs {
+        for i := range pair[0] {
+            a, b := pair[0][i], pair[1][i]
+            if a.Name != b.Name || a.Image != b.Image || !reflect.DeepEqual(a.Command, b.Command) || !reflect.DeepEqual(a.Args, b.Args) || !reflect.DeepEqual(a.Env, b.Env) || !reflect.DeepEqual(a.EnvFrom, b.EnvFrom) {
+                return false
+            }
+            if !reflect.DeepEqual(a.VolumeMounts, b.VolumeMounts) {
+                return false
+            }
+            if !sameResources(a.Resources, b.Resources) || !reflect.DeepEqual(a.SecurityContext, b.SecurityContext) {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+// sameResources reports whether a container has the desired resources. The
+// API server copies the limits into the requests left unset, so a request
+// missing from the desired resources matches its limit.
+func sameResources(existing, desired corev1.ResourceRequirements) bool {
+    if !equality.Semantic.DeepEqual(existing.Limits, desired.Limits) {
+        return false
+    }
+    for name, quantity := range existing.Requests {
+        expected, ok := desired.Requests[name]
+        if !ok {
+            expected, ok = desired.Limits[name]
+        }
+        if !ok || quantity.Cmp(expected) != 0 {
+            return false
+        }
+    }
+    for name := range desired.Requests {
+        if _, ok := existing.Requests[name]; !ok {
+            return false
+        }
+    }
+    return true
+}
+
+// updateBackupStatus records the time of the last successful backup and
+// records an event when the latest backup job failed.
+func (h *RedisClusterHandler) updateBackupStatus(ctx sdk.Context, namespace string, cluster *RedisCluster, cronJob *batchv1.CronJob) error {
+    // Find the latest backup job
+    selector := labels.SelectorFromSet(map[string]string{backupLabel: cluster.ObjectMeta.Name})
+    jobs, err := ctx.GetClientset().BatchV1().Jobs(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+    if err != nil {
+        return err
+    }
+    var latest *batchv1.Job
+    for i := range jobs.Items {
+        if latest == nil || jobs.Items[i].CreationTimestamp.After(latest.CreationTimestamp.Time) {
+            latest = &jobs.Items[i]
+        }
+    }
+    failedJob := ""
+    if latest != nil && jobFailed(latest) {
+        failedJob = latest.Name
+    }
+
+    // Get the RedisCluster
+    current := &RedisCluster{}
+    err = sdk.Get(current, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    status := current.Status.Backup
+    if status == nil {
+        status = &RedisBackupStatus{}
+    }
+
+    changed := false
+    if cronJob.Status.LastSuccessfulTime != nil && !cronJob.Status.LastSuccessfulTime.Equal(status.LastSuccessfulTime) {
+        status.LastSuccessfulTime = cronJob.Status.LastSuccessfulTime
+        changed = true
+    }
+    if failedJob != status.LastFailedJob {
+        if failedJob != "" {
+            h.recorder.Eventf(current, corev1.EventTypeWarning, ReasonBackupFailed, "Backup job %s failed", failedJob)
+        }
+        status.LastFailedJob = failedJob
+        changed = true
+    }
+    if !changed {
+        return nil
+    }
+
+    current.Status.Backup = status
+    return updateStatus(current)
+}
+
+// jobFailed reports whether the job has the Failed condition.
+func jobFailed(job *batchv1.Job) bool {
+    for _, condition := range job.Status.Conditions {
+        if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+            return true
+        }
+    }
+    return false
+}
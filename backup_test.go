@@ -0,0 +1,139 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    batchv1 "k8s.io/api/batch/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newTestBackupCluster returns a cluster backed up nightly to a bucket.
+func newTestBackupCluster() *RedisCluster {
+    cluster := newTestCluster(3)
+    cluster.Spec.Backup = &RedisBackupSpec{
+        Schedule:             "0 3 * * *",
+        Bucket:               "cache-backups",
+        Prefix:               "nightly",
+        Region:               "eu-west-1",
+        CredentialsSecretRef: corev1.LocalObjectReference{Name: "cache-backup-credentials"},
+    }
+    return cluster
+}
+
+// envValue returns the value of the named environment variable of the
+// container, or an empty string.
+func envValue(container corev1.Container, name string) string {
+    for _, env := range container.Env {
+        if env.Name == name {
+            return env.Value
+        }
+    }
+    return ""
+}
+
+func TestNewBackupCronJob(t *testing.T) {
+    cluster := newTestBackupCluster()
+    cronJob := newBackupCronJob(cluster, "default")
+
+    if cronJob.Spec.Schedule != "0 3 * * *" || cronJob.Spec.ConcurrencyPolicy != batchv1.ForbidConcurrent {
+        t.Errorf("got schedule %q with policy %s, want 0 3 * * * without concurrent runs", cronJob.Spec.Schedule, cronJob.Spec.ConcurrencyPolicy)
+    }
+    pod := cronJob.Spec.JobTemplate.Spec.Template.Spec
+    if len(pod.InitContainers) != 1 || len(pod.Containers) != 1 {
+        t.Fatalf("got %d init containers and %d containers, want the dump and the upload", len(pod.InitContainers), len(pod.Containers))
+    }
+    if cronJob.ObjectMeta.Labels[backupLabel] != "cache" || cronJob.Spec.JobTemplate.Spec.Template.ObjectMeta.Labels[backupLabel] != "cache" {
+        t.Errorf("got labels %v, want %s=cache on the CronJob and its pods", cronJob.ObjectMeta.Labels, backupLabel)
+    }
+
+    upload := pod.Containers[0]
+    want := map[string]string{
+        bucketEnv:            "cache-backups",
+        keyEnv:               "nightly/default/cache",
+        "AWS_DEFAULT_REGION": "eu-west-1",
+    }
+    for name, value := range want {
+        if got := envValue(upload, name); got != value {
+            t.Errorf("got %s %q, want %q", name, got, value)
+        }
+    }
+    if envValue(upload, endpointEnv) != "" {
+        t.Errorf("got endpoint %q without an endpoint in the spec", envValue(upload, endpointEnv))
+    }
+    script := upload.Command[2]
+    if strings.Contains(script, "cache-backups") || strings.Contains(script, "nightly") || strings.Contains(script, "--endpoint-url") {
+        t.Errorf("got script %q, want the location read from the environment", script)
+    }
+    if len(upload.EnvFrom) != 1 || upload.EnvFrom[0].SecretRef.Name != "cache-backup-credentials" {
+        t.Errorf("got %v, want the credentials from cache-backup-credentials", upload.EnvFrom)
+    }
+}
+
+func TestBackupEndpoint(t *testing.T) {
+    cluster := newTestBackupCluster()
+    cluster.Spec.Backup.Endpoint = "https://minio.storage:9000"
+    upload := newBackupCronJob(cluster, "default").Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+    if got := envValue(upload, endpointEnv); got != "https://minio.storage:9000" {
+        t.Errorf("got endpoint %q, want https://minio.storage:9000", got)
+    }
+    if script := upload.Command[2]; !strings.HasSuffix(script, `--endpoint-url "$`+endpointEnv+`"`) {
+        t.Errorf("got script %q, want the endpoint read from the environment", script)
+    }
+}
+
+func TestValidateObjectStorage(t *testing.T) {
+    tests := []struct {
+        name     string
+        bucket   string
+        key      string
+        endpoint string
+        valid    bool
+    }{
+        {"bucket and key", "cache-backups", "nightly/cache", "", true},
+        {"http endpoint", "cache-backups", "", "http://minio:9000", true},
+        {"empty bucket", "", "nightly", "", false},
+        {"bucket with a shell command", "b$(reboot)", "", "", false},
+        {"uppercase bucket", "Backups", "", "", false},
+        {"key with a newline", "cache-backups", "nightly\nrm -rf /", "", false},
+        {"endpoint without a scheme", "cache-backups", "", "minio:9000", false},
+        {"endpoint with another scheme", "cache-backups", "", "file:///etc", false},
+    }
+    for _, test := range tests {
+        err := validateObjectStorage(test.bucket, test.key, test.endpoint)
+        if test.valid && err != nil {
+            t.Errorf("%s: got %v, want no error", test.name, err)
+        }
+        if !test.valid && err == nil {
+            t.Errorf("%s: got no error, want it rejected", test.name)
+        }
+    }
+}
+
+func TestValidateBackup(t *testing.T) {
+    credentials := &corev1.Secret{
+        ObjectMeta: metav1.ObjectMeta{Name: "cache-backup-credentials", Namespace: "default"},
+        Data: map[string][]byte{
+            "AWS_ACCESS_KEY_ID":     []byte("id"),
+            "AWS_SECRET_ACCESS_KEY": []byte("secret"),
+        },
+    }
+    newFakeClient(t, credentials)
+
+    cluster := newTestBackupCluster()
+    err := validateBackup("default", cluster.Spec)
+    if err != nil {
+        t.Errorf("got %v, want the backup accepted", err)
+    }
+
+    cluster.Spec.Backup.Schedule = "nightly"
+    if err = validateBackup("default", cluster.Spec); err == nil {
+        t.Error("got no error for a schedule that is not a cron schedule")
+    }
+
+    cluster = newTestBackupCluster()
+    cluster.Spec.Backup.CredentialsSecretRef.Name = "missing"
+    if err = validateBackup("default", cluster.Spec); err == nil {
+        t.Error("got no error for missing credentials")
+    }
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// certificateKind is the cert-manager kind issuing the TLS certificates.
+var certificateKind = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// defaultIssuerKind is the kind of the cert-manager issuer when the spec does not set one.
+const defaultIssuerKind = "Issuer"
+
+// certificateDNSNames returns the names the certificate of a cluster covers:
+// the client Service and each pod behind the headless Service.
+func certificateDNSNames(cluster *RedisCluster, namespace string) []string {
+    name := cluster.ObjectMeta.Name
+    headless := headlessServiceName(cluster)
+    return []string{
+        name,
+        fmt.Sprintf("%s.%s.svc", name, namespace),
+        fmt.Sprintf("*.%s.%s.svc", headless, namespace),
+    }
+}
+
+// newCertificate builds the cert-manager Certificate issuing the TLS Secret of the cluster.
+func newCertificate(cluster *RedisCluster, namespace string) *unstructured.Unstructured {
+    issuer := cluster.Spec.TLS.IssuerRef
+    kind := issuer.Kind
+    if kind == "" {
+        kind = defaultIssuerKind
+    }
+    dnsNames := []interface{}{}
+    for _, dnsName := range certificateDNSNames(cluster, namespace) {
+        dnsNames = append(dnsNames, dnsName)
+    }
+
+    certificate := &unstructured.Unstructured{}
+    certificate.SetGroupVersionKind(certificateKind)
+    certificate.SetName(cluster.Spec.TLS.SecretName)
+    certificate.SetNamespace(namespace)
+    certificate.SetOwnerReferences(ownerReferences(cluster))
+    certificate.Object["spec"] = map[string]interface{}{
+        "secretName": cluster.Spec.TLS.SecretName,
+        "dnsNames":   dnsNames,
+        "usages":     []interface{}{"server auth", "client auth"},
+        "issuerRef": map[string]interface{}{
+            "name":  issuer.Name,
+            "kind":  kind,
+            "group": "cert-manager.io",
+        },
+    }
+    return certificate
+}
+
+// reconcileCertificate has cert-manager issue the TLS Secret of a cluster
+// whose TLS spec references an issuer. The Secret is read once cert-manager
+// created it; until then the TLS configuration of the cluster fails to load.
+func reconcileCertificate(cluster *RedisCluster, namespace string) error {
+    if cluster.Spec.TLS == nil || cluster.Spec.TLS.IssuerRef == nil {
+        return nil
+    }
+
+    certificate := newCertificate(cluster, namespace)
+    existing := &unstructured.Unstructured{}
+    existing.SetGroupVersionKind(certificateKind)
+    _, err := createOrUpdate(certificate, existing, func() bool {
+        if reflect.DeepEqual(existing.Object["spec"], certificate.Object["spec"]) {
+            return false
+        }
+        existing.Object["spec"] = certificate.Object["spec"]
+        return true
+    })
+    return err
+}
+
+// validateCertificate checks the issuer reference of the TLS spec.
+func validateCertificate(spec RedisClusterSpec) error {
+    if spec.TLS == nil || spec.TLS.IssuerRef == nil {
+        return nil
+    }
+    if spec.TLS.IssuerRef.Name == "" {
+        return fmt.Errorf("tls.issuerRef.name must name a cert-manager issuer")
+    }
+    switch spec.TLS.IssuerRef.Kind {
+    case "", "Issuer", "ClusterIssuer":
+        return nil
+    default:
+        return fmt.Errorf("tls.issuerRef.kind %s is invalid, it must be Issuer or ClusterIssuer", spec.TLS.IssuerRef.Kind)
+    }
+}
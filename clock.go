@@ -0,0 +1,110 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "time"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+    // defaultClockSkewThreshold is the drift between nodes above which the
+    // ClockSkew condition is set.
+    defaultClockSkewThreshold = time.Second
+
+    // clockSkewCheckInterval is how often the clocks of a cluster are compared.
+    clockSkewCheckInterval = 5 * time.Minute
+)
+
+// getClockSkewThreshold returns the threshold set through CLOCK_SKEW_THRESHOLD,
+// or the default one.
+func getClockSkewThreshold() time.Duration {
+    threshold, err := time.ParseDuration(os.Getenv("CLOCK_SKEW_THRESHOLD"))
+    if err != nil || threshold <= 0 {
+        return defaultClockSkewThreshold
+    }
+    return threshold
+}
+
+// checkClockSkew compares the clocks of the ready nodes of the cluster and sets
+// the ClockSkew condition. The check only runs once per clockSkewCheckInterval.
+func (h *RedisClusterHandler) checkClockSkew(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    name := cluster.ObjectMeta.Name
+    key := types.NamespacedName{Namespace: namespace, Name: name}
+
+    // Only sample the clocks every clockSkewCheckInterval
+    h.mu.Lock()
+    lastCheck := h.clockChecks[key]
+    if time.Since(lastCheck) < clockSkewCheckInterval {
+        h.mu.Unlock()
+        return nil
+    }
+    h.clockChecks[key] = time.Now()
+    h.mu.Unlock()
+
+    // Get the pods for the cluster
+    pods, err := listClusterPods(ctx, namespace, name)
+    if err != nil {
+        return err
+    }
+
+    // Measure the offset of each node's clock from the operator's
+    var minOffset, maxOffset time.Duration
+    sampled := 0
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+
+        offset, err := clockOffset(pod)
+        if err != nil {
+            return fmt.Errorf("reading time of pod %s: %v", pod.Name, err)
+        }
+        if sampled == 0 || offset < minOffset {
+            minOffset = offset
+        }
+        if sampled == 0 || offset > maxOffset {
+            maxOffset = offset
+        }
+        sampled++
+    }
+    if sampled < 2 {
+        return nil
+    }
+
+    // Update the ClockSkew condition
+    drift := maxOffset - minOffset
+    condition := metav1.Condition{
+        Type:    ConditionClockSkew,
+        Status:  metav1.ConditionFalse,
+        Reason:  "ClocksInSync",
+        Message: fmt.Sprintf("Clock drift between nodes is %s", drift),
+    }
+    if drift > h.clockSkewThreshold {
+        condition.Status = metav1.ConditionTrue
+        condition.Reason = "ClockDriftExceeded"
+        condition.Message = fmt.Sprintf("Clock drift between nodes is %s, above the %s threshold", drift, h.clockSkewThreshold)
+    }
+    return setClusterCondition(namespace, name, condition)
+}
+
+// clockOffset returns the offset of the pod's Redis clock from the local clock,
+// correcting for the round trip of the TIME command.
+func clockOffset(pod *corev1.Pod) (time.Duration, error) {
+    client := newRedisClient(pod)
+    defer client.Close()
+
+    start := time.Now()
+    remote, err := client.Time().Result()
+    if err != nil {
+        return 0, err
+    }
+    end := time.Now()
+
+    local := start.Add(end.Sub(start) / 2)
+    return remote.Sub(local), nil
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// ModeCluster runs the nodes as a sharded Redis Cluster.
+const ModeCluster = "cluster"
+
+const (
+    // clusterSlots is the number of hash slots of a Redis Cluster.
+    clusterSlots = 16384
+
+    // minClusterMasters is the smallest number of masters of a Redis Cluster.
+    minClusterMasters = 3
+
+    // clusterNodeTimeout is the cluster-node-timeout of the nodes, in milliseconds.
+    clusterNodeTimeout = 5000
+
+    // maxSlotsPerReconcile caps the slots migrated by a reconcile, so that a
+    // rebalance is spread over several reconciles.
+    maxSlotsPerReconcile = 1024
+
+    // migrateBatch is the number of keys moved by a MIGRATE.
+    migrateBatch = 100
+
+    // migrateTimeout is the MIGRATE timeout, in milliseconds.
+    migrateTimeout = 5000
+)
+
+// replicasPerMaster returns the number of replicas of each master of a cluster in cluster mode.
+func replicasPerMaster(spec RedisClusterSpec) int32 {
+    if spec.Cluster == nil {
+        return 0
+    }
+    return spec.Cluster.ReplicasPerMaster
+}
+
+// podCount returns the number of Redis pods of the spec. In cluster mode the
+// size is the number of masters, each with its replicas.
+func podCount(spec RedisClusterSpec) int32 {
+    if spec.Mode == ModeCluster {
+        return spec.Size * (1 + replicasPerMaster(spec))
+    }
+    return spec.Size
+}
+
+// clusterModeArgs returns the redis-server arguments enabling cluster mode.
+// The node configuration lives in the working directory, so nodes with
+// persistent storage keep their identity across restarts.
+func clusterModeArgs(spec RedisClusterSpec) []string {
+    args := []string{
+        "--cluster-enabled", "yes",
+        "--cluster-config-file", "nodes.conf",
+        "--cluster-node-timeout", strconv.Itoa(clusterNodeTimeout),
+    }
+    if spec.TLS != nil {
+        args = append(args, "--tls-cluster", "yes")
+    }
+    return args
+}
+
+// validateClusterMode checks the settings of a cluster in cluster mode.
+func validateClusterMode(spec RedisClusterSpec) error {
+    if spec.Size < minClusterMasters {
+        return fmt.Errorf("cluster mode needs at least %d masters, size is %d", minClusterMasters, spec.Size)
+    }
+    if replicasPerMaster(spec) < 0 {
+        return fmt.Errorf("cluster replicasPerMaster must not be negative")
+    }
+    return nil
+}
+
+// clusterNode is a node as listed by CLUSTER NODES.
+// +kubebuilder:object:generate=false
+type clusterNode struct {
+    ID       string
+    Address  string
+    Myself   bool
+    Master   bool
+    Failed   bool
+    MasterID string
+    Slots    []int
+}
+
+// parseClusterNodes parses the output of CLUSTER NODES. Slots being imported
+// or migrated are left out.
+func parseClusterNodes(output string) []clusterNode {
+    nodes := []clusterNode{}
+    for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+        fields := strings.Fields(line)
+        if len(fields) < 8 {
+            continue
+        }
+        address := strings.SplitN(strings.SplitN(fields[1], ",", 2)[0], "@", 2)[0]
+        flags := "," + fields[2] + ","
+        node := clusterNode{
+            ID:       fields[0],
+            Address:  address,
+            Myself:   strings.Contains(flags, ",myself,"),
+            Master:   strings.Contains(flags, ",master,"),
+            Failed:   strings.Contains(flags, ",fail,") || strings.Contains(flags, ",noaddr,"),
+            MasterID: strings.Trim(fields[3], "-"),
+        }
+        for _, slots := range fields[8:] {
+            if strings.HasPrefix(slots, "[") {
+                continue
+            }
+            bounds := strings.SplitN(slots, "-", 2)
+            start, err := strconv.Atoi(bounds[0])
+            if err != nil {
+                continue
+            }
+            end := start
+            if len(bounds) == 2 {
+                end, _ = strconv.Atoi(bounds[1])
+            }
+            for slot := start; slot <= end; slot++ {
+                node.Slots = append(node.Slots, slot)
+            }
+        }
+        nodes = append(nodes, node)
+    }
+    return nodes
+}
+
+// clusterMember is a ready Redis pod with its view of the cluster.
+// +kubebuilder:object:generate=false
+type clusterMember struct {
+    Pod     *corev1.Pod
+    Ordinal int
+    Node    clusterNode
+    Client  *redis.Client
+}
+
+// podOrdinal returns the ordinal of a pod of the StatefulSet.
+func podOrdinal(pod *corev1.Pod) int {
+    i := strings.LastIndex(pod.Name, "-")
+    ordinal, err := strconv.Atoi(pod.Name[i+1:])
+    if err != nil {
+        return -1
+    }
+    return ordinal
+}
+
+// getClusterMembers connects to the ready pods of the cluster running in
+// cluster mode and reads their identity, ordered by pod ordinal. The caller
+// closes the clients.
+func getClusterMembers(ctx sdk.Context, namespace, name string) ([]*clusterMember, error) {
+    pods, err := listClusterPods(ctx, namespace, name)
+    if err != nil {
+        return nil, err
+    }
+
+    members := []*clusterMember{}
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+
+        // Leave out the pods that have not restarted in cluster mode yet
+        client := newRedisClient(pod)
+        output, err := client.ClusterNodes().Result()
+        if err != nil {
+            client.Close()
+            continue
+        }
+        member := &clusterMember{Pod: pod, Ordinal: podOrdinal(pod), Client: client}
+        members = append(members, member)
+        for _, node := range parseClusterNodes(output) {
+            if node.Myself {
+                member.Node = node
+            }
+        }
+    }
+    sort.Slice(members, func(i, j int) bool { return members[i].Ordinal < members[j].Ordinal })
+    return members, nil
+}
+
+// closeClusterMembers closes the clients of the members.
+func closeClusterMembers(members []*clusterMember) {
+    for _, member := range members {
+        member.Client.Close()
+    }
+}
+
+// reconcileClusterMode brings the Redis Cluster of a cluster in cluster mode
+// in line with its spec: it joins the nodes, assigns the slots, spreads them
+// over the masters and attaches the replicas. Each step that changes the
+// topology ends the reconcile, so that the next one starts from the state the
+// nodes have gossiped.
+func (h *RedisClusterHandler) reconcileClusterMode(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    if cluster.Spec.Mode != ModeCluster {
+        return nil
+    }
+
+    members, err := getClusterMembers(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    defer closeClusterMembers(members)
+
+    // Wait for all the pods to be ready
+    desired := int(podCount(cluster.Spec))
+    if len(members) < desired {
+        return nil
+    }
+    seed := members[0]
+    output, err := seed.Client.ClusterNodes().Result()
+    if err != nil {
+        return err
+    }
+    nodes := parseClusterNodes(output)
+
+    // Join the nodes the seed does not know yet
+    known := map[string]bool{}
+    for _, node := range nodes {
+        known[node.ID] = true
+    }
+    joined := false
+    for _, member := range members[1:] {
+        if known[member.Node.ID] || member.Ordinal >= desired {
+            continue
+        }
+        err = seed.Client.ClusterMeet(member.Pod.Status.PodIP, strconv.Itoa(int(podRedisPort(member.Pod)))).Err()
+        if err != nil {
+            return fmt.Errorf("joining pod %s: %v", member.Pod.Name, err)
+        }
+        joined = true
+    }
+    if joined {
+        return nil
+    }
+
+    // Forget the failed nodes no pod answers for anymore
+    addresses := map[string]bool{}
+    for _, member := range members {
+        addresses[podAddress(member.Pod)] = true
+    }
+    forgot := false
+    for _, node := range nodes {
+        if !node.Failed || addresses[node.Address] {
+            continue
+        }
+        for _, member := range members {
+            member.Client.ClusterForget(node.ID)
+        }
+        forgot = true
+    }
+    if forgot {
+        return nil
+    }
+
+    // Assign the slots no node serves
+    assigned, err := assignSlots(cluster, members, nodes)
+    if err != nil || assigned {
+        return err
+    }
+
+    // Move slots to the masters that have none, or off the masters being removed
+    moved, err := rebalanceSlots(cluster, members, nodes, desired)
+    if err != nil || moved {
+        return err
+    }
+
+    // Attach the remaining nodes as replicas
+    return attachClusterReplicas(cluster, members, nodes, desired)
+}
+
+// slotOwners returns the masters serving slots by node ID.
+func slotOwners(nodes []clusterNode) map[string]clusterNode {
+    owners := map[string]clusterNode{}
+    for _, node := range nodes {
+        if node.Master && !node.Failed && len(node.Slots) > 0 {
+            owners[node.ID] = node
+        }
+    }
+    return owners
+}
+
+// emptyMasters returns the members kept by the StatefulSet that are masters
+// without slots, in ordinal order.
+func emptyMasters(members []*clusterMember, nodes []clusterNode, desired int) []*clusterMember {
+    byID := map[string]clusterNode{}
+    for _, node := range nodes {
+        byID[node.ID] = node
+    }
+    empty := []*clusterMember{}
+    for _, member := range members {
+        node := byID[member.Node.ID]
+        if member.Ordinal < desired && node.Master && len(node.Slots) == 0 {
+            empty = append(empty, member)
+        }
+    }
+    return empty
+}
+
+// assignSlots assigns the slots no node serves, splitting them evenly over
+// the masters the cluster still lacks. On a new cluster that is all the
+// slots over the first pods. It reports whether it assigned any slot.
+func assignSlots(cluster *RedisCluster, members []*clusterMember, nodes []clusterNode) (bool, error) {
+    served := make([]bool, clusterSlots)
+    for _, node := range slotOwners(nodes) {
+        for _, slot := range node.Slots {
+            served[slot] = true
+        }
+    }
+    unassigned := []int{}
+    for slot, ok := range served {
+        if !ok {
+            unassigned = append(unassigned, slot)
+        }
+    }
+    if len(unassigned) == 0 {
+        return false, nil
+    }
+
+    // Pick the masters receiving the slots
+    targets := emptyMasters(members, nodes, int(podCount(cluster.Spec)))
+    missing := int(cluster.Spec.Size) - len(slotOwners(nodes))
+    if missing < 1 {
+        missing = 1
+    }
+    if len(targets) > missing {
+        targets = targets[:missing]
+    }
+    if len(targets) == 0 {
+        return false, fmt.Errorf("%d slots are not served and no master is available to serve them", len(unassigned))
+    }
+
+    // Split the slots into contiguous ranges
+    share := (len(unassigned) + len(targets) - 1) / len(targets)
+    for i, target := range targets {
+        start := i * share
+        if start >= len(unassigned) {
+            break
+        }
+        end := start + share
+        if end > len(unassigned) {
+            end = len(unassigned)
+        }
+        for _, slotRange := range slotRanges(unassigned[start:end]) {
+            err := target.Client.ClusterAddSlotsRange(slotRange[0], slotRange[1]).Err()
+            if err != nil {
+                return false, fmt.Errorf("assigning slots %d-%d to pod %s: %v", slotRange[0], slotRange[1], target.Pod.Name, err)
+            }
+        }
+    }
+    return true, nil
+}
+
+// slotRanges groups sorted slots into contiguous ranges.
+func slotRanges(slots []int) [][2]int {
+    ranges := [][2]int{}
+    for _, slot := range slots {
+        if n := len(ranges); n > 0 && ranges[n-1][1] == slot-1 {
+            ranges[n-1][1] = slot
+            continue
+        }
+        ranges = append(ranges, [2]int{slot, slot})
+    }
+    return ranges
+}
+
+// rebalanceSlots moves slots off the masters the StatefulSet is about to
+// remove, and to the masters that have none while the cluster lacks masters.
+// It reports whether it moved any slot.
+func rebalanceSlots(cluster *RedisCluster, members []*clusterMember, nodes []clusterNode, desired int) (bool, error) {
+    byID := map[string]*clusterMember{}
+    for _, member := range members {
+        byID[member.Node.ID] = member
+    }
+    owners := slotOwners(nodes)
+
+    // Sort the owners into the ones kept and the ones being removed
+    kept := []*clusterMember{}
+    removed := []*clusterMember{}
+    for id := range owners {
+        member := byID[id]
+        if member == nil {
+            continue
+        }
+        if member.Ordinal < desired {
+            kept = append(kept, member)
+        } else {
+            removed = append(removed, member)
+        }
+    }
+    sort.Slice(kept, func(i, j int) bool { return kept[i].Ordinal < kept[j].Ordinal })
+    sort.Slice(removed, func(i, j int) bool { return removed[i].Ordinal < removed[j].Ordinal })
+    counts := map[string]int{}
+    for id, node := range owners {
+        counts[id] = len(node.Slots)
+    }
+
+    // Add the masters the cluster lacks
+    if missing := int(cluster.Spec.Size) - len(kept); missing > 0 {
+        empty := emptyMasters(members, nodes, desired)
+        if len(empty) > missing {
+            empty = empty[:missing]
+        }
+        kept = append(kept, empty...)
+    }
+    if len(kept) == 0 {
+        return false, nil
+    }
+
+    // Plan the moves, from the removed masters first and then from the
+    // masters above their share to the ones below it
+    share := clusterSlots / len(kept)
+    budget := maxSlotsPerReconcile
+    moved := false
+    for budget > 0 {
+        var source *clusterMember
+        draining := false
+        for _, member := range removed {
+            if counts[member.Node.ID] > 0 {
+                source = member
+                draining = true
+                break
+            }
+        }
+        if source == nil {
+            for _, member := range kept {
+                if counts[member.Node.ID] > share && (source == nil || counts[member.Node.ID] > counts[source.Node.ID]) {
+                    source = member
+                }
+            }
+        }
+        var target *clusterMember
+        for _, member := range kept {
+            if member != source && (target == nil || counts[member.Node.ID] < counts[target.Node.ID]) {
+                target = member
+            }
+        }
+        if source == nil || target == nil || (!draining && counts[target.Node.ID] >= share) {
+            break
+        }
+
+        // Move the highest slot of the source
+        slots := owners[source.Node.ID].Slots
+        slot := slots[counts[source.Node.ID]-1]
+        err := migrateSlot(source, target, slot, podPassword(source.Pod))
+        if err != nil {
+            return moved, fmt.Errorf("moving slot %d from pod %s to pod %s: %v", slot, source.Pod.Name, target.Pod.Name, err)
+        }
+        counts[source.Node.ID]--
+        counts[target.Node.ID]++
+        budget--
+        moved = true
+    }
+    return moved, nil
+}
+
+// migrateSlot moves a slot and its keys from the source to the target master.
+func migrateSlot(source, target *clusterMember, slot int, password string) error {
+    err := target.Client.Process(redis.NewStatusCmd("cluster", "setslot", slot, "importing", source.Node.ID))
+    if err != nil {
+        return err
+    }
+    err = source.Client.Process(redis.NewStatusCmd("cluster", "setslot", slot, "migrating", target.Node.ID))
+    if err != nil {
+        return err
+    }
+
+    // Move the keys in batches
+    for {
+        keys, err := source.Client.ClusterGetKeysInSlot(slot, migrateBatch).Result()
+        if err != nil {
+            return err
+        }
+        if len(keys) == 0 {
+            break
+        }
+        args := []interface{}{"migrate", target.Pod.Status.PodIP, podRedisPort(target.Pod), "", 0, migrateTimeout}
+        if password != "" {
+            args = append(args, "auth", password)
+        }
+        args = append(args, "keys")
+        for _, key := range keys {
+            args = append(args, key)
+        }
+        err = source.Client.Process(redis.NewStatusCmd(args...))
+        if err != nil {
+            return err
+        }
+    }
+
+    // Hand the slot over
+    err = target.Client.Process(redis.NewStatusCmd("cluster", "setslot", slot, "node", target.Node.ID))
+    if err != nil {
+        return err
+    }
+    return source.Client.Process(redis.NewStatusCmd("cluster", "setslot", slot, "node", target.Node.ID))
+}
+
+// attachClusterReplicas makes the kept nodes that serve no slot replicas of
+// the masters with the fewest replicas, and moves replicas off masters that
+// serve no slot anymore.
+func attachClusterReplicas(cluster *RedisCluster, members []*clusterMember, nodes []clusterNode, desired int) error {
+    owners := slotOwners(nodes)
+    if len(owners) == 0 {
+        return nil
+    }
+    replicas := map[string]int{}
+    for _, node := range nodes {
+        if _, ok := owners[node.MasterID]; ok && !node.Master && !node.Failed {
+            replicas[node.MasterID]++
+        }
+    }
+    byID := map[string]clusterNode{}
+    for _, node := range nodes {
+        byID[node.ID] = node
+    }
+
+    for _, member := range members {
+        node := byID[member.Node.ID]
+        if member.Ordinal >= desired {
+            continue
+        }
+        if _, ok := owners[node.ID]; ok {
+            continue
+        }
+        if _, ok := owners[node.MasterID]; ok && !node.Master {
+            continue
+        }
+
+        // Pick the master with the fewest replicas
+        master := ""
+        for id := range owners {
+            if master == "" || replicas[id] < replicas[master] || (replicas[id] == replicas[master] && id < master) {
+                master = id
+            }
+        }
+        if int32(replicas[master]) >= replicasPerMaster(cluster.Spec) {
+            continue
+        }
+        err := member.Client.ClusterReplicate(master).Err()
+        if err != nil {
+            return fmt.Errorf("replicating pod %s from node %s: %v", member.Pod.Name, master, err)
+        }
+        replicas[master]++
+    }
+    return nil
+}
+
+// clusterModeReplicas returns the replica count of the StatefulSet of a
+// cluster in cluster mode. When the cluster shrinks, the pods being removed
+// are kept until their slots have moved to the remaining masters, and then
+// leave the cluster before the StatefulSet removes them.
+func clusterModeReplicas(ctx sdk.Context, namespace string, cluster *RedisCluster) (int32, error) {
+    desired := podCount(cluster.Spec)
+    members, err := getClusterMembers(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return 0, err
+    }
+    defer closeClusterMembers(members)
+
+    // Keep the pods up to the last one still serving slots
+    replicas := desired
+    for _, member := range members {
+        if int32(member.Ordinal) >= replicas && member.Node.Master && len(member.Node.Slots) > 0 {
+            replicas = int32(member.Ordinal) + 1
+        }
+    }
+    if replicas > desired {
+        return replicas, nil
+    }
+
+    // Take the pods being removed out of the cluster
+    err = detachClusterMembers(members, int(desired))
+    if err != nil {
+        return 0, err
+    }
+    return replicas, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+    "fmt"
+    "time"
+    batchv1 "k8s.io/api/batch/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+)
+
+// failover requests a failover of the cluster through a RedisOperation and
+// waits for the operator to run it.
+func failover(c *client, args []string, timeout time.Duration) error {
+    name := args[0]
+    _, err := getCluster(c, name)
+    if err != nil {
+        return err
+    }
+    spec := map[string]interface{}{
+        "clusterName": name,
+        "type":        "failover",
+    }
+    if len(args) > 1 {
+        spec["node"] = args[1]
+    }
+    operation := &unstructured.Unstructured{Object: map[string]interface{}{
+        "apiVersion": operationResource.GroupVersion().String(),
+        "kind":       "RedisOperation",
+        "metadata": map[string]interface{}{
+            "generateName": name + "-failover-",
+        },
+        "spec": spec,
+    }}
+    operation, err = c.dynamic.Resource(operationResource).Namespace(c.namespace).Create(operation, metav1.CreateOptions{})
+    if err != nil {
+        return err
+    }
+    fmt.Printf("redisoperation/%s created\n", operation.GetName())
+
+    // Wait for the operator to run the operation
+    deadline := time.Now().Add(timeout)
+    for time.Now().Before(deadline) {
+        time.Sleep(time.Second)
+        operation, err = c.dynamic.Resource(operationResource).Namespace(c.namespace).Get(operation.GetName(), metav1.GetOptions{})
+        if err != nil {
+            return err
+        }
+        status := &redisOperationStatus{}
+        object, _, _ := unstructured.NestedMap(operation.Object, "status")
+        err = runtime.DefaultUnstructuredConverter.FromUnstructured(object, status)
+        if err != nil {
+            return err
+        }
+        switch status.Phase {
+        case "Succeeded":
+            fmt.Println(status.Message)
+            return nil
+        case "Failed":
+            return fmt.Errorf("failover failed: %s", status.Message)
+        }
+    }
+    return fmt.Errorf("the operator did not run redisoperation/%s within %s", operation.GetName(), timeout)
+}
+
+// backup runs the backup of the cluster now, with a Job created from its
+// backup CronJob like kubectl create job --from does.
+func backup(c *client, args []string) error {
+    name := args[0]
+    cronJob, err := c.kube.BatchV1().CronJobs(c.namespace).Get(name+"-backup", metav1.GetOptions{})
+    if err != nil {
+        return fmt.Errorf("getting the backup CronJob of cluster %s, is spec.backup set? %v", name, err)
+    }
+    job := &batchv1.Job{
+        ObjectMeta: metav1.ObjectMeta{
+            GenerateName: cronJob.Name + "-manual-",
+            Labels:       cronJob.Spec.JobTemplate.Labels,
+            Annotations:  map[string]string{"cronjob.kubernetes.io/instantiate": "manual"},
+            OwnerReferences: []metav1.OwnerReference{
+                *metav1.NewControllerRef(cronJob, batchv1.SchemeGroupVersion.WithKind("CronJob")),
+            },
+        },
+        Spec: cronJob.Spec.JobTemplate.Spec,
+    }
+    job, err = c.kube.BatchV1().Jobs(c.namespace).Create(job)
+    if err != nil {
+        return err
+    }
+    fmt.Printf("job.batch/%s created\n", job.Name)
+    return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "text/tabwriter"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/fields"
+)
+
+// showEvents prints the events the operator recorded for a cluster, which
+// trace its decisions, and keeps printing the new ones with follow.
+func showEvents(c *client, args []string, follow bool) error {
+    name := args[0]
+    selector := fields.Set{
+        "involvedObject.kind": "RedisCluster",
+        "involvedObject.name": name,
+    }.AsSelector().String()
+    events, err := c.kube.CoreV1().Events(c.namespace).List(metav1.ListOptions{FieldSelector: selector})
+    if err != nil {
+        return err
+    }
+    sort.Slice(events.Items, func(i, j int) bool {
+        return eventTime(&events.Items[i]).Before(eventTime(&events.Items[j]))
+    })
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 3, ' ', 0)
+    fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tMESSAGE")
+    for i := range events.Items {
+        printEvent(w, &events.Items[i])
+    }
+    err = w.Flush()
+    if err != nil || !follow {
+        return err
+    }
+
+    // Print the new events as the operator records them
+    watcher, err := c.kube.CoreV1().Events(c.namespace).Watch(metav1.ListOptions{FieldSelector: selector, ResourceVersion: events.ResourceVersion})
+    if err != nil {
+        return err
+    }
+    defer watcher.Stop()
+    for event := range watcher.ResultChan() {
+        e, ok := event.Object.(*corev1.Event)
+        if !ok {
+            continue
+        }
+        printEvent(w, e)
+        err = w.Flush()
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// eventTime returns when an event last happened.
+func eventTime(event *corev1.Event) metav1.Time {
+    if !event.LastTimestamp.IsZero() {
+        return event.LastTimestamp
+    }
+    if !event.EventTime.IsZero() {
+        return metav1.Time{Time: event.EventTime.Time}
+    }
+    return event.CreationTimestamp
+}
+
+// printEvent prints an event as a row of the table.
+func printEvent(w *tabwriter.Writer, event *corev1.Event) {
+    fmt.Fprintf(w, "%s ago\t%s\t%s\t%s\n", age(eventTime(event)), event.Type, event.Reason, event.Message)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "text/tabwriter"
+    "time"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/duration"
+)
+
+// listClusters prints the clusters of the namespace, or of all namespaces,
+// with their phase, master and the number of healthy nodes.
+func listClusters(c *client, allNamespaces bool) error {
+    namespace := c.namespace
+    if allNamespaces {
+        namespace = ""
+    }
+    list, err := c.dynamic.Resource(clusterResource).Namespace(namespace).List(metav1.ListOptions{})
+    if err != nil {
+        return err
+    }
+    if len(list.Items) == 0 {
+        fmt.Fprintln(os.Stderr, "No RedisCluster found.")
+        return nil
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 3, ' ', 0)
+    if allNamespaces {
+        fmt.Fprint(w, "NAMESPACE\t")
+    }
+    fmt.Fprintln(w, "NAME\tMODE\tREADY\tHEALTHY\tPHASE\tMASTER\tAGE")
+    for i := range list.Items {
+        cluster, err := toCluster(&list.Items[i])
+        if err != nil {
+            return err
+        }
+        if allNamespaces {
+            fmt.Fprintf(w, "%s\t", cluster.Namespace)
+        }
+        fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d/%d\t%s\t%s\t%s\n", cluster.Name, orDefault(cluster.Spec.Mode, "standalone"), cluster.Status.ReadyReplicas, cluster.Status.Replicas, healthyNodes(cluster), len(cluster.Status.Nodes), orDefault(cluster.Status.Phase, "<unknown>"), orDefault(cluster.Status.MasterNode, "<none>"), age(cluster.CreationTimestamp))
+    }
+    return w.Flush()
+}
+
+// showNodes prints the role, replication and health of each node of a
+// cluster, as last checked by the operator.
+func showNodes(c *client, args []string) error {
+    cluster, err := getCluster(c, args[0])
+    if err != nil {
+        return err
+    }
+    replication := map[string]redisNodeStatus{}
+    for _, node := range cluster.Status.Replication {
+        replication[node.Name] = node
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 3, ' ', 0)
+    fmt.Fprintln(w, "NODE\tROLE\tADDRESS\tHEALTHY\tLINK\tREPLICAS\tLAG\tLAST SEEN\tMESSAGE")
+    for _, node := range cluster.Status.Nodes {
+        healthy := strconv.FormatBool(node.Healthy)
+        if node.Loading {
+            healthy = "loading"
+        }
+        link, replicas := "-", "-"
+        if status, ok := replication[node.Name]; ok {
+            link = orDefault(status.MasterLinkStatus, "-")
+            if status.Role == "master" {
+                replicas = strconv.Itoa(int(status.ConnectedSlaves))
+            }
+        }
+        lastSeen := "<never>"
+        if node.LastSeen != nil {
+            lastSeen = age(*node.LastSeen) + " ago"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%ds\t%s\t%s\n", node.Name, orDefault(node.Role, "-"), orDefault(node.Address, "-"), healthy, link, replicas, node.LagSeconds, lastSeen, node.Message)
+    }
+    return w.Flush()
+}
+
+// healthyNodes counts the healthy nodes of a cluster.
+func healthyNodes(cluster *redisCluster) int {
+    healthy := 0
+    for _, node := range cluster.Status.Nodes {
+        if node.Healthy {
+            healthy++
+        }
+    }
+    return healthy
+}
+
+// orDefault returns s, or fallback when s is empty.
+func orDefault(s, fallback string) string {
+    if s == "" {
+        return fallback
+    }
+    return s
+}
+
+// age renders the time elapsed since t the way kubectl does.
+func age(t metav1.Time) string {
+    if t.IsZero() {
+        return "<unknown>"
+    }
+    return duration.HumanDuration(time.Since(t.Time))
+}
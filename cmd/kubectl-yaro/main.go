@@ -0,0 +1,162 @@
+// kubectl-yaro administers the Redis clusters of the YARO operator as a
+// kubectl plugin. It reads the custom resources and the status the operator
+// maintains, and requests actions through them, without exec-ing into pods.
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/client-go/dynamic"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/clientcmd"
+)
+
+const usage = `kubectl yaro administers the Redis clusters of the YARO operator.
+
+Usage:
+  kubectl yaro list [-A]                  list the clusters with their phase, master and health
+  kubectl yaro nodes CLUSTER              show the role, replication and health of each node
+  kubectl yaro failover CLUSTER [NODE]    hand the master role over to a replica, NODE being
+                                          the master to fail over in cluster mode
+  kubectl yaro backup CLUSTER             run the backup of the cluster now
+  kubectl yaro events CLUSTER [-f]        show the decisions of the operator for the cluster
+
+Flags:
+`
+
+var (
+    // clusterResource and operationResource are the custom resources of the operator.
+    clusterResource   = schema.GroupVersionResource{Group: "yaro.io", Version: "v1alpha1", Resource: "redisclusters"}
+    operationResource = schema.GroupVersionResource{Group: "yaro.io", Version: "v1alpha1", Resource: "redisoperations"}
+)
+
+// client talks to the API server in the namespace selected by the flags.
+type client struct {
+    namespace string
+    dynamic   dynamic.Interface
+    kube      kubernetes.Interface
+}
+
+// options are the flags of the plugin.
+type options struct {
+    kubeconfig    string
+    context       string
+    namespace     string
+    allNamespaces bool
+    follow        bool
+    timeout       time.Duration
+}
+
+func main() {
+    opts := &options{}
+    flags := flag.NewFlagSet("kubectl-yaro", flag.ExitOnError)
+    flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "path to the kubeconfig file")
+    flags.StringVar(&opts.context, "context", "", "kubeconfig context to use")
+    flags.StringVar(&opts.namespace, "namespace", "", "namespace of the clusters")
+    flags.StringVar(&opts.namespace, "n", "", "namespace of the clusters (shorthand)")
+    flags.BoolVar(&opts.allNamespaces, "all-namespaces", false, "list the clusters of all namespaces")
+    flags.BoolVar(&opts.allNamespaces, "A", false, "list the clusters of all namespaces (shorthand)")
+    flags.BoolVar(&opts.follow, "follow", false, "keep printing the new decisions")
+    flags.BoolVar(&opts.follow, "f", false, "keep printing the new decisions (shorthand)")
+    flags.DurationVar(&opts.timeout, "timeout", 2*time.Minute, "how long to wait for a failover to complete")
+    flags.Usage = func() {
+        fmt.Fprint(os.Stderr, usage)
+        flags.PrintDefaults()
+    }
+
+    args := parseArgs(flags, os.Args[1:])
+    if len(args) == 0 {
+        flags.Usage()
+        os.Exit(2)
+    }
+
+    err := run(opts, args[0], args[1:])
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "error: %v\n", err)
+        os.Exit(1)
+    }
+}
+
+// parseArgs parses the flags wherever they sit among the arguments and
+// returns the other arguments, so that "events mycluster -f" works as
+// kubectl users expect.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+    positional := []string{}
+    for {
+        flags.Parse(args)
+        args = flags.Args()
+        if len(args) == 0 {
+            return positional
+        }
+        positional = append(positional, args[0])
+        args = args[1:]
+    }
+}
+
+// run runs a command of the plugin.
+func run(opts *options, command string, args []string) error {
+    c, err := newClient(opts)
+    if err != nil {
+        return err
+    }
+
+    switch command {
+    case "list":
+        expectArgs(args, 0, 0)
+        return listClusters(c, opts.allNamespaces)
+    case "nodes":
+        return showNodes(c, expectArgs(args, 1, 1))
+    case "failover":
+        return failover(c, expectArgs(args, 1, 2), opts.timeout)
+    case "backup":
+        return backup(c, expectArgs(args, 1, 1))
+    case "events":
+        return showEvents(c, expectArgs(args, 1, 1), opts.follow)
+    }
+    return fmt.Errorf("unknown command %q, run kubectl yaro -h for the commands", command)
+}
+
+// expectArgs exits with the usage unless there are between min and max
+// arguments.
+func expectArgs(args []string, min, max int) []string {
+    if len(args) < min || len(args) > max {
+        fmt.Fprintf(os.Stderr, "error: unexpected arguments %q\n", strings.Join(args, " "))
+        os.Exit(2)
+    }
+    return args
+}
+
+// newClient connects to the cluster of the kubeconfig, in the namespace of
+// the flags or of the kubeconfig context.
+func newClient(opts *options) (*client, error) {
+    rules := clientcmd.NewDefaultClientConfigLoadingRules()
+    rules.ExplicitPath = opts.kubeconfig
+    overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.context}
+    config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+    namespace := opts.namespace
+    if namespace == "" {
+        var err error
+        namespace, _, err = config.Namespace()
+        if err != nil {
+            return nil, err
+        }
+    }
+    restConfig, err := config.ClientConfig()
+    if err != nil {
+        return nil, err
+    }
+    dynamicClient, err := dynamic.NewForConfig(restConfig)
+    if err != nil {
+        return nil, err
+    }
+    kubeClient, err := kubernetes.NewForConfig(restConfig)
+    if err != nil {
+        return nil, err
+    }
+    return &client{namespace: namespace, dynamic: dynamicClient, kube: kubeClient}, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "fmt"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+)
+
+// redisCluster holds the fields of a RedisCluster the plugin shows. The
+// plugin reads the resources through the dynamic client, so that it keeps
+// working with operators adding fields it does not know.
+type redisCluster struct {
+    metav1.ObjectMeta `json:"metadata"`
+    Spec              struct {
+        Size int32  `json:"size"`
+        Mode string `json:"mode,omitempty"`
+    } `json:"spec"`
+    Status struct {
+        Phase         string             `json:"phase,omitempty"`
+        ReadyReplicas int32              `json:"readyReplicas"`
+        Replicas      int32              `json:"replicas"`
+        MasterNode    string             `json:"masterNode,omitempty"`
+        Nodes         []redisNodeHealth  `json:"nodes"`
+        Replication   []redisNodeStatus  `json:"replication,omitempty"`
+        Conditions    []metav1.Condition `json:"conditions,omitempty"`
+    } `json:"status,omitempty"`
+}
+
+// redisNodeHealth is the health of a node as checked by the operator.
+type redisNodeHealth struct {
+    Name       string       `json:"name"`
+    Role       string       `json:"role,omitempty"`
+    Address    string       `json:"address,omitempty"`
+    Healthy    bool         `json:"healthy"`
+    Loading    bool         `json:"loading,omitempty"`
+    LagSeconds int32        `json:"lagSeconds,omitempty"`
+    LastSeen   *metav1.Time `json:"lastSeen,omitempty"`
+    Message    string       `json:"message,omitempty"`
+}
+
+// redisNodeStatus is the replication state of a node.
+type redisNodeStatus struct {
+    Name             string `json:"name"`
+    Role             string `json:"role,omitempty"`
+    ConnectedSlaves  int32  `json:"connectedSlaves,omitempty"`
+    MasterLinkStatus string `json:"masterLinkStatus,omitempty"`
+}
+
+// redisOperationStatus is the outcome of a RedisOperation.
+type redisOperationStatus struct {
+    Phase   string `json:"phase,omitempty"`
+    Message string `json:"message,omitempty"`
+}
+
+// toCluster converts a RedisCluster read by the dynamic client.
+func toCluster(object *unstructured.Unstructured) (*redisCluster, error) {
+    cluster := &redisCluster{}
+    err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, cluster)
+    if err != nil {
+        return nil, fmt.Errorf("reading RedisCluster %s: %v", object.GetName(), err)
+    }
+    return cluster, nil
+}
+
+// getCluster reads a RedisCluster of the namespace.
+func getCluster(c *client, name string) (*redisCluster, error) {
+    object, err := c.dynamic.Resource(clusterResource).Namespace(c.namespace).Get(name, metav1.GetOptions{})
+    if err != nil {
+        return nil, err
+    }
+    return toCluster(object)
+}
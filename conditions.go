@@ -0,0 +1,108 @@
+package main
+
+import (
+    "fmt"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+    // PhasePending is the phase of a cluster that has not been ready yet.
+    PhasePending = "Pending"
+
+    // PhaseScaling is the phase of a cluster whose pod count differs from its size.
+    PhaseScaling = "Scaling"
+
+    // PhaseReady is the phase of a cluster whose pods are all ready.
+    PhaseReady = "Ready"
+
+    // PhaseDegraded is the phase of a cluster with pods that are not ready.
+    PhaseDegraded = "Degraded"
+
+    // PhaseHibernating is the phase of a hibernated cluster whose pods are
+    // being removed, after the snapshot of its data.
+    PhaseHibernating = "Hibernating"
+
+    // PhaseHibernated is the phase of a hibernated cluster without pods.
+    PhaseHibernated = "Hibernated"
+)
+
+const (
+    // ConditionReady is set when all the pods of the cluster are ready.
+    ConditionReady = "Ready"
+
+    // ConditionFailed is set when the RedisCluster keeps failing to reconcile.
+    ConditionFailed = "Failed"
+
+    // ConditionReplicaDisconnected is set when a replica lost its link to the master.
+    ConditionReplicaDisconnected = "ReplicaDisconnected"
+
+    // ConditionClockSkew is set when the clocks of the nodes drift apart.
+    ConditionClockSkew = "ClockSkew"
+
+    // ConditionFrequentFullResyncs is set when replicas keep doing full resyncs.
+    ConditionFrequentFullResyncs = "FrequentFullResyncs"
+
+    // ConditionWritesWillBeRejected is set when a noeviction node nears maxmemory.
+    ConditionWritesWillBeRejected = "WritesWillBeRejected"
+
+    // ConditionPaused is set while the reconciliation of the cluster is paused.
+    ConditionPaused = "Paused"
+
+    // ConditionModulesInconsistent is set when the nodes do not all load the
+    // modules of the spec.
+    ConditionModulesInconsistent = "ModulesInconsistent"
+
+    // ConditionHibernated is set while the cluster is scaled to zero on request.
+    ConditionHibernated = "Hibernated"
+)
+
+// setClusterCondition sets a condition on the status of the RedisCluster.
+func setClusterCondition(namespace, name string, condition metav1.Condition) error {
+    // Get the RedisCluster
+    cluster := &RedisCluster{}
+    err := sdk.Get(cluster, namespace, name)
+    if err != nil {
+        return err
+    }
+
+    // Update the condition, leaving the status untouched if nothing changed
+    if !meta.SetStatusCondition(&cluster.Status.Conditions, condition) {
+        return nil
+    }
+
+    return updateStatus(cluster)
+}
+
+// clusterPhase returns the phase of a cluster from its previous phase, its
+// desired size and its pod counts. A cluster stays Pending until it is ready
+// for the first time.
+func clusterPhase(previous string, size int32, pods, ready int) string {
+    switch {
+    case pods == int(size) && ready == int(size):
+        return PhaseReady
+    case previous == "" || previous == PhasePending:
+        return PhasePending
+    case pods != int(size):
+        return PhaseScaling
+    default:
+        return PhaseDegraded
+    }
+}
+
+// setPhase sets the phase of the cluster and the matching Ready condition.
+// The condition transition time only changes when readiness does.
+func setPhase(cluster *RedisCluster, phase string, ready int) {
+    cluster.Status.Phase = phase
+    condition := metav1.Condition{
+        Type:    ConditionReady,
+        Status:  metav1.ConditionFalse,
+        Reason:  phase,
+        Message: fmt.Sprintf("%d of %d pods are ready", ready, podCount(cluster.Spec)),
+    }
+    if phase == PhaseReady {
+        condition.Status = metav1.ConditionTrue
+    }
+    meta.SetStatusCondition(&cluster.Status.Conditions, condition)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "testing"
+    "time"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClusterPhase(t *testing.T) {
+    tests := []struct {
+        name     string
+        previous string
+        size     int32
+        pods     int
+        ready    int
+        want     string
+    }{
+        {"new cluster", "", 3, 0, 0, PhasePending},
+        {"starting", PhasePending, 3, 3, 1, PhasePending},
+        {"first ready", PhasePending, 3, 3, 3, PhaseReady},
+        {"ready", PhaseReady, 3, 3, 3, PhaseReady},
+        {"scaling up", PhaseReady, 5, 3, 3, PhaseScaling},
+        {"scaling down", PhaseReady, 3, 5, 5, PhaseScaling},
+        {"unready pod", PhaseReady, 3, 3, 2, PhaseDegraded},
+        {"recovered", PhaseDegraded, 3, 3, 3, PhaseReady},
+        {"scaled", PhaseScaling, 5, 5, 5, PhaseReady},
+    }
+    for _, test := range tests {
+        got := clusterPhase(test.previous, test.size, test.pods, test.ready)
+        if got != test.want {
+            t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+        }
+    }
+}
+
+func TestSetPhaseTransitions(t *testing.T) {
+    cluster := newTestCluster(3)
+
+    setPhase(cluster, PhasePending, 1)
+    condition := meta.FindStatusCondition(cluster.Status.Conditions, ConditionReady)
+    if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != PhasePending {
+        t.Fatalf("got condition %+v, want Ready False for Pending", condition)
+    }
+    if condition.Message != "1 of 3 pods are ready" {
+        t.Errorf("got message %q, want the ready pod count", condition.Message)
+    }
+
+    // Readiness turning true moves the transition time
+    past := metav1.NewTime(time.Now().Add(-time.Hour))
+    condition.LastTransitionTime = past
+    setPhase(cluster, PhaseReady, 3)
+    condition = meta.FindStatusCondition(cluster.Status.Conditions, ConditionReady)
+    if cluster.Status.Phase != PhaseReady || condition.Status != metav1.ConditionTrue {
+        t.Fatalf("got phase %s and condition %+v, want Ready True", cluster.Status.Phase, condition)
+    }
+    if condition.LastTransitionTime.Equal(&past) {
+        t.Error("the transition time did not change when the cluster became ready")
+    }
+
+    // Changing phase without changing readiness keeps it
+    setPhase(cluster, PhaseDegraded, 2)
+    condition = meta.FindStatusCondition(cluster.Status.Conditions, ConditionReady)
+    condition.LastTransitionTime = past
+    setPhase(cluster, PhaseScaling, 2)
+    condition = meta.FindStatusCondition(cluster.Status.Conditions, ConditionReady)
+    if condition.Reason != PhaseScaling {
+        t.Errorf("got reason %s, want %s", condition.Reason, PhaseScaling)
+    }
+    if !condition.LastTransitionTime.Equal(&past) {
+        t.Error("the transition time changed although the cluster stayed unready")
+    }
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+    "fmt"
+    "path"
+    "strconv"
+    "strings"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// dataVolumeName and dataMountPath identify the volume holding the Redis data.
+const (
+    dataVolumeName = "data"
+    dataMountPath  = "/data"
+)
+
+// minProtoMaxBulkLen is the smallest proto-max-bulk-len Redis accepts.
+const minProtoMaxBulkLen = 1024 * 1024
+
+// maxEvictionTenacity is the largest maxmemory-eviction-tenacity Redis accepts.
+const maxEvictionTenacity = 100
+
+// defaultReplTimeout is the Redis default repl-timeout, in seconds.
+const defaultReplTimeout = 60
+
+// minMaxMemorySamples and maxMaxMemorySamples bound maxmemory-samples.
+const (
+    minMaxMemorySamples = 1
+    maxMaxMemorySamples = 64
+)
+
+// coreDumpScript starts redis-server through the image entrypoint after lifting
+// the core file size limit.
+const coreDumpScript = `ulimit -c unlimited; exec docker-entrypoint.sh redis-server "$@"`
+
+// redisCommand returns the command of the redis container, or nil to use the
+// image entrypoint.
+func redisCommand(spec RedisClusterSpec) []string {
+    if spec.Debug != nil && spec.Debug.EnableCoreDumps {
+        return []string{"sh", "-c", coreDumpScript, "redis-server"}
+    }
+    if spec.ConfigMapRef != nil {
+        return []string{"redis-server"}
+    }
+    return nil
+}
+
+// redisArgs renders the Redis configuration of the spec as redis-server
+// arguments, after the config file when the spec mounts one. The includes
+// and the config of the spec come first, so that the directives the
+// operator manages override them.
+func redisArgs(spec RedisClusterSpec) []string {
+    args := []string{}
+    if spec.ConfigMapRef != nil {
+        args = append(args, configFilePath)
+    }
+    for _, name := range spec.ConfigIncludes {
+        args = append(args, "--include", configIncludePath(name))
+    }
+    if len(spec.Config) > 0 {
+        args = append(args, "--include", renderedConfigPath())
+    }
+    args = append(args, "--dir", workingDir(spec))
+    if spec.TLS != nil {
+        args = append(args, tlsArgs(spec)...)
+    } else if spec.Port != 0 {
+        args = append(args, "--port", strconv.Itoa(int(spec.Port)))
+    }
+    if passwordSecretRef(spec) != nil {
+        args = append(args, "--requirepass", "$("+redisPasswordEnv+")", "--masterauth", "$("+redisPasswordEnv+")")
+    }
+    if spec.Mode == ModeCluster {
+        args = append(args, clusterModeArgs(spec)...)
+    }
+    args = append(args, moduleArgs(spec)...)
+    if spec.ProtoMaxBulkLen != nil {
+        args = append(args, "--proto-max-bulk-len", strconv.FormatInt(spec.ProtoMaxBulkLen.Value(), 10))
+    }
+    if spec.ActiveRehashing != nil {
+        args = append(args, "--activerehashing", yesNo(*spec.ActiveRehashing))
+    }
+    if spec.NotifyKeyspaceEvents != "" {
+        args = append(args, "--notify-keyspace-events", spec.NotifyKeyspaceEvents)
+    }
+    args = append(args, persistenceArgs(spec)...)
+    args = append(args, maxMemoryArgs(spec)...)
+    if spec.MaxMemorySamples != 0 {
+        args = append(args, "--maxmemory-samples", strconv.Itoa(int(spec.MaxMemorySamples)))
+    }
+    if spec.LatencyMonitorThreshold != nil {
+        args = append(args, "--latency-monitor-threshold", strconv.Itoa(int(*spec.LatencyMonitorThreshold)))
+    }
+    if spec.Replica != nil && spec.Replica.PingPeriod != 0 {
+        args = append(args, "--repl-ping-replica-period", strconv.Itoa(int(spec.Replica.PingPeriod)))
+    }
+    if spec.CPUAffinity != nil {
+        for _, parameter := range cpuListParameters(spec.CPUAffinity) {
+            if parameter[1] != "" {
+                args = append(args, "--"+parameter[0], parameter[1])
+            }
+        }
+    }
+    if spec.Debug != nil && spec.Debug.EnableCoreDumps {
+        args = append(args, "--crash-log-enabled", "yes")
+    }
+    return args
+}
+
+// workingDir returns the Redis working directory of the spec.
+func workingDir(spec RedisClusterSpec) string {
+    if spec.WorkingDir == "" {
+        return dataMountPath
+    }
+    return path.Clean(spec.WorkingDir)
+}
+
+// yesNo renders a boolean the way redis.conf expects it.
+func yesNo(b bool) string {
+    if b {
+        return "yes"
+    }
+    return "no"
+}
+
+// validateRedisConfig checks the Redis configuration of the spec against the
+// values Redis accepts.
+func validateRedisConfig(spec RedisClusterSpec) error {
+    if spec.ProtoMaxBulkLen != nil && spec.ProtoMaxBulkLen.Value() < minProtoMaxBulkLen {
+        return fmt.Errorf("protoMaxBulkLen %s is below the 1Mi minimum accepted by Redis", spec.ProtoMaxBulkLen.String())
+    }
+    if spec.Port < 0 || spec.Port > 65535 {
+        return fmt.Errorf("port %d is not a valid port number", spec.Port)
+    }
+    dir := workingDir(spec)
+    if dir != dataMountPath && !strings.HasPrefix(dir, dataMountPath+"/") {
+        return fmt.Errorf("workingDir %s must be within the %s data volume", spec.WorkingDir, dataMountPath)
+    }
+    if spec.MaxMemorySamples != 0 && (spec.MaxMemorySamples < minMaxMemorySamples || spec.MaxMemorySamples > maxMaxMemorySamples) {
+        return fmt.Errorf("maxMemorySamples %d is out of range, it must be between %d and %d", spec.MaxMemorySamples, minMaxMemorySamples, maxMaxMemorySamples)
+    }
+    if tenacity := spec.MaxMemoryEvictionTenacity; tenacity != nil && (*tenacity < 0 || *tenacity > maxEvictionTenacity) {
+        return fmt.Errorf("maxMemoryEvictionTenacity %d is out of range, it must be between 0 and %d", *tenacity, maxEvictionTenacity)
+    }
+    if spec.LatencyMonitorThreshold != nil && *spec.LatencyMonitorThreshold < 0 {
+        return fmt.Errorf("latencyMonitorThreshold %d must not be negative", *spec.LatencyMonitorThreshold)
+    }
+    if spec.Replica != nil && spec.Replica.PingPeriod != 0 {
+        if spec.Replica.PingPeriod < 1 {
+            return fmt.Errorf("replica.pingPeriod must be at least 1 second")
+        }
+        if spec.Replica.PingPeriod >= defaultReplTimeout {
+            return fmt.Errorf("replica.pingPeriod %ds must be less than the %ds replication timeout", spec.Replica.PingPeriod, defaultReplTimeout)
+        }
+    }
+    if spec.CPUAffinity != nil {
+        for _, parameter := range cpuListParameters(spec.CPUAffinity) {
+            if parameter[1] == "" {
+                continue
+            }
+            err := validateCPUList(parameter[1])
+            if err != nil {
+                return fmt.Errorf("cpuAffinity %s: %v", parameter[0], err)
+            }
+        }
+    }
+    for _, flag := range spec.NotifyKeyspaceEvents {
+        if !strings.ContainsRune(keyspaceEventFlags, flag) {
+            return fmt.Errorf("notifyKeyspaceEvents contains invalid flag %q, accepted flags are %s", flag, keyspaceEventFlags)
+        }
+    }
+    return nil
+}
+
+// keyspaceEventFlags are the characters accepted by notify-keyspace-events.
+const keyspaceEventFlags = "KEg$lshzxetmdnA"
+
+// keyspaceEventAliasFlags are the classes enabled by the A alias.
+const keyspaceEventAliasFlags = "g$lshzxetd"
+
+// normalizeKeyspaceEvents expands and sorts notify-keyspace-events flags so
+// that equivalent values compare equal.
+func normalizeKeyspaceEvents(flags string) string {
+    flags = strings.Replace(flags, "A", keyspaceEventAliasFlags, -1)
+    normalized := ""
+    for _, flag := range keyspaceEventFlags {
+        if strings.ContainsRune(flags, flag) {
+            normalized += string(flag)
+        }
+    }
+    return normalized
+}
+
+// applyLiveConfig applies the Redis configuration that can be changed at
+// runtime to the ready pods of the cluster with CONFIG SET.
+func applyLiveConfig(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    // Get the pods for the cluster
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+
+        err = applyPodLiveConfig(pod, cluster.Spec)
+        if err != nil {
+            return fmt.Errorf("applying configuration to pod %s: %v", pod.Name, err)
+        }
+    }
+
+    return nil
+}
+
+// applyPodLiveConfig applies the runtime configuration to the Redis server of a pod.
+func applyPodLiveConfig(pod *corev1.Pod, spec RedisClusterSpec) error {
+    client := newRedisClient(pod)
+    defer client.Close()
+
+    // Update notify-keyspace-events if it is set and differs, leaving a
+    // value from the config file or the includes alone otherwise
+    if spec.NotifyKeyspaceEvents != "" {
+        current, err := configGet(client, "notify-keyspace-events")
+        if err != nil {
+            return err
+        }
+        if normalizeKeyspaceEvents(current) != normalizeKeyspaceEvents(spec.NotifyKeyspaceEvents) {
+            err = client.ConfigSet("notify-keyspace-events", spec.NotifyKeyspaceEvents).Err()
+            if err != nil {
+                return err
+            }
+        }
+    }
+
+    // Update maxmemory and maxmemory-policy if they are set, which resizes
+    // the cache without a restart
+    var err error
+    if spec.MaxMemory != nil {
+        err = configSet(client, "maxmemory", strconv.FormatInt(spec.MaxMemory.Value(), 10))
+        if err != nil {
+            return err
+        }
+    }
+    if spec.MaxMemoryPolicy != "" {
+        err = configSet(client, "maxmemory-policy", spec.MaxMemoryPolicy)
+        if err != nil {
+            return err
+        }
+    }
+
+    // Update the LFU settings if they are set
+    if spec.LFU != nil && spec.LFU.LogFactor != nil {
+        err = configSet(client, "lfu-log-factor", strconv.Itoa(int(*spec.LFU.LogFactor)))
+        if err != nil {
+            return err
+        }
+    }
+    if spec.LFU != nil && spec.LFU.DecayTime != nil {
+        err = configSet(client, "lfu-decay-time", strconv.Itoa(int(*spec.LFU.DecayTime)))
+        if err != nil {
+            return err
+        }
+    }
+
+    // Update proto-max-bulk-len if it is set
+    if spec.ProtoMaxBulkLen != nil {
+        err = configSet(client, "proto-max-bulk-len", strconv.FormatInt(spec.ProtoMaxBulkLen.Value(), 10))
+        if err != nil {
+            return err
+        }
+    }
+
+    // Update activerehashing if it is set
+    if spec.ActiveRehashing != nil {
+        err = configSet(client, "activerehashing", yesNo(*spec.ActiveRehashing))
+        if err != nil {
+            return err
+        }
+    }
+
+    // Update maxmemory-samples if it is set
+    if spec.MaxMemorySamples != 0 {
+        err = configSet(client, "maxmemory-samples", strconv.Itoa(int(spec.MaxMemorySamples)))
+        if err != nil {
+            return err
+        }
+    }
+
+    // Update the Redis 6.2 parameters if the server supports them
+    redis62, err := redisVersionAtLeast(client, 6, 2)
+    if err != nil {
+        return err
+    }
+    if redis62 {
+        if spec.MaxMemoryEvictionTenacity != nil {
+            err = configSet(client, "maxmemory-eviction-tenacity", strconv.Itoa(int(*spec.MaxMemoryEvictionTenacity)))
+            if err != nil {
+                return err
+            }
+        }
+        if spec.LazyFlush != nil {
+            err = configSet(client, "lazyfree-lazy-user-flush", yesNo(*spec.LazyFlush))
+            if err != nil {
+                return err
+            }
+        }
+    }
+
+    // Update latency-monitor-threshold if it is set
+    if spec.LatencyMonitorThreshold != nil {
+        err = configSet(client, "latency-monitor-threshold", strconv.Itoa(int(*spec.LatencyMonitorThreshold)))
+        if err != nil {
+            return err
+        }
+    }
+
+    // Update repl-ping-replica-period if it is set
+    if spec.Replica != nil && spec.Replica.PingPeriod != 0 {
+        err = configSet(client, "repl-ping-replica-period", strconv.Itoa(int(spec.Replica.PingPeriod)))
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// liveConfigParameters are the redis-server arguments applyPodLiveConfig
+// changes with CONFIG SET, so that changing them needs no restart.
+var liveConfigParameters = map[string]bool{
+    "notify-keyspace-events":      true,
+    "maxmemory":                   true,
+    "maxmemory-policy":            true,
+    "lfu-log-factor":              true,
+    "lfu-decay-time":              true,
+    "proto-max-bulk-len":          true,
+    "activerehashing":             true,
+    "maxmemory-samples":           true,
+    "maxmemory-eviction-tenacity": true,
+    "lazyfree-lazy-user-flush":    true,
+    "latency-monitor-threshold":   true,
+    "repl-ping-replica-period":    true,
+}
+
+// restartArgs returns the redis-server arguments that only take effect when
+// Redis restarts, leaving out the live config parameters and their values.
+func restartArgs(args []string) []string {
+    restart := []string{}
+    for i := 0; i < len(args); i++ {
+        if strings.HasPrefix(args[i], "--") && liveConfigParameters[strings.TrimPrefix(args[i], "--")] && i+1 < len(args) {
+            i++
+            continue
+        }
+        restart = append(restart, args[i])
+    }
+    return restart
+}
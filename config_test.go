@@ -0,0 +1,89 @@
+package main
+
+import (
+    "testing"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestValidateRedisConfig(t *testing.T) {
+    quantity := func(value string) *resource.Quantity {
+        q := resource.MustParse(value)
+        return &q
+    }
+    tests := []struct {
+        name  string
+        spec  RedisClusterSpec
+        valid bool
+    }{
+        {"empty", RedisClusterSpec{}, true},
+        {"proto-max-bulk-len at the minimum", RedisClusterSpec{ProtoMaxBulkLen: quantity("1Mi")}, true},
+        {"proto-max-bulk-len below the minimum", RedisClusterSpec{ProtoMaxBulkLen: quantity("512Ki")}, false},
+        {"proto-max-bulk-len of 512Mi", RedisClusterSpec{ProtoMaxBulkLen: quantity("512Mi")}, true},
+        {"negative port", RedisClusterSpec{Port: -1}, false},
+        {"port out of range", RedisClusterSpec{Port: 65536}, false},
+        {"working dir in the data volume", RedisClusterSpec{WorkingDir: "/data/redis"}, true},
+        {"working dir out of the data volume", RedisClusterSpec{WorkingDir: "/tmp"}, false},
+        {"working dir escaping the data volume", RedisClusterSpec{WorkingDir: "/data/../etc"}, false},
+        {"maxmemory-samples out of range", RedisClusterSpec{MaxMemorySamples: 65}, false},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            err := validateRedisConfig(test.spec)
+            if test.valid && err != nil {
+                t.Errorf("got %v, want no error", err)
+            }
+            if !test.valid && err == nil {
+                t.Error("got no error, want the config rejected")
+            }
+        })
+    }
+}
+
+func TestNormalizeKeyspaceEvents(t *testing.T) {
+    tests := []struct {
+        flags string
+        want  string
+    }{
+        {"", ""},
+        {"KEA", "KEg$lshzxetd"},
+        {"xE", "Ex"},
+        {"AK", "Kg$lshzxetd"},
+        {"Kg$lshzxetdA", "Kg$lshzxetd"},
+        {"Em", "Em"},
+    }
+    for _, test := range tests {
+        got := normalizeKeyspaceEvents(test.flags)
+        if got != test.want {
+            t.Errorf("normalizeKeyspaceEvents(%q) = %q, want %q", test.flags, got, test.want)
+        }
+    }
+}
+
+func TestValidateKeyspaceEvents(t *testing.T) {
+    for _, flags := range []string{"KEA", "Ex", "Kgm", "KEn"} {
+        err := validateRedisConfig(RedisClusterSpec{NotifyKeyspaceEvents: flags})
+        if err != nil {
+            t.Errorf("flags %q: got %v, want no error", flags, err)
+        }
+    }
+    for _, flags := range []string{"KEQ", "ke", "E "} {
+        err := validateRedisConfig(RedisClusterSpec{NotifyKeyspaceEvents: flags})
+        if err == nil {
+            t.Errorf("flags %q: got no error, want them rejected", flags)
+        }
+    }
+}
+
+func TestRestartArgs(t *testing.T) {
+    args := []string{"--dir", "/data", "--proto-max-bulk-len", "1048576", "--maxmemory", "100", "--port", "6380"}
+    got := restartArgs(args)
+    want := []string{"--dir", "/data", "--port", "6380"}
+    if len(got) != len(want) {
+        t.Fatalf("got %v, want %v", got, want)
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Fatalf("got %v, want %v", got, want)
+        }
+    }
+}
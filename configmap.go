@@ -0,0 +1,159 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "path"
+    "regexp"
+    "sort"
+    "strings"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+    // configChecksumAnnotation is the pod template annotation holding the
+    // checksum of the rendered config, so that config changes roll the pods.
+    configChecksumAnnotation = "yaro.io/config-checksum"
+
+    // renderedConfigVolumeName is the name of the rendered config volume.
+    renderedConfigVolumeName = "config-rendered"
+
+    // renderedConfigDir is where the rendered config ConfigMap is mounted.
+    renderedConfigDir = "/usr/local/etc/redis/rendered"
+)
+
+// configKeyPattern matches the redis.conf directives accepted in the spec.
+var configKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// forbiddenConfigKeys are the directives the operator manages or that would
+// break the pods: networking, persistence location, authentication,
+// replication, cluster mode and process management.
+var forbiddenConfigKeys = map[string]bool{
+    "bind":                true,
+    "port":                true,
+    "tls-port":            true,
+    "unixsocket":          true,
+    "dir":                 true,
+    "include":             true,
+    "requirepass":         true,
+    "masterauth":          true,
+    "masteruser":          true,
+    "aclfile":             true,
+    "user":                true,
+    "rename-command":      true,
+    "replicaof":           true,
+    "slaveof":             true,
+    "cluster-enabled":     true,
+    "cluster-config-file": true,
+    "daemonize":           true,
+    "supervised":          true,
+    "pidfile":             true,
+    "logfile":             true,
+}
+
+// configMapName returns the name of the ConfigMap holding the rendered config.
+func configMapName(cluster *RedisCluster) string {
+    return cluster.ObjectMeta.Name + "-config"
+}
+
+// renderConfig renders the config of the spec as redis.conf, one directive
+// per line in key order so that the output only changes with the config.
+func renderConfig(spec RedisClusterSpec) string {
+    keys := []string{}
+    for key := range spec.Config {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    config := ""
+    for _, key := range keys {
+        config += key + " " + spec.Config[key] + "\n"
+    }
+    return config
+}
+
+// configChecksum returns the checksum of the rendered config, or an empty
+// string if the spec has no config.
+func configChecksum(spec RedisClusterSpec) string {
+    if len(spec.Config) == 0 {
+        return ""
+    }
+    sum := sha256.Sum256([]byte(renderConfig(spec)))
+    return hex.EncodeToString(sum[:])
+}
+
+// validateConfig checks the config of the spec for malformed and forbidden directives.
+func validateConfig(spec RedisClusterSpec) error {
+    for key, value := range spec.Config {
+        if !configKeyPattern.MatchString(key) {
+            return fmt.Errorf("config key %q is not a redis.conf directive", key)
+        }
+        if forbiddenConfigKeys[key] || strings.HasPrefix(key, "tls-") {
+            return fmt.Errorf("config key %s is managed by the operator and cannot be set", key)
+        }
+        if strings.ContainsAny(value, "\r\n") {
+            return fmt.Errorf("config value of %s must fit on a single line", key)
+        }
+    }
+    return nil
+}
+
+// newConfigMap builds the ConfigMap holding the rendered config of the cluster.
+func newConfigMap(cluster *RedisCluster, namespace string) *corev1.ConfigMap {
+    name := cluster.ObjectMeta.Name
+    return &corev1.ConfigMap{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            configMapName(cluster),
+            Namespace:       namespace,
+            Labels:          map[string]string{"app": name, "controller": name},
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Data: map[string]string{
+            configIncludeKey: renderConfig(cluster.Spec),
+        },
+    }
+}
+
+// reconcileConfigMap creates or updates the ConfigMap of the rendered
+// config, or deletes it when the spec has no config.
+func reconcileConfigMap(cluster *RedisCluster, namespace string) error {
+    if len(cluster.Spec.Config) == 0 {
+        return deleteIfExists(&corev1.ConfigMap{}, namespace, configMapName(cluster))
+    }
+
+    configMap := newConfigMap(cluster, namespace)
+    existing := &corev1.ConfigMap{}
+    _, err := createOrUpdate(configMap, existing, func() bool {
+        if existing.Data[configIncludeKey] == configMap.Data[configIncludeKey] {
+            return false
+        }
+        existing.Data = configMap.Data
+        return true
+    })
+    return err
+}
+
+// renderedConfigPath returns the path of the rendered config file.
+func renderedConfigPath() string {
+    return path.Join(renderedConfigDir, configIncludeKey)
+}
+
+// renderedConfigVolume returns the volume and mount of the rendered config.
+func renderedConfigVolume(cluster *RedisCluster) (corev1.Volume, corev1.VolumeMount) {
+    volume := corev1.Volume{
+        Name: renderedConfigVolumeName,
+        VolumeSource: corev1.VolumeSource{
+            ConfigMap: &corev1.ConfigMapVolumeSource{
+                LocalObjectReference: corev1.LocalObjectReference{Name: configMapName(cluster)},
+            },
+        },
+    }
+    mount := corev1.VolumeMount{
+        Name:      renderedConfigVolumeName,
+        MountPath: renderedConfigDir,
+        ReadOnly:  true,
+    }
+    return volume, mount
+}
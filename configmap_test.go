@@ -0,0 +1,54 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestRenderConfig(t *testing.T) {
+    spec := RedisClusterSpec{Config: map[string]string{
+        "timeout":                "300",
+        "hz":                     "20",
+        "lazyfree-lazy-eviction": "yes",
+    }}
+    want := "hz 20\nlazyfree-lazy-eviction yes\ntimeout 300\n"
+    if got := renderConfig(spec); got != want {
+        t.Errorf("got %q, want %q", got, want)
+    }
+    if configChecksum(spec) == "" {
+        t.Error("got an empty checksum for a config")
+    }
+    if configChecksum(spec) != configChecksum(RedisClusterSpec{Config: map[string]string{"hz": "20", "timeout": "300", "lazyfree-lazy-eviction": "yes"}}) {
+        t.Error("the checksum of the same config changed")
+    }
+    if configChecksum(RedisClusterSpec{}) != "" {
+        t.Errorf("got checksum %q without a config, want none", configChecksum(RedisClusterSpec{}))
+    }
+}
+
+func TestValidateConfig(t *testing.T) {
+    tests := []struct {
+        name  string
+        key   string
+        value string
+        valid bool
+    }{
+        {"tunable directive", "hz", "20", true},
+        {"uppercase key", "Timeout", "300", false},
+        {"key with a space", "timeout 0\nport", "6380", false},
+        {"managed directive", "requirepass", "secret", false},
+        {"replication directive", "replicaof", "evil 6379", false},
+        {"tls directive", "tls-cert-file", "/tmp/cert", false},
+        {"multiline value", "timeout", "300\nrequirepass secret", false},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            err := validateConfig(RedisClusterSpec{Config: map[string]string{test.key: test.value}})
+            if test.valid && err != nil {
+                t.Errorf("got %v, want no error", err)
+            }
+            if !test.valid && err == nil {
+                t.Error("got no error, want the config rejected")
+            }
+        })
+    }
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+    "fmt"
+    "time"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+    // cordonAnnotation requests the client Service to stop routing new
+    // connections for the given duration.
+    cordonAnnotation = "yaro.io/cordon"
+
+    // cordonedSelectorLabel is added to the selector of the client Service of
+    // a cordoned cluster. No pod carries it, so the Service has no endpoints.
+    cordonedSelectorLabel = "yaro.io/cordoned"
+
+    // maxCordon bounds how long a cluster can be cordoned for.
+    maxCordon = 24 * time.Hour
+)
+
+// reconcileCordon tracks the cordon requested through the cordon annotation
+// and reports whether the cluster is cordoned. The cordon is lifted once it
+// expires or the annotation is removed.
+func reconcileCordon(namespace string, cluster *RedisCluster) (bool, error) {
+    value, requested := cluster.ObjectMeta.Annotations[cordonAnnotation]
+    cordonedUntil := cluster.Status.CordonedUntil
+    if !requested && cordonedUntil == nil {
+        return false, nil
+    }
+    if requested && cordonedUntil != nil && time.Now().Before(cordonedUntil.Time) {
+        return true, nil
+    }
+
+    // Get the RedisCluster
+    current := &RedisCluster{}
+    err := sdk.Get(current, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return false, err
+    }
+
+    cordoned := false
+    if requested && cordonedUntil == nil {
+        // Cordon the cluster for the requested duration
+        duration, err := time.ParseDuration(value)
+        if err != nil || duration <= 0 || duration > maxCordon {
+            return false, fmt.Errorf("invalid %s annotation %q, it must be a duration of at most %s", cordonAnnotation, value, maxCordon)
+        }
+        until := metav1.NewTime(time.Now().Add(duration))
+        current.Status.CordonedUntil = &until
+        cordoned = true
+    } else {
+        // Lift the cordon once it expired or was cancelled
+        delete(current.ObjectMeta.Annotations, cordonAnnotation)
+        current.Status.CordonedUntil = nil
+    }
+
+    // The status subresource ignores the annotation, which is removed once
+    // the status is written
+    err = updateStatus(current)
+    if err != nil {
+        return false, err
+    }
+    if !cordoned {
+        err = sdk.Update(current)
+        if err != nil {
+            return false, err
+        }
+    }
+    return cordoned, nil
+}
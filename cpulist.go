@@ -0,0 +1,44 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// cpuListParameters maps the CPU affinity lists to their Redis parameters.
+func cpuListParameters(affinity *RedisCPUAffinity) [][2]string {
+    return [][2]string{
+        {"server_cpulist", affinity.ServerCPUList},
+        {"bio_cpulist", affinity.BioCPUList},
+        {"aof_rewrite_cpulist", affinity.AOFRewriteCPUList},
+        {"bgsave_cpulist", affinity.BGSaveCPUList},
+    }
+}
+
+// validateCPUList checks a Redis CPU list, e.g. "0-3", "0,2,4" or "0-7:2".
+func validateCPUList(list string) error {
+    for _, item := range strings.Split(list, ",") {
+        rangePart := item
+        if i := strings.Index(item, ":"); i >= 0 {
+            step, err := strconv.Atoi(item[i+1:])
+            if err != nil || step < 1 {
+                return fmt.Errorf("invalid step in CPU list item %q", item)
+            }
+            rangePart = item[:i]
+        }
+
+        bounds := strings.SplitN(rangePart, "-", 2)
+        first, err := strconv.Atoi(bounds[0])
+        if err != nil || first < 0 {
+            return fmt.Errorf("invalid CPU in CPU list item %q", item)
+        }
+        if len(bounds) == 2 {
+            last, err := strconv.Atoi(bounds[1])
+            if err != nil || last < first {
+                return fmt.Errorf("invalid CPU range in CPU list item %q", item)
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestValidateCPUList(t *testing.T) {
+    tests := []struct {
+        list  string
+        valid bool
+    }{
+        {"0", true},
+        {"0-3", true},
+        {"0,2,4", true},
+        {"0-7:2", true},
+        {"0-3,8-11", true},
+        {"", false},
+        {"a", false},
+        {"-1", false},
+        {"3-1", false},
+        {"0-", false},
+        {"0-7:0", false},
+        {"0-7:x", false},
+        {"0,,2", false},
+    }
+    for _, test := range tests {
+        err := validateCPUList(test.list)
+        if test.valid && err != nil {
+            t.Errorf("validateCPUList(%q) = %v, want no error", test.list, err)
+        }
+        if !test.valid && err == nil {
+            t.Errorf("validateCPUList(%q) = nil, want an error", test.list)
+        }
+    }
+}
+
+func TestValidateRedisConfigCPUAffinity(t *testing.T) {
+    spec := RedisClusterSpec{CPUAffinity: &RedisCPUAffinity{ServerCPUList: "0-3", BGSaveCPUList: "4-"}}
+    err := validateRedisConfig(spec)
+    if err == nil {
+        t.Fatal("got no error, want the bgsave CPU list rejected")
+    }
+    spec.CPUAffinity.BGSaveCPUList = ""
+    err = validateRedisConfig(spec)
+    if err != nil {
+        t.Errorf("got %v, want the unset lists skipped", err)
+    }
+}
+
+func TestCPUAffinityChangeRollsPods(t *testing.T) {
+    cluster := newTestCluster(3)
+    cluster.Spec.CPUAffinity = &RedisCPUAffinity{ServerCPUList: "0-3"}
+    existing := newPodTemplate(cluster, map[string]string{"controller": cluster.ObjectMeta.Name})
+
+    cluster.Spec.CPUAffinity.ServerCPUList = "0-1"
+    cluster.Spec.CPUAffinity.BGSaveCPUList = "2-3"
+    if !updatePodTemplate(&existing, newPodTemplate(cluster, map[string]string{"controller": cluster.ObjectMeta.Name})) {
+        t.Fatal("got the template unchanged, want the pods rolled to the new CPU lists")
+    }
+    args := existing.Spec.Containers[0].Args
+    if argValue(args, "--server_cpulist") != "0-1" || argValue(args, "--bgsave_cpulist") != "2-3" {
+        t.Errorf("got args %v, want the new CPU lists", args)
+    }
+}
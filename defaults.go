@@ -0,0 +1,79 @@
+package main
+
+import (
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+    // defaultRedisVersion is the version recorded for a spec setting neither
+    // an image nor a version, the tag of defaultRedisImage.
+    defaultRedisVersion = "latest"
+
+    // defaultCPURequest and defaultMemoryRequest are requested for the redis
+    // container when the spec requests no resources, so the pods are not
+    // scheduled as best effort.
+    defaultCPURequest    = "100m"
+    defaultMemoryRequest = "128Mi"
+)
+
+// setDefaults fills in the fields the spec leaves unset with the values the
+// operator would use for them, and reports whether it changed the spec. The
+// image tag is defaulted through the version, which can then be changed to
+// upgrade the cluster.
+func setDefaults(spec *RedisClusterSpec) bool {
+    changed := false
+    if spec.Mode == "" {
+        spec.Mode = ModeStandalone
+        changed = true
+    }
+    if spec.Port == 0 {
+        spec.Port = redisPort
+        changed = true
+    }
+    if spec.Image == "" && spec.Version == "" {
+        spec.Version = defaultRedisVersion
+        changed = true
+    }
+    if len(spec.Resources.Requests) == 0 && len(spec.Resources.Limits) == 0 {
+        spec.Resources.Requests = corev1.ResourceList{
+            corev1.ResourceCPU:    resource.MustParse(defaultCPURequest),
+            corev1.ResourceMemory: resource.MustParse(defaultMemoryRequest),
+        }
+        changed = true
+    }
+    if spec.Mode == ModeSentinel {
+        if spec.Sentinel == nil {
+            spec.Sentinel = &RedisSentinelSpec{}
+        }
+        if spec.Sentinel.Replicas == 0 {
+            spec.Sentinel.Replicas = defaultSentinelReplicas
+            changed = true
+        }
+    }
+    if spec.Storage != nil {
+        if len(spec.Storage.AccessModes) == 0 {
+            spec.Storage.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+            changed = true
+        }
+        if spec.Storage.RetentionPolicy == "" {
+            spec.Storage.RetentionPolicy = RetentionPolicyRetain
+            changed = true
+        }
+        if spec.Storage.ScaleDownPolicy == "" {
+            spec.Storage.ScaleDownPolicy = RetentionPolicyRetain
+            changed = true
+        }
+    }
+    return changed
+}
+
+// applyDefaults records the defaults of the spec in the RedisCluster, so that
+// the spec reads as the cluster runs and later comparisons see the same values.
+func applyDefaults(cluster *RedisCluster) error {
+    if !setDefaults(&cluster.Spec) {
+        return nil
+    }
+    return sdk.Update(cluster)
+}
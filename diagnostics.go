@@ -0,0 +1,252 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "github.com/go-redis/redis"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+    // defaultDiagnosticsInterval is how often the slow log and the latency
+    // events are collected when the spec does not say.
+    defaultDiagnosticsInterval = time.Minute
+
+    // defaultDiagnosticsTop is how many slow commands and latency events the
+    // status lists when the spec does not say.
+    defaultDiagnosticsTop = 5
+
+    // slowlogEntries is how many of the latest slow log entries are read
+    // from each node.
+    slowlogEntries = 128
+)
+
+var (
+    // slowlogCursorsMu guards slowlogCursors.
+    slowlogCursorsMu sync.Mutex
+
+    // slowlogCursors are the IDs of the latest slow log entries counted in
+    // the metrics, by pod.
+    slowlogCursors = map[types.NamespacedName]int64{}
+)
+
+// diagnosticsEnabled reports whether the spec collects the slow log and the
+// latency events.
+func diagnosticsEnabled(spec RedisClusterSpec) bool {
+    return spec.Diagnostics != nil && spec.Diagnostics.Enabled
+}
+
+// diagnosticsInterval returns how often the diagnostics are collected.
+func diagnosticsInterval(spec RedisClusterSpec) time.Duration {
+    if spec.Diagnostics.IntervalSeconds > 0 {
+        return time.Duration(spec.Diagnostics.IntervalSeconds) * time.Second
+    }
+    return defaultDiagnosticsInterval
+}
+
+// diagnosticsTop returns how many offenders the status lists.
+func diagnosticsTop(spec RedisClusterSpec) int {
+    if spec.Diagnostics.Top > 0 {
+        return int(spec.Diagnostics.Top)
+    }
+    return defaultDiagnosticsTop
+}
+
+// validateDiagnostics checks the diagnostics settings of the spec.
+func validateDiagnostics(spec RedisClusterSpec) error {
+    diagnostics := spec.Diagnostics
+    if diagnostics == nil {
+        return nil
+    }
+    if diagnostics.IntervalSeconds < 0 {
+        return fmt.Errorf("diagnostics intervalSeconds %d must not be negative", diagnostics.IntervalSeconds)
+    }
+    if diagnostics.Top < 0 {
+        return fmt.Errorf("diagnostics top %d must not be negative", diagnostics.Top)
+    }
+    return nil
+}
+
+// collectDiagnostics reads the slow log and the latency history of the
+// ready nodes once per interval. New slow log entries are counted in the
+// metrics and the worst slow commands and latency events are recorded in
+// the status. Only the command names are recorded, not their arguments,
+// which may hold keys and values.
+func collectDiagnostics(namespace string, cluster *RedisCluster, pods []corev1.Pod) error {
+    if !diagnosticsEnabled(cluster.Spec) {
+        cluster.Status.Diagnostics = nil
+        return nil
+    }
+    if last := cluster.Status.Diagnostics; last != nil && last.CollectedAt != nil && time.Since(last.CollectedAt.Time) < diagnosticsInterval(cluster.Spec) {
+        return nil
+    }
+
+    slowCommands := []RedisSlowCommand{}
+    latencyEvents := []RedisLatencyEvent{}
+    for i := range pods {
+        pod := &pods[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        commands, events, err := getNodeDiagnostics(pod)
+        if err != nil {
+            return fmt.Errorf("collecting the diagnostics of pod %s: %v", pod.Name, err)
+        }
+        observeSlowCommands(namespace, cluster.ObjectMeta.Name, pod, commands)
+        for _, event := range events {
+            latencySpikeMilliseconds.WithLabelValues(namespace, cluster.ObjectMeta.Name, pod.Name, event.Event).Set(float64(event.LatestMilliseconds))
+        }
+        slowCommands = append(slowCommands, commands...)
+        latencyEvents = append(latencyEvents, events...)
+    }
+
+    // Keep the worst offenders
+    top := diagnosticsTop(cluster.Spec)
+    sort.Slice(slowCommands, func(i, j int) bool { return slowCommands[i].DurationMicroseconds > slowCommands[j].DurationMicroseconds })
+    if len(slowCommands) > top {
+        slowCommands = slowCommands[:top]
+    }
+    sort.Slice(latencyEvents, func(i, j int) bool { return latencyEvents[i].MaxMilliseconds > latencyEvents[j].MaxMilliseconds })
+    if len(latencyEvents) > top {
+        latencyEvents = latencyEvents[:top]
+    }
+
+    now := metav1.Now()
+    cluster.Status.Diagnostics = &RedisDiagnosticsStatus{
+        CollectedAt:   &now,
+        SlowCommands:  slowCommands,
+        LatencyEvents: latencyEvents,
+    }
+    return nil
+}
+
+// getNodeDiagnostics reads the slow log and the latency events of a node.
+func getNodeDiagnostics(pod *corev1.Pod) ([]RedisSlowCommand, []RedisLatencyEvent, error) {
+    client := newRedisClient(pod)
+    defer client.Close()
+
+    commands, err := getSlowCommands(client, pod.Name)
+    if err != nil {
+        return nil, nil, err
+    }
+    events, err := getLatencyEvents(client, pod.Name)
+    if err != nil {
+        return nil, nil, err
+    }
+    return commands, events, nil
+}
+
+// getSlowCommands reads the latest slow log entries of a node.
+func getSlowCommands(client *redis.Client, node string) ([]RedisSlowCommand, error) {
+    result, err := client.Do("slowlog", "get", slowlogEntries).Result()
+    if err != nil {
+        return nil, err
+    }
+    entries, _ := result.([]interface{})
+    commands := []RedisSlowCommand{}
+    for _, e := range entries {
+        entry, ok := e.([]interface{})
+        if !ok || len(entry) < 4 {
+            continue
+        }
+        id, _ := entry[0].(int64)
+        timestamp, _ := entry[1].(int64)
+        duration, _ := entry[2].(int64)
+        args, _ := entry[3].([]interface{})
+        name := ""
+        if len(args) > 0 {
+            name, _ = args[0].(string)
+        }
+        commands = append(commands, RedisSlowCommand{
+            Node:                 node,
+            ID:                   id,
+            Command:              strings.ToLower(name),
+            DurationMicroseconds: duration,
+            Time:                 metav1.NewTime(time.Unix(timestamp, 0)),
+        })
+    }
+    return commands, nil
+}
+
+// observeSlowCommands counts the slow log entries of a pod not counted yet.
+// A restarted pod numbers its entries from zero again, which resets the
+// cursor.
+func observeSlowCommands(namespace, cluster string, pod *corev1.Pod, commands []RedisSlowCommand) {
+    key := types.NamespacedName{Namespace: namespace, Name: pod.Name}
+    slowlogCursorsMu.Lock()
+    defer slowlogCursorsMu.Unlock()
+
+    cursor, seen := slowlogCursors[key]
+    latest := int64(-1)
+    for _, command := range commands {
+        if command.ID > latest {
+            latest = command.ID
+        }
+    }
+    if latest < cursor {
+        cursor, seen = -1, true
+    }
+    for _, command := range commands {
+        if seen && command.ID > cursor {
+            slowCommandsTotal.WithLabelValues(namespace, cluster, command.Command).Inc()
+            slowCommandDuration.WithLabelValues(namespace, cluster).Observe(float64(command.DurationMicroseconds) / 1e6)
+        }
+    }
+    if latest >= 0 {
+        slowlogCursors[key] = latest
+    }
+}
+
+// getLatencyEvents reads the latency events of a node from LATENCY LATEST
+// and their history from LATENCY HISTORY.
+func getLatencyEvents(client *redis.Client, node string) ([]RedisLatencyEvent, error) {
+    result, err := client.Do("latency", "latest").Result()
+    if err != nil {
+        return nil, err
+    }
+    latest, _ := result.([]interface{})
+    events := []RedisLatencyEvent{}
+    for _, l := range latest {
+        entry, ok := l.([]interface{})
+        if !ok || len(entry) < 4 {
+            continue
+        }
+        name, _ := entry[0].(string)
+        timestamp, _ := entry[1].(int64)
+        latestMilliseconds, _ := entry[2].(int64)
+        maxMilliseconds, _ := entry[3].(int64)
+
+        // Count the spikes still in the history of the event
+        result, err = client.Do("latency", "history", name).Result()
+        if err != nil {
+            return nil, err
+        }
+        history, _ := result.([]interface{})
+        events = append(events, RedisLatencyEvent{
+            Node:               node,
+            Event:              name,
+            LatestMilliseconds: latestMilliseconds,
+            MaxMilliseconds:    maxMilliseconds,
+            Spikes:             int32(len(history)),
+            Time:               metav1.NewTime(time.Unix(timestamp, 0)),
+        })
+    }
+    return events, nil
+}
+
+// deleteDiagnostics forgets the slow log cursors of the pods of a deleted
+// cluster.
+func deleteDiagnostics(namespace, name string) {
+    slowlogCursorsMu.Lock()
+    for key := range slowlogCursors {
+        if key.Namespace == namespace && strings.HasPrefix(key.Name, name+"-") {
+            delete(slowlogCursors, key)
+        }
+    }
+    slowlogCursorsMu.Unlock()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "reflect"
+    policyv1 "k8s.io/api/policy/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// newPodDisruptionBudget builds the PodDisruptionBudget letting voluntary
+// disruptions, such as node drains, evict one Redis pod of the cluster at a
+// time, so a master and its replicas never go down together.
+func newPodDisruptionBudget(cluster *RedisCluster, namespace string) *policyv1.PodDisruptionBudget {
+    name := cluster.ObjectMeta.Name
+    labels := map[string]string{"app": name, "controller": name}
+    maxUnavailable := intstr.FromInt(1)
+    return &policyv1.PodDisruptionBudget{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: policyv1.PodDisruptionBudgetSpec{
+            MaxUnavailable: &maxUnavailable,
+            Selector: &metav1.LabelSelector{
+                MatchLabels: labels,
+            },
+        },
+    }
+}
+
+// newSentinelPodDisruptionBudget builds the PodDisruptionBudget keeping a
+// majority of the sentinels up, which they need to agree on a failover.
+func newSentinelPodDisruptionBudget(cluster *RedisCluster, namespace string) *policyv1.PodDisruptionBudget {
+    name := sentinelName(cluster)
+    labels := map[string]string{"app": name, "controller": cluster.ObjectMeta.Name}
+    minAvailable := intstr.FromInt(quorum(sentinelReplicas(cluster.Spec)))
+    return &policyv1.PodDisruptionBudget{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: policyv1.PodDisruptionBudgetSpec{
+            MinAvailable: &minAvailable,
+            Selector: &metav1.LabelSelector{
+                MatchLabels: labels,
+            },
+        },
+    }
+}
+
+// reconcilePodDisruptionBudgets makes sure the PodDisruptionBudgets of the
+// Redis pods and, in sentinel mode, of the sentinels exist and match the
+// spec. The sentinel one is removed when the cluster leaves sentinel mode.
+func reconcilePodDisruptionBudgets(cluster *RedisCluster, namespace string) error {
+    budgets := []*policyv1.PodDisruptionBudget{newPodDisruptionBudget(cluster, namespace)}
+    if cluster.Spec.Mode == ModeSentinel {
+        budgets = append(budgets, newSentinelPodDisruptionBudget(cluster, namespace))
+    } else {
+        err := deleteIfExists(&policyv1.PodDisruptionBudget{}, namespace, sentinelName(cluster))
+        if err != nil {
+            return err
+        }
+    }
+
+    for _, budget := range budgets {
+        existing := &policyv1.PodDisruptionBudget{}
+        _, err := createOrUpdate(budget, existing, func() bool {
+            if reflect.DeepEqual(existing.Spec.MinAvailable, budget.Spec.MinAvailable) && reflect.DeepEqual(existing.Spec.MaxUnavailable, budget.Spec.MaxUnavailable) {
+                return false
+            }
+            existing.Spec.MinAvailable = budget.Spec.MinAvailable
+            existing.Spec.MaxUnavailable = budget.Spec.MaxUnavailable
+            return true
+        })
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,12 @@
+// Package main is YARO, an operator running Redis on Kubernetes. Its custom
+// resources belong to the yaro.io/v1alpha1 API group.
+//
+// The deepcopy functions in zz_generated.deepcopy.go and the CRD manifests in
+// deploy/crds are generated by controller-gen from the types and their
+// markers; run go generate after changing them.
+//
+// +kubebuilder:object:generate=true
+// +groupName=yaro.io
+package main
+
+//go:generate controller-gen object paths=. crd:crdVersions=v1 output:crd:artifacts:config=deploy/crds
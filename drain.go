@@ -0,0 +1,100 @@
+package main
+
+import (
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+    // drainingReplicaPriority is the replica-priority given to replicas on a
+    // draining node. Redis prefers replicas with a lower priority when promoting.
+    drainingReplicaPriority = "1000"
+
+    // originalPriorityAnnotation keeps the replica-priority a replica had before
+    // its node started draining.
+    originalPriorityAnnotation = "yaro.io/original-replica-priority"
+)
+
+// reconcileDrainingReplicas lowers the promotion preference of the replicas
+// on cordoned nodes, which are about to be evicted, and restores it when the
+// node is uncordoned. Replicas rescheduled elsewhere start with the default.
+func reconcileDrainingReplicas(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    // Get the pods for the cluster
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) || pod.Spec.NodeName == "" {
+            continue
+        }
+
+        node, err := ctx.GetClientset().CoreV1().Nodes().Get(pod.Spec.NodeName, metav1.GetOptions{})
+        if err != nil {
+            return err
+        }
+
+        _, adjusted := pod.Annotations[originalPriorityAnnotation]
+        if node.Spec.Unschedulable == adjusted {
+            continue
+        }
+
+        client := newRedisClient(pod)
+        if node.Spec.Unschedulable {
+            err = lowerReplicaPriority(ctx, client, pod)
+        } else {
+            err = restoreReplicaPriority(ctx, client, pod)
+        }
+        client.Close()
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// lowerReplicaPriority makes a replica less likely to be promoted, keeping its
+// current priority in an annotation.
+func lowerReplicaPriority(ctx sdk.Context, client *redis.Client, pod *corev1.Pod) error {
+    info, err := client.Info("replication").Result()
+    if err != nil {
+        return err
+    }
+    if parseInfo(info)["role"] != "slave" {
+        return nil
+    }
+
+    priority, err := configGet(client, "replica-priority")
+    if err != nil {
+        return err
+    }
+    err = client.ConfigSet("replica-priority", drainingReplicaPriority).Err()
+    if err != nil {
+        return err
+    }
+
+    if pod.Annotations == nil {
+        pod.Annotations = map[string]string{}
+    }
+    pod.Annotations[originalPriorityAnnotation] = priority
+    _, err = ctx.GetClientset().CoreV1().Pods(pod.Namespace).Update(pod)
+    return err
+}
+
+// restoreReplicaPriority restores the priority a replica had before its node
+// started draining.
+func restoreReplicaPriority(ctx sdk.Context, client *redis.Client, pod *corev1.Pod) error {
+    err := client.ConfigSet("replica-priority", pod.Annotations[originalPriorityAnnotation]).Err()
+    if err != nil {
+        return err
+    }
+
+    delete(pod.Annotations, originalPriorityAnnotation)
+    _, err = ctx.GetClientset().CoreV1().Pods(pod.Namespace).Update(pod)
+    return err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+    "github.com/operator-framework/operator-sdk/pkg/k8sclient"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/client-go/kubernetes/scheme"
+    typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+    "k8s.io/client-go/tools/record"
+)
+
+// eventComponent is the source of the events recorded by the operator.
+const eventComponent = "yaro"
+
+const (
+    // ReasonCreated is the reason of the event recorded when a workload or a
+    // Service is created.
+    ReasonCreated = "Created"
+
+    // ReasonScaled is the reason of the event recorded when a workload is scaled.
+    ReasonScaled = "Scaled"
+
+    // ReasonFailoverDeletedPod is the reason of the event recorded when the
+    // failover deletes a pod that is not ready.
+    ReasonFailoverDeletedPod = "FailoverDeletedPod"
+
+    // ReasonPromoted is the reason of the event recorded when the operator
+    // promotes a replica to master.
+    ReasonPromoted = "Promoted"
+
+    // ReasonRecreated is the reason of the event recorded when an object is
+    // recreated, to change an immutable field or after it was deleted.
+    ReasonRecreated = "Recreated"
+
+    // ReasonDriftCorrected is the reason of the event recorded when a
+    // workload scaled outside of the operator is scaled back.
+    ReasonDriftCorrected = "DriftCorrected"
+
+    // ReasonScaleAdopted is the reason of the event recorded when the replica
+    // count of a workload scaled outside of the operator is adopted as the
+    // size of the RedisCluster.
+    ReasonScaleAdopted = "ScaleAdopted"
+
+    // ReasonReconcileError is the reason of the event recorded when a
+    // reconcile fails.
+    ReasonReconcileError = "ReconcileError"
+)
+
+// newEventRecorder returns a recorder publishing events through the API
+// server and writing them to the debug logs.
+func newEventRecorder() record.EventRecorder {
+    broadcaster := record.NewBroadcaster()
+    broadcaster.StartEventWatcher(func(event *corev1.Event) {
+        logger.V(1).Info(event.Message, "kind", event.InvolvedObject.Kind, "namespace", event.InvolvedObject.Namespace, "name", event.InvolvedObject.Name, "type", event.Type, "reason", event.Reason)
+    })
+    broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+        Interface: k8sclient.GetKubeClient().CoreV1().Events(""),
+    })
+    return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+}
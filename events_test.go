@@ -0,0 +1,108 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    "time"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/tools/record"
+)
+
+// newTestHandler returns a handler recording its events in a fake recorder
+// rather than sending them to the API server.
+func newTestHandler() (*RedisClusterHandler, *record.FakeRecorder) {
+    recorder := record.NewFakeRecorder(10)
+    handler := &RedisClusterHandler{
+        failureThreshold:   defaultFailureThreshold,
+        clockSkewThreshold: defaultClockSkewThreshold,
+        maxClusterSize:     defaultMaxClusterSize,
+        recorder:           recorder,
+        limiter:            newReconcileLimiter(),
+        failures:           map[types.NamespacedName]*reconcileFailures{},
+        clockChecks:        map[types.NamespacedName]time.Time{},
+        lastReconciles:     map[types.NamespacedName]lastReconcile{},
+    }
+    return handler, recorder
+}
+
+// recordedEvents drains the events recorded so far.
+func recordedEvents(recorder *record.FakeRecorder) []string {
+    events := []string{}
+    for {
+        select {
+        case event := <-recorder.Events:
+            events = append(events, event)
+        default:
+            return events
+        }
+    }
+}
+
+func TestStatefulSetEvents(t *testing.T) {
+    handler, recorder := newTestHandler()
+    newFakeClient(t)
+    cluster := newTestCluster(3)
+    labels := map[string]string{"app": cluster.ObjectMeta.Name, "controller": cluster.ObjectMeta.Name}
+    template := newPodTemplate(cluster, labels)
+
+    err := handler.reconcileStatefulSet(cluster, newStatefulSet(cluster, "default", 3, labels, template))
+    if err != nil {
+        t.Fatal(err)
+    }
+    events := recordedEvents(recorder)
+    if len(events) != 1 || !strings.HasPrefix(events[0], "Normal "+ReasonCreated+" ") {
+        t.Errorf("got events %v, want the StatefulSet creation", events)
+    }
+
+    err = handler.reconcileStatefulSet(cluster, newStatefulSet(cluster, "default", 5, labels, template))
+    if err != nil {
+        t.Fatal(err)
+    }
+    events = recordedEvents(recorder)
+    if len(events) != 1 || events[0] != "Normal "+ReasonScaled+" Scaled StatefulSet cache from 3 to 5" {
+        t.Errorf("got events %v, want the scale from 3 to 5", events)
+    }
+
+    err = handler.reconcileStatefulSet(cluster, newStatefulSet(cluster, "default", 5, labels, template))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if events = recordedEvents(recorder); len(events) != 0 {
+        t.Errorf("got events %v for a converged StatefulSet, want none", events)
+    }
+}
+
+func TestExternalScaleEvents(t *testing.T) {
+    handler, recorder := newTestHandler()
+    cluster := newTestCluster(3)
+    labels := map[string]string{"app": cluster.ObjectMeta.Name, "controller": cluster.ObjectMeta.Name}
+    statefulSet := newStatefulSet(cluster, "default", 2, labels, newPodTemplate(cluster, labels))
+    fake := newFakeClient(t, cluster, statefulSet)
+
+    err := handler.reconcileExternalScale(sdk.Context{}, "default", cluster, statefulSet, statefulSet.Spec.Replicas)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if fake.updates != 1 || *statefulSet.Spec.Replicas != 3 {
+        t.Errorf("got %d updates and %d replicas, want the StatefulSet scaled back to 3", fake.updates, *statefulSet.Spec.Replicas)
+    }
+    events := recordedEvents(recorder)
+    if len(events) != 1 || !strings.HasPrefix(events[0], "Normal "+ReasonDriftCorrected+" ") {
+        t.Errorf("got events %v, want the drift correction", events)
+    }
+
+    cluster.ObjectMeta.Annotations = map[string]string{adoptScaleAnnotation: "true"}
+    *statefulSet.Spec.Replicas = 2
+    err = handler.reconcileExternalScale(sdk.Context{}, "default", cluster, statefulSet, statefulSet.Spec.Replicas)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cluster.Spec.Size != 2 {
+        t.Errorf("got size %d, want the 2 replicas adopted", cluster.Spec.Size)
+    }
+    events = recordedEvents(recorder)
+    if len(events) != 1 || !strings.HasPrefix(events[0], "Normal "+ReasonScaleAdopted+" ") {
+        t.Errorf("got events %v, want the adoption", events)
+    }
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "strconv"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+    // exposedPodLabel labels the per-node Services with the pod they expose.
+    exposedPodLabel = "yaro.io/exposed-pod"
+
+    // clusterBusPortName is the name of the Service port of the cluster bus.
+    clusterBusPortName = "cluster-bus"
+)
+
+// nodeServiceName returns the name of the Service exposing a pod.
+func nodeServiceName(pod string) string {
+    return pod + "-external"
+}
+
+// newNodeService builds the Service exposing a single pod outside the
+// Kubernetes cluster, with the cluster bus port in cluster mode.
+func newNodeService(cluster *RedisCluster, namespace, pod string) *corev1.Service {
+    name := cluster.ObjectMeta.Name
+    spec := cluster.Spec
+    ports := []corev1.ServicePort{{
+        Name:       redisPortName,
+        Port:       clientPort(spec),
+        TargetPort: intstr.FromInt(int(clientPort(spec))),
+    }}
+    if spec.Mode == ModeCluster {
+        ports = append(ports, corev1.ServicePort{
+            Name:       clusterBusPortName,
+            Port:       clientPort(spec) + clusterBusPortOffset,
+            TargetPort: intstr.FromInt(int(clientPort(spec) + clusterBusPortOffset)),
+        })
+    }
+    return &corev1.Service{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            nodeServiceName(pod),
+            Namespace:       namespace,
+            Labels:          map[string]string{"app": name, "controller": name, exposedPodLabel: pod},
+            Annotations:     spec.Exposure.Annotations,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: corev1.ServiceSpec{
+            Type:                     spec.Exposure.Type,
+            Selector:                 map[string]string{appsv1.StatefulSetPodNameLabel: pod},
+            Ports:                    ports,
+            PublishNotReadyAddresses: true,
+        },
+    }
+}
+
+// validateExposure checks the exposure settings of the spec.
+func validateExposure(spec RedisClusterSpec) error {
+    if spec.Exposure == nil {
+        return nil
+    }
+    switch spec.Exposure.Type {
+    case corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+        return nil
+    default:
+        return fmt.Errorf("exposure type %s is invalid, it must be %s or %s", spec.Exposure.Type, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer)
+    }
+}
+
+// reconcileExposure gives each pod of the cluster its own NodePort or
+// LoadBalancer Service when the spec exposes the cluster, and has the nodes
+// announce the external address of their Service. The Services of the pods
+// that are gone, and all of them once the exposure is removed, are deleted.
+func reconcileExposure(ctx sdk.Context, namespace string, cluster *RedisCluster, replicas int32) error {
+    name := cluster.ObjectMeta.Name
+    existing, err := ctx.GetClientset().CoreV1().Services(namespace).List(metav1.ListOptions{LabelSelector: "controller=" + name + "," + exposedPodLabel})
+    if err != nil {
+        return err
+    }
+
+    // Delete the Services no longer needed
+    removed := false
+    for _, service := range existing.Items {
+        if cluster.Spec.Exposure != nil && podOrdinal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: service.Labels[exposedPodLabel]}}) < int(replicas) {
+            continue
+        }
+        err = ctx.GetClientset().CoreV1().Services(namespace).Delete(service.Name, &metav1.DeleteOptions{})
+        if err != nil && !apierrors.IsNotFound(err) {
+            return err
+        }
+        removed = true
+    }
+    if cluster.Spec.Exposure == nil {
+        if !removed {
+            return nil
+        }
+        return forEachReadyNode(ctx, namespace, name, func(client *redis.Client) error {
+            return announceAddress(client, cluster.Spec, "", 0, 0)
+        })
+    }
+
+    // Create/update the Service of each pod
+    for ordinal := int32(0); ordinal < replicas; ordinal++ {
+        service := newNodeService(cluster, namespace, name+"-"+strconv.Itoa(int(ordinal)))
+        current := &corev1.Service{}
+        _, err = createOrUpdate(service, current, func() bool {
+            changed := false
+            if current.Spec.Type != service.Spec.Type || !sameServicePorts(current.Spec.Ports, service.Spec.Ports) {
+                current.Spec.Type = service.Spec.Type
+                current.Spec.Ports = service.Spec.Ports
+                changed = true
+            }
+            if !reflect.DeepEqual(current.ObjectMeta.Annotations, service.ObjectMeta.Annotations) {
+                current.ObjectMeta.Annotations = service.ObjectMeta.Annotations
+                changed = true
+            }
+            return changed
+        })
+        if err != nil {
+            return err
+        }
+    }
+
+    // Announce the external addresses, which the nodes lose when they restart
+    pods, err := listClusterPods(ctx, namespace, name)
+    if err != nil {
+        return err
+    }
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        host, port, busPort, err := externalAddress(ctx, namespace, pod)
+        if err != nil || host == "" {
+            return err
+        }
+        client := newRedisClient(pod)
+        err = announceAddress(client, cluster.Spec, host, port, busPort)
+        client.Close()
+        if err != nil {
+            return fmt.Errorf("announcing the address of pod %s: %v", pod.Name, err)
+        }
+    }
+    return nil
+}
+
+// externalAddress returns the address the Service of the pod exposes it on:
+// the load balancer IP with the Service ports, or the address of the node
+// of the pod with the node ports. The host is empty while the load balancer
+// is being provisioned.
+func externalAddress(ctx sdk.Context, namespace string, pod *corev1.Pod) (string, int32, int32, error) {
+    service := &corev1.Service{}
+    err := sdk.Get(service, namespace, nodeServiceName(pod.Name))
+    if err != nil {
+        return "", 0, 0, err
+    }
+    var port, busPort int32
+    for _, servicePort := range service.Spec.Ports {
+        number := servicePort.Port
+        if service.Spec.Type == corev1.ServiceTypeNodePort {
+            number = servicePort.NodePort
+        }
+        switch servicePort.Name {
+        case redisPortName:
+            port = number
+        case clusterBusPortName:
+            busPort = number
+        }
+    }
+
+    // Use the IP of the load balancer
+    if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+        for _, ingress := range service.Status.LoadBalancer.Ingress {
+            if ingress.IP != "" {
+                return ingress.IP, port, busPort, nil
+            }
+        }
+        return "", 0, 0, nil
+    }
+
+    // Use the address of the node, preferring its external IP
+    if pod.Spec.NodeName == "" {
+        return "", 0, 0, nil
+    }
+    node, err := ctx.GetClientset().CoreV1().Nodes().Get(pod.Spec.NodeName, metav1.GetOptions{})
+    if err != nil {
+        return "", 0, 0, err
+    }
+    host := ""
+    for _, address := range node.Status.Addresses {
+        if address.Type == corev1.NodeExternalIP {
+            return address.Address, port, busPort, nil
+        }
+        if address.Type == corev1.NodeInternalIP && host == "" {
+            host = address.Address
+        }
+    }
+    return host, port, busPort, nil
+}
+
+// announceAddress has the node announce the address to the other nodes: to
+// the cluster bus in cluster mode, and to its master as a replica otherwise.
+// An empty host goes back to announcing the pod address.
+func announceAddress(client *redis.Client, spec RedisClusterSpec, host string, port, busPort int32) error {
+    if spec.Mode == ModeCluster {
+        err := configSet(client, "cluster-announce-ip", host)
+        if err != nil {
+            return err
+        }
+        err = configSet(client, "cluster-announce-port", strconv.Itoa(int(port)))
+        if err != nil {
+            return err
+        }
+        return configSet(client, "cluster-announce-bus-port", strconv.Itoa(int(busPort)))
+    }
+    err := configSet(client, "slave-announce-ip", host)
+    if err != nil {
+        return err
+    }
+    return configSet(client, "slave-announce-port", strconv.Itoa(int(port)))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+    "fmt"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// addPodExtensions adds the init containers, sidecars and volumes of the
+// spec to the pod template, after the ones the operator manages. The init
+// containers run before the restore of a snapshot, which has the last word
+// on the data.
+func addPodExtensions(template *corev1.PodTemplateSpec, spec RedisClusterSpec) {
+    template.Spec.InitContainers = append(template.Spec.InitContainers, spec.InitContainers...)
+    template.Spec.Containers = append(template.Spec.Containers, spec.Sidecars...)
+    template.Spec.Volumes = append(template.Spec.Volumes, spec.ExtraVolumes...)
+    template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, spec.ExtraVolumeMounts...)
+}
+
+// validatePodExtensions checks that the init containers, sidecars and
+// volumes of the spec do not reuse the names of the ones the operator
+// manages or of each other.
+func validatePodExtensions(cluster *RedisCluster) error {
+    template := newPodTemplate(cluster, nil)
+    containers := map[string]bool{}
+    for _, list := range [][]corev1.Container{template.Spec.InitContainers, template.Spec.Containers} {
+        for _, container := range list {
+            if container.Name == "" {
+                return fmt.Errorf("containers must have a name")
+            }
+            if containers[container.Name] {
+                return fmt.Errorf("container name %s is used more than once", container.Name)
+            }
+            containers[container.Name] = true
+        }
+    }
+    if containers[restoreContainerName] {
+        return fmt.Errorf("container name %s is reserved for the restores", restoreContainerName)
+    }
+
+    volumes := map[string]bool{}
+    for _, volume := range template.Spec.Volumes {
+        if volumes[volume.Name] {
+            return fmt.Errorf("volume name %s is used more than once", volume.Name)
+        }
+        volumes[volume.Name] = true
+    }
+    if dataVolume(cluster.Spec, nil) == nil {
+        if volumes[dataVolumeName] {
+            return fmt.Errorf("volume name %s is reserved for the data", dataVolumeName)
+        }
+        volumes[dataVolumeName] = true
+    }
+    for _, mount := range cluster.Spec.ExtraVolumeMounts {
+        if !volumes[mount.Name] {
+            return fmt.Errorf("volume mount %s refers to no volume", mount.Name)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "strconv"
+    "time"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// failoverGracePeriod is how long a started pod may stay unready before the
+// failover considers replacing it, so that pods being rolled or rescheduled
+// get to load their data.
+const failoverGracePeriod = 2 * time.Minute
+
+// defaultMaxUnavailable is the number of pods the failover deletes per reconcile
+// when the spec does not set it.
+const defaultMaxUnavailable = 1
+
+// maxUnavailable returns the number of pods the failover may delete per reconcile.
+func maxUnavailable(spec RedisClusterSpec) int32 {
+    if spec.MaxUnavailable < 1 {
+        return defaultMaxUnavailable
+    }
+    return spec.MaxUnavailable
+}
+
+// quorum returns a majority of the pods, the default minimum number of
+// healthy nodes of the failover.
+func quorum(size int32) int {
+    return int(size)/2 + 1
+}
+
+// minAvailable returns the number of healthy nodes below which the failover
+// deletes no pod.
+func minAvailable(spec RedisClusterSpec) int {
+    if spec.MinAvailable != nil {
+        return int(*spec.MinAvailable)
+    }
+    return quorum(podCount(spec))
+}
+
+// validateMinAvailable checks the minimum available count of the spec.
+func validateMinAvailable(spec RedisClusterSpec) error {
+    if spec.MinAvailable == nil {
+        return nil
+    }
+    if *spec.MinAvailable < 0 || *spec.MinAvailable > podCount(spec) {
+        return fmt.Errorf("minAvailable %d is out of range, it must be between 0 and the %d pods", *spec.MinAvailable, podCount(spec))
+    }
+    return nil
+}
+
+// isFailedNode reports whether the failover should replace an unready pod:
+// it is not being replaced already, it started long enough ago to have
+// loaded its data, and the health check has not seen its Redis server for
+// the grace period. Pods still being scheduled or started by a rollout, and
+// nodes loading their dataset, are left alone.
+func isFailedNode(pod *corev1.Pod, health *RedisNodeHealth, now time.Time) bool {
+    if pod.DeletionTimestamp != nil || pod.Status.StartTime == nil {
+        return false
+    }
+    if now.Sub(pod.Status.StartTime.Time) < failoverGracePeriod {
+        return false
+    }
+    if health == nil || health.Loading {
+        return false
+    }
+    return health.LastSeen == nil || now.Sub(health.LastSeen.Time) >= failoverGracePeriod
+}
+
+// masterNode returns the node acting as master of a replication topology,
+// that is the master with replicas connected, or an empty string if the nodes
+// run standalone.
+func masterNode(nodes []RedisNodeStatus) string {
+    for _, node := range nodes {
+        if node.Role == "master" && node.ConnectedSlaves > 0 {
+            return node.Name
+        }
+    }
+    return ""
+}
+
+// promoteReplica promotes a healthy replica to master in place of the
+// unhealthy master, points the other healthy replicas at it and records it
+// as the master of the cluster. Like Redis Sentinel, it prefers the replica
+// with the lowest replica priority, then the one that replicated the most,
+// and never promotes a replica with priority 0. It fails if no healthy
+// replica is available.
+func promoteReplica(cluster *RedisCluster, pods []corev1.Pod) error {
+    // Find the healthy replicas
+    var replica *corev1.Pod
+    var best map[string]string
+    replicas := []*corev1.Pod{}
+    for i := range pods {
+        pod := &pods[i]
+        if pod.Name == cluster.Status.MasterNode || !isPodReady(pod) {
+            continue
+        }
+        info, err := getInfo(pod, "replication")
+        if err != nil || info["role"] != "slave" {
+            continue
+        }
+        replicas = append(replicas, pod)
+        if info["slave_priority"] == "0" {
+            continue
+        }
+        if replica == nil || betterReplica(info, best) {
+            replica, best = pod, info
+        }
+    }
+    if replica == nil {
+        return fmt.Errorf("no healthy replica to promote in place of master %s", cluster.Status.MasterNode)
+    }
+
+    // Promote the replica
+    client := newRedisClient(replica)
+    err := client.SlaveOf("NO", "ONE").Err()
+    client.Close()
+    if err != nil {
+        return fmt.Errorf("promoting replica %s: %v", replica.Name, err)
+    }
+
+    // Point the other replicas at the new master
+    host, port := replica.Status.PodIP, strconv.Itoa(int(podRedisPort(replica)))
+    for _, pod := range replicas {
+        if pod == replica {
+            continue
+        }
+        client := newRedisClient(pod)
+        err = client.SlaveOf(host, port).Err()
+        client.Close()
+        if err != nil {
+            return fmt.Errorf("replicating %s from %s: %v", pod.Name, net.JoinHostPort(host, port), err)
+        }
+    }
+
+    // Record the new master
+    cluster.Status.MasterNode = replica.Name
+    err = updateStatus(cluster)
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+// betterReplica reports whether a replica is a better promotion candidate
+// than the best one so far, from their INFO replication fields.
+func betterReplica(info, best map[string]string) bool {
+    priority, _ := strconv.Atoi(info["slave_priority"])
+    bestPriority, _ := strconv.Atoi(best["slave_priority"])
+    if priority != bestPriority {
+        return priority < bestPriority
+    }
+    offset, _ := strconv.ParseInt(info["slave_repl_offset"], 10, 64)
+    bestOffset, _ := strconv.ParseInt(best["slave_repl_offset"], 10, 64)
+    return offset > bestOffset
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+    "fmt"
+    "testing"
+    "time"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFailoverBudget(t *testing.T) {
+    count := func(value int32) *int32 { return &value }
+    tests := []struct {
+        name           string
+        spec           RedisClusterSpec
+        maxUnavailable int32
+        minAvailable   int
+    }{
+        {"defaults of 3 pods", RedisClusterSpec{Size: 3}, 1, 2},
+        {"defaults of 4 pods", RedisClusterSpec{Size: 4}, 1, 3},
+        {"defaults of 1 pod", RedisClusterSpec{Size: 1}, 1, 1},
+        {"negative max unavailable", RedisClusterSpec{Size: 5, MaxUnavailable: -1}, 1, 3},
+        {"max unavailable of 2", RedisClusterSpec{Size: 5, MaxUnavailable: 2}, 2, 3},
+        {"min available of 0", RedisClusterSpec{Size: 5, MinAvailable: count(0)}, 1, 0},
+    }
+    for _, test := range tests {
+        if got := maxUnavailable(test.spec); got != test.maxUnavailable {
+            t.Errorf("%s: got max unavailable %d, want %d", test.name, got, test.maxUnavailable)
+        }
+        if got := minAvailable(test.spec); got != test.minAvailable {
+            t.Errorf("%s: got min available %d, want %d", test.name, got, test.minAvailable)
+        }
+    }
+}
+
+func TestValidateMinAvailable(t *testing.T) {
+    count := func(value int32) *int32 { return &value }
+    for _, valid := range []*int32{nil, count(0), count(3)} {
+        err := validateMinAvailable(RedisClusterSpec{Size: 3, MinAvailable: valid})
+        if err != nil {
+            t.Errorf("got %v, want no error", err)
+        }
+    }
+    for _, invalid := range []*int32{count(-1), count(4)} {
+        err := validateMinAvailable(RedisClusterSpec{Size: 3, MinAvailable: invalid})
+        if err == nil {
+            t.Errorf("min available %d of 3 pods: got no error, want it rejected", *invalid)
+        }
+    }
+}
+
+func TestIsFailedNode(t *testing.T) {
+    now := time.Now()
+    started := metav1.NewTime(now.Add(-time.Hour))
+    justStarted := metav1.NewTime(now.Add(-time.Minute))
+    seen := metav1.NewTime(now.Add(-time.Minute))
+    lost := metav1.NewTime(now.Add(-time.Hour))
+    deleted := metav1.NewTime(now)
+    pod := func(start *metav1.Time, deletion *metav1.Time) *corev1.Pod {
+        return &corev1.Pod{
+            ObjectMeta: metav1.ObjectMeta{Name: "cache-0", DeletionTimestamp: deletion},
+            Status:     corev1.PodStatus{StartTime: start},
+        }
+    }
+    tests := []struct {
+        name   string
+        pod    *corev1.Pod
+        health *RedisNodeHealth
+        failed bool
+    }{
+        {"lost for the grace period", pod(&started, nil), &RedisNodeHealth{LastSeen: &lost}, true},
+        {"never seen", pod(&started, nil), &RedisNodeHealth{}, true},
+        {"seen recently", pod(&started, nil), &RedisNodeHealth{LastSeen: &seen}, false},
+        {"loading its dataset", pod(&started, nil), &RedisNodeHealth{Loading: true}, false},
+        {"not checked yet", pod(&started, nil), nil, false},
+        {"started recently", pod(&justStarted, nil), &RedisNodeHealth{LastSeen: &lost}, false},
+        {"not started", pod(nil, nil), &RedisNodeHealth{LastSeen: &lost}, false},
+        {"being deleted", pod(&started, &deleted), &RedisNodeHealth{LastSeen: &lost}, false},
+    }
+    for _, test := range tests {
+        if got := isFailedNode(test.pod, test.health, now); got != test.failed {
+            t.Errorf("%s: got failed %v, want %v", test.name, got, test.failed)
+        }
+    }
+}
+
+// newTestPod returns a pod of the cluster started long ago, ready or not.
+func newTestPod(cluster *RedisCluster, name string, ready bool) *corev1.Pod {
+    started := metav1.NewTime(time.Now().Add(-time.Hour))
+    status := corev1.ConditionFalse
+    if ready {
+        status = corev1.ConditionTrue
+    }
+    return &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:      name,
+            Namespace: cluster.Namespace,
+            Labels:    map[string]string{"app": cluster.Name, "controller": cluster.Name},
+        },
+        Status: corev1.PodStatus{
+            StartTime:  &started,
+            Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+        },
+    }
+}
+
+func TestPerformAutomaticFailoverBudget(t *testing.T) {
+    count := func(value int32) *int32 { return &value }
+    tests := []struct {
+        name    string
+        spec    RedisClusterSpec
+        ready   int
+        failed  int
+        deletes int
+    }{
+        {"one pod per reconcile by default", RedisClusterSpec{Size: 5, MinAvailable: count(2)}, 2, 3, 1},
+        {"max unavailable of 2", RedisClusterSpec{Size: 5, MaxUnavailable: 2, MinAvailable: count(2)}, 2, 3, 2},
+        {"max unavailable above the failed pods", RedisClusterSpec{Size: 5, MaxUnavailable: 5, MinAvailable: count(2)}, 2, 3, 3},
+        {"too few healthy nodes", RedisClusterSpec{Size: 5, MaxUnavailable: 2}, 2, 3, 0},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            handler, recorder := newTestHandler()
+            cluster := newTestCluster(test.spec.Size)
+            cluster.Spec = test.spec
+            objects := []sdk.Object{cluster}
+            for i := 0; i < test.ready+test.failed; i++ {
+                name := fmt.Sprintf("cache-%d", i)
+                objects = append(objects, newTestPod(cluster, name, i < test.ready))
+                cluster.Status.Nodes = append(cluster.Status.Nodes, RedisNodeHealth{Name: name, Healthy: i < test.ready})
+            }
+            fake := newFakeClient(t, objects...)
+
+            err := handler.performAutomaticFailover(sdk.Context{}, "default", "cache")
+            if err != nil {
+                t.Fatal(err)
+            }
+            if fake.deletes != test.deletes {
+                t.Errorf("got %d pods deleted, want %d", fake.deletes, test.deletes)
+            }
+            if events := recordedEvents(recorder); len(events) != test.deletes {
+                t.Errorf("got events %v, want one per deleted pod", events)
+            }
+        })
+    }
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+    // defaultFailureThreshold is the number of consecutive reconcile failures
+    // after which a RedisCluster is marked Failed.
+    defaultFailureThreshold = 3
+)
+
+// reconcileFailures tracks the consecutive reconcile failures of a RedisCluster.
+// +kubebuilder:object:generate=false
+type reconcileFailures struct {
+    count       int
+    nextAttempt time.Time
+    generation  int64
+}
+
+// getFailureThreshold returns the failure threshold set through
+// RECONCILE_FAILURE_THRESHOLD, or the default one.
+func getFailureThreshold() int {
+    threshold, err := strconv.Atoi(os.Getenv("RECONCILE_FAILURE_THRESHOLD"))
+    if err != nil || threshold < 1 {
+        return defaultFailureThreshold
+    }
+    return threshold
+}
+
+// backoff returns the delay before the next attempt after count consecutive failures.
+func backoff(count int) time.Duration {
+    delay := *initialBackoff
+    for i := 1; i < count && delay < *maxBackoff; i++ {
+        delay *= 2
+    }
+    if delay > *maxBackoff {
+        delay = *maxBackoff
+    }
+    return delay
+}
+
+// reconcileRedisCluster handles the RedisCluster, backing off between retries
+// while it keeps failing and marking it Failed past the failure threshold.
+func (h *RedisClusterHandler) reconcileRedisCluster(ctx sdk.Context, cluster *RedisCluster) error {
+    key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+
+    // Wait for the backoff to expire before retrying a failing cluster,
+    // unless its spec changed since it failed. The event is returned as an
+    // error so that it is delivered again rather than dropped.
+    h.mu.Lock()
+    failures := h.failures[key]
+    var nextAttempt time.Time
+    if failures != nil && failures.generation == cluster.Generation {
+        nextAttempt = failures.nextAttempt
+    }
+    h.mu.Unlock()
+    if time.Now().Before(nextAttempt) {
+        return fmt.Errorf("backing off the failing cluster until %s", nextAttempt.Format(time.RFC3339))
+    }
+
+    // Leave an unchanged cluster until its reconcile period elapsed
+    if !h.isResyncDue(cluster) {
+        return nil
+    }
+    err := h.waitReconcile()
+    if err != nil {
+        return err
+    }
+
+    // Get the namespace of the custom resource
+    namespace, err := objectNamespace(cluster)
+    if err != nil {
+        return err
+    }
+
+    // Leave a paused cluster as it is
+    paused, err := reconcilePause(namespace, cluster)
+    if err != nil || paused {
+        return err
+    }
+
+    log := reconcileLogger(cluster)
+    log.V(1).Info("Reconciling the cluster", "generation", cluster.Generation)
+    start := time.Now()
+    reconcileErr := h.handleRedisCluster(ctx, namespace, cluster)
+    if reconcileErr == nil {
+        log.V(1).Info("Reconciled the cluster", "duration", time.Since(start).String())
+
+        // Clear the failures and the Failed condition on success
+        h.mu.Lock()
+        delete(h.failures, key)
+        h.mu.Unlock()
+        h.recordReconcile(cluster)
+        if meta.IsStatusConditionTrue(cluster.Status.Conditions, ConditionFailed) {
+            err = setClusterCondition(namespace, cluster.Name, metav1.Condition{
+                Type:    ConditionFailed,
+                Status:  metav1.ConditionFalse,
+                Reason:  "ReconcileSucceeded",
+                Message: "The last reconcile succeeded",
+            })
+            if err != nil {
+                return err
+            }
+        }
+
+        // Record the versions that reconciled the cluster
+        return updateManagedBy(namespace, cluster)
+    }
+
+    // Record the failure and schedule the next attempt
+    h.recorder.Event(cluster, corev1.EventTypeWarning, ReasonReconcileError, reconcileErr.Error())
+    h.mu.Lock()
+    if failures == nil {
+        failures = &reconcileFailures{}
+        h.failures[key] = failures
+    }
+    failures.count++
+    failures.nextAttempt = time.Now().Add(backoff(failures.count))
+    failures.generation = cluster.Generation
+    count := failures.count
+    nextAttempt = failures.nextAttempt
+    h.mu.Unlock()
+    log.Info("Backing off the failing cluster", "failures", count, "nextAttempt", nextAttempt.Format(time.RFC3339))
+
+    // Mark the cluster Failed once the threshold is reached
+    if count >= h.failureThreshold {
+        err = setClusterCondition(namespace, cluster.Name, metav1.Condition{
+            Type:    ConditionFailed,
+            Status:  metav1.ConditionTrue,
+            Reason:  "ReconcileError",
+            Message: reconcileErr.Error(),
+        })
+        if err != nil {
+            return err
+        }
+    }
+
+    return reconcileErr
+}
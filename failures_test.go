@@ -0,0 +1,53 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestBackoff(t *testing.T) {
+    initial, max := *initialBackoff, *maxBackoff
+    t.Cleanup(func() {
+        *initialBackoff, *maxBackoff = initial, max
+    })
+    *initialBackoff = 5 * time.Second
+    *maxBackoff = 5 * time.Minute
+
+    tests := []struct {
+        failures int
+        want     time.Duration
+    }{
+        {1, 5 * time.Second},
+        {2, 10 * time.Second},
+        {3, 20 * time.Second},
+        {6, 160 * time.Second},
+        {7, 5 * time.Minute},
+        {100, 5 * time.Minute},
+    }
+    for _, test := range tests {
+        got := backoff(test.failures)
+        if got != test.want {
+            t.Errorf("backoff(%d) = %s, want %s", test.failures, got, test.want)
+        }
+    }
+}
+
+func TestGetFailureThreshold(t *testing.T) {
+    tests := []struct {
+        value string
+        want  int
+    }{
+        {"", defaultFailureThreshold},
+        {"5", 5},
+        {"0", defaultFailureThreshold},
+        {"-1", defaultFailureThreshold},
+        {"three", defaultFailureThreshold},
+    }
+    for _, test := range tests {
+        t.Setenv("RECONCILE_FAILURE_THRESHOLD", test.value)
+        got := getFailureThreshold()
+        if got != test.want {
+            t.Errorf("threshold %q: got %d, want %d", test.value, got, test.want)
+        }
+    }
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+// finalizer holds the deletion of a custom resource until the operator
+// cleaned up the state it keeps outside of the owned objects.
+const finalizer = "yaro.redis/finalizer"
+
+// hasFinalizer reports whether the object has the operator finalizer.
+func hasFinalizer(object metav1.Object) bool {
+    for _, f := range object.GetFinalizers() {
+        if f == finalizer {
+            return true
+        }
+    }
+    return false
+}
+
+// addFinalizer registers the operator finalizer on the object.
+func addFinalizer(object sdk.Object) error {
+    meta := object.(metav1.Object)
+    if hasFinalizer(meta) {
+        return nil
+    }
+    meta.SetFinalizers(append(meta.GetFinalizers(), finalizer))
+    return updateObject(object)
+}
+
+// removeFinalizer removes the operator finalizer from the object so that its
+// deletion can complete.
+func removeFinalizer(object sdk.Object) error {
+    meta := object.(metav1.Object)
+    finalizers := []string{}
+    for _, f := range meta.GetFinalizers() {
+        if f != finalizer {
+            finalizers = append(finalizers, f)
+        }
+    }
+    meta.SetFinalizers(finalizers)
+    return updateObject(object)
+}
+
+// finalizeRedisCluster tears down the state of a deleted RedisCluster and
+// removes the operator finalizer so that the deletion can complete.
+func (h *RedisClusterHandler) finalizeRedisCluster(ctx sdk.Context, cluster *RedisCluster) error {
+    if !hasFinalizer(cluster) {
+        return nil
+    }
+
+    // Get the namespace of the custom resource
+    namespace, err := objectNamespace(cluster)
+    if err != nil {
+        return err
+    }
+
+    // Delete the volume claims unless the storage retains them
+    err = deleteVolumeClaims(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Tear down the state kept for the cluster
+    h.teardownRedisCluster(namespace, cluster)
+
+    // Remove the finalizer
+    return removeFinalizer(cluster)
+}
+
+// teardownRedisCluster releases the state the operator keeps for a cluster
+// outside of Kubernetes objects.
+func (h *RedisClusterHandler) teardownRedisCluster(namespace string, cluster *RedisCluster) {
+    name := cluster.ObjectMeta.Name
+
+    // Forget the reconcile state of the cluster
+    h.mu.Lock()
+    delete(h.failures, types.NamespacedName{Namespace: cluster.Namespace, Name: name})
+    delete(h.clockChecks, types.NamespacedName{Namespace: namespace, Name: name})
+    delete(h.lastReconciles, types.NamespacedName{Namespace: namespace, Name: name})
+    h.mu.Unlock()
+    setClusterPassword(namespace, name, "")
+    setClusterTLSConfig(namespace, name, nil)
+
+    // Drop the metrics and the slow log cursors of the cluster
+    deleteClusterMetrics(namespace, name)
+    deleteDiagnostics(namespace, name)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestAddFinalizer(t *testing.T) {
+    cluster := newTestCluster(3)
+    fake := newFakeClient(t, cluster)
+
+    for pass := 1; pass <= 2; pass++ {
+        err := addFinalizer(cluster)
+        if err != nil {
+            t.Fatalf("add %d: %v", pass, err)
+        }
+    }
+    if fake.updates != 1 {
+        t.Errorf("got %d updates, want the finalizer added once", fake.updates)
+    }
+    stored := &RedisCluster{}
+    err := fake.get(stored, "default", cluster.ObjectMeta.Name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !hasFinalizer(stored) {
+        t.Errorf("got finalizers %v, want %s", stored.ObjectMeta.Finalizers, finalizer)
+    }
+}
+
+func TestRemoveFinalizerKeepsOthers(t *testing.T) {
+    cluster := newTestCluster(3)
+    cluster.ObjectMeta.Finalizers = []string{"example.com/dns", finalizer}
+    newFakeClient(t, cluster)
+
+    err := removeFinalizer(cluster)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(cluster.ObjectMeta.Finalizers, []string{"example.com/dns"}) {
+        t.Errorf("got finalizers %v, want only example.com/dns", cluster.ObjectMeta.Finalizers)
+    }
+}
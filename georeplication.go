@@ -0,0 +1,201 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "sort"
+    "strconv"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// promoteAnnotation breaks the link of a cluster replicating a remote master
+// when set to "true", for a disaster recovery failover to the cluster.
+const promoteAnnotation = "yaro.io/promote"
+
+const (
+    // ReasonReplicationSource is the reason of the event recorded when a
+    // node starts replicating the remote master.
+    ReasonReplicationSource = "ReplicationSource"
+
+    // SourceLinkUp is the link status of a cluster whose ready nodes all
+    // replicate the remote master.
+    SourceLinkUp = "Up"
+
+    // SourceLinkDown is the link status of a cluster with ready nodes that
+    // do not replicate the remote master.
+    SourceLinkDown = "Down"
+)
+
+// sourcePort returns the port of the remote master.
+func sourcePort(source *RedisReplicationSource) int32 {
+    if source.Port == 0 {
+        return redisPort
+    }
+    return source.Port
+}
+
+// validateReplicationSource checks the replication source of the spec. The
+// nodes replicate the remote master directly, so the source only works with
+// standalone nodes: the sentinels and the cluster nodes would fight the link.
+func validateReplicationSource(spec RedisClusterSpec) error {
+    source := spec.ReplicationSource
+    if source == nil {
+        return nil
+    }
+    if spec.Mode != "" && spec.Mode != ModeStandalone {
+        return fmt.Errorf("replicationSource needs the %s mode, %s nodes manage their own replication", ModeStandalone, spec.Mode)
+    }
+    if source.Host == "" {
+        return fmt.Errorf("replicationSource needs the host of the remote master")
+    }
+    if source.Port < 0 || source.Port > 65535 {
+        return fmt.Errorf("replicationSource port %d is not a valid port number", source.Port)
+    }
+    return nil
+}
+
+// sourcePassword returns the password of the remote master, or an empty
+// string if the source does not reference one.
+func sourcePassword(namespace string, source *RedisReplicationSource) (string, error) {
+    ref := source.PasswordSecretRef
+    if ref == nil {
+        return "", nil
+    }
+    secret := &corev1.Secret{}
+    err := sdk.Get(secret, namespace, ref.Name)
+    if apierrors.IsNotFound(err) {
+        return "", fmt.Errorf("replication source password secret %s not found", ref.Name)
+    }
+    if err != nil {
+        return "", err
+    }
+    password := secret.Data[ref.Key]
+    if len(password) == 0 {
+        return "", fmt.Errorf("replication source password secret %s has no key %s", ref.Name, ref.Key)
+    }
+    return string(password), nil
+}
+
+// reconcileReplicationSource makes the ready nodes of a cluster with a
+// replication source replicate the remote master, authenticating with its
+// password, or promotes the cluster when it is annotated for it. The nodes
+// forget the link when they restart, so it is checked on every reconcile.
+func (h *RedisClusterHandler) reconcileReplicationSource(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    source := cluster.Spec.ReplicationSource
+    if source == nil {
+        return nil
+    }
+    if cluster.ObjectMeta.Annotations[promoteAnnotation] == "true" {
+        return h.promoteCluster(ctx, namespace, cluster)
+    }
+    password, err := sourcePassword(namespace, source)
+    if err != nil {
+        return err
+    }
+
+    // Link each ready node to the remote master
+    host, port := source.Host, strconv.Itoa(int(sourcePort(source)))
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        info, err := getInfo(pod, "replication")
+        if err != nil {
+            return fmt.Errorf("reading replication info of pod %s: %v", pod.Name, err)
+        }
+        client := newRedisClient(pod)
+        err = configSet(client, "masterauth", password)
+        if err == nil && (info["role"] != "slave" || info["master_host"] != host || info["master_port"] != port) {
+            err = client.SlaveOf(host, port).Err()
+            if err == nil {
+                h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonReplicationSource, "Replicating pod %s from %s", pod.Name, net.JoinHostPort(host, port))
+            }
+        }
+        client.Close()
+        if err != nil {
+            return fmt.Errorf("replicating pod %s from %s: %v", pod.Name, net.JoinHostPort(host, port), err)
+        }
+    }
+    return nil
+}
+
+// promoteCluster breaks the link to the remote master: the node that
+// replicated the most becomes the master of the cluster and the other ready
+// nodes replicate it. The replication source and the annotation are removed
+// from the RedisCluster along with recording the new master, so the link is
+// not set up again.
+func (h *RedisClusterHandler) promoteCluster(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+
+    // Authenticate the replicas to the local master again
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        client := newRedisClient(pod)
+        err = configSet(client, "masterauth", podPassword(pod))
+        client.Close()
+        if err != nil {
+            return fmt.Errorf("resetting the master password of pod %s: %v", pod.Name, err)
+        }
+    }
+
+    // Promote the best replica, recording it with the spec change
+    source := net.JoinHostPort(cluster.Spec.ReplicationSource.Host, strconv.Itoa(int(sourcePort(cluster.Spec.ReplicationSource))))
+    cluster.Spec.ReplicationSource = nil
+    delete(cluster.ObjectMeta.Annotations, promoteAnnotation)
+    now := metav1.Now()
+    cluster.Status.PromotedAt = &now
+    cluster.Status.MasterNode = ""
+    err = promoteReplica(cluster, pods.Items)
+    if err != nil {
+        return err
+    }
+    h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonPromoted, "Promoted %s to master, breaking the link to %s", cluster.Status.MasterNode, source)
+    return nil
+}
+
+// setSourceStatus records the state of the link of the ready nodes to the
+// remote master, from their INFO replication fields. The status is dropped
+// when the cluster has no replication source.
+func setSourceStatus(cluster *RedisCluster, replication map[string]map[string]string) {
+    source := cluster.Spec.ReplicationSource
+    if source == nil {
+        cluster.Status.Source = nil
+        return
+    }
+
+    status := &RedisSourceStatus{
+        Address:    net.JoinHostPort(source.Host, strconv.Itoa(int(sourcePort(source)))),
+        LinkStatus: SourceLinkUp,
+    }
+    for name, info := range replication {
+        if info["role"] != "slave" || info["master_host"] != source.Host || info["master_link_status"] != "up" {
+            status.LinkStatus = SourceLinkDown
+            status.DownNodes = append(status.DownNodes, name)
+            continue
+        }
+        status.LinkedNodes++
+        lag, _ := strconv.Atoi(info["master_last_io_seconds_ago"])
+        if int32(lag) > status.LagSeconds {
+            status.LagSeconds = int32(lag)
+        }
+    }
+    if len(replication) == 0 {
+        status.LinkStatus = SourceLinkDown
+    }
+    sort.Strings(status.DownNodes)
+    cluster.Status.Source = status
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/go-redis/redis"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+    // defaultHealthCheckTimeout is how long, in seconds, the health check
+    // waits for a node to answer when the spec does not set it.
+    defaultHealthCheckTimeout = 1
+
+    // defaultMaxReplicationLag is how long, in seconds, a replica may go
+    // without hearing from its master before it is reported unhealthy.
+    defaultMaxReplicationLag = 30
+
+    // lastSeenRefreshPeriod is how old LastSeen gets before a health check
+    // refreshes it, so that every reconcile does not rewrite the status. It
+    // stays well below the failover grace period.
+    lastSeenRefreshPeriod = 30 * time.Second
+)
+
+// healthCheckTimeout returns how long the health check waits for a node.
+func healthCheckTimeout(spec RedisClusterSpec) time.Duration {
+    if spec.HealthCheck == nil || spec.HealthCheck.TimeoutSeconds < 1 {
+        return defaultHealthCheckTimeout * time.Second
+    }
+    return time.Duration(spec.HealthCheck.TimeoutSeconds) * time.Second
+}
+
+// maxReplicationLag returns the replication lag above which a replica is
+// reported unhealthy.
+func maxReplicationLag(spec RedisClusterSpec) int32 {
+    if spec.HealthCheck == nil || spec.HealthCheck.MaxLagSeconds < 1 {
+        return defaultMaxReplicationLag
+    }
+    return spec.HealthCheck.MaxLagSeconds
+}
+
+// seenNow returns the time a node answering now was last seen, keeping the
+// previous time while it is more recent than lastSeenRefreshPeriod.
+func seenNow(previous *metav1.Time) *metav1.Time {
+    if previous != nil && time.Since(previous.Time) < lastSeenRefreshPeriod {
+        return previous
+    }
+    now := metav1.Now()
+    return &now
+}
+
+// checkNodeHealth dials the Redis server of the pod and reports its health:
+// whether it answers PING, is loading its dataset, and for replicas how long
+// ago it heard from its master. It does not rely on the pod readiness or on
+// the exporter, so it keeps working while those are misconfigured.
+func checkNodeHealth(spec RedisClusterSpec, pod *corev1.Pod, previous *RedisNodeHealth) RedisNodeHealth {
+    health := RedisNodeHealth{Name: pod.Name}
+    if previous != nil {
+        health.LastSeen = previous.LastSeen
+    }
+    if pod.Status.PodIP == "" {
+        health.Message = "The pod has no IP address"
+        return health
+    }
+    health.Address = podAddress(pod)
+
+    timeout := healthCheckTimeout(spec)
+    client := redis.NewClient(&redis.Options{
+        Addr:         health.Address,
+        Password:     podPassword(pod),
+        TLSConfig:    podTLSConfig(pod),
+        DialTimeout:  timeout,
+        ReadTimeout:  timeout,
+        WriteTimeout: timeout,
+        MaxRetries:   -1,
+    })
+    defer client.Close()
+
+    // A node loading its dataset answers PING with a LOADING error
+    err := client.Ping().Err()
+    if err != nil && strings.HasPrefix(err.Error(), "LOADING") {
+        health.LastSeen = seenNow(health.LastSeen)
+        health.Loading = true
+        health.Message = "The node is loading its dataset"
+        return health
+    }
+    if err != nil {
+        health.Message = fmt.Sprintf("The node does not answer PING: %v", err)
+        return health
+    }
+    health.LastSeen = seenNow(health.LastSeen)
+
+    // Read the role, the replication lag and the memory fragmentation
+    replication, err := client.Info("replication").Result()
+    if err != nil {
+        health.Message = fmt.Sprintf("Reading INFO replication: %v", err)
+        return health
+    }
+    memory, err := client.Info("memory").Result()
+    if err != nil {
+        health.Message = fmt.Sprintf("Reading INFO memory: %v", err)
+        return health
+    }
+    info := parseInfo(replication)
+    health.Role = info["role"]
+    health.FragmentationRatio = parseInfo(memory)["mem_fragmentation_ratio"]
+
+    // A replica is healthy while it is linked to a master it heard from recently
+    if health.Role == "slave" {
+        if info["master_link_status"] != "up" {
+            health.Message = "The replica is not linked to its master"
+            return health
+        }
+        lag, _ := strconv.Atoi(info["master_last_io_seconds_ago"])
+        health.LagSeconds = int32(lag)
+        if health.LagSeconds > maxReplicationLag(spec) {
+            health.Message = fmt.Sprintf("The replica last heard from its master %ds ago", health.LagSeconds)
+            return health
+        }
+    }
+
+    health.Healthy = true
+    return health
+}
+
+// checkNodesHealth checks the health of all the pods of the cluster, keeping
+// when each node was last seen from the previous status.
+func checkNodesHealth(cluster *RedisCluster, pods []corev1.Pod) []RedisNodeHealth {
+    previous := map[string]*RedisNodeHealth{}
+    for i := range cluster.Status.Nodes {
+        previous[cluster.Status.Nodes[i].Name] = &cluster.Status.Nodes[i]
+    }
+    nodes := []RedisNodeHealth{}
+    for i := range pods {
+        nodes = append(nodes, checkNodeHealth(cluster.Spec, &pods[i], previous[pods[i].Name]))
+    }
+    return nodes
+}
+
+// healthyNodes returns the number of healthy nodes.
+func healthyNodes(nodes []RedisNodeHealth) int {
+    healthy := 0
+    for _, node := range nodes {
+        if node.Healthy {
+            healthy++
+        }
+    }
+    return healthy
+}
+
+// nodeHealth returns the health of the named node, or nil if it was not checked.
+func nodeHealth(nodes []RedisNodeHealth, name string) *RedisNodeHealth {
+    for i := range nodes {
+        if nodes[i].Name == name {
+            return &nodes[i]
+        }
+    }
+    return nil
+}
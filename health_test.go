@@ -0,0 +1,81 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+    "time"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckNodesHealthNamesThePods(t *testing.T) {
+    seen := metav1.NewTime(time.Now().Add(-time.Minute))
+    cluster := newTestCluster(2)
+    cluster.Status.Nodes = []RedisNodeHealth{
+        {Name: "cache-7d4f9-abcde", Healthy: true, LastSeen: &seen},
+        {Name: "cache-7d4f9-gone", Healthy: true, LastSeen: &seen},
+    }
+    pods := []corev1.Pod{
+        {ObjectMeta: metav1.ObjectMeta{Name: "cache-7d4f9-abcde"}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "cache-7d4f9-fghij"}},
+    }
+
+    nodes := checkNodesHealth(cluster, pods)
+    names := []string{}
+    for _, node := range nodes {
+        names = append(names, node.Name)
+    }
+    if !reflect.DeepEqual(names, []string{"cache-7d4f9-abcde", "cache-7d4f9-fghij"}) {
+        t.Fatalf("got nodes %v, want the pods", names)
+    }
+    for _, node := range nodes {
+        if node.Healthy {
+            t.Errorf("node %s without an IP address is reported healthy", node.Name)
+        }
+    }
+    if nodes[0].LastSeen == nil || !nodes[0].LastSeen.Equal(&seen) {
+        t.Errorf("got last seen %v, want it kept from the previous status", nodes[0].LastSeen)
+    }
+    if nodes[1].LastSeen != nil {
+        t.Errorf("got last seen %v for a new pod, want none", nodes[1].LastSeen)
+    }
+}
+
+func TestHealthyNodes(t *testing.T) {
+    nodes := []RedisNodeHealth{
+        {Name: "cache-0", Healthy: true},
+        {Name: "cache-1"},
+        {Name: "cache-2", Healthy: true},
+    }
+    if got := healthyNodes(nodes); got != 2 {
+        t.Errorf("got %d healthy nodes, want 2", got)
+    }
+    if health := nodeHealth(nodes, "cache-1"); health == nil || health.Name != "cache-1" {
+        t.Errorf("got %v, want the health of cache-1", health)
+    }
+    if health := nodeHealth(nodes, "cache-3"); health != nil {
+        t.Errorf("got %v for an unknown node, want nil", health)
+    }
+}
+
+func TestParseInfo(t *testing.T) {
+    info := "# Replication\r\nrole:slave\r\nmaster_host:10.0.0.1\r\nmaster_link_status:up\r\n\r\n"
+    want := map[string]string{"role": "slave", "master_host": "10.0.0.1", "master_link_status": "up"}
+    if got := parseInfo(info); !reflect.DeepEqual(got, want) {
+        t.Errorf("got %v, want %v", got, want)
+    }
+}
+
+func TestSeenNow(t *testing.T) {
+    recent := metav1.NewTime(time.Now().Add(-10 * time.Second))
+    if got := seenNow(&recent); got != &recent {
+        t.Errorf("got LastSeen %v, want the recent %v kept", got, recent)
+    }
+    old := metav1.NewTime(time.Now().Add(-time.Minute))
+    if got := seenNow(&old); got == &old || time.Since(got.Time) > time.Second {
+        t.Errorf("got LastSeen %v, want it refreshed", got)
+    }
+    if got := seenNow(nil); got == nil {
+        t.Error("got no LastSeen for a node answering")
+    }
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+    "fmt"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    appsv1 "k8s.io/api/apps/v1"
+    batchv1 "k8s.io/api/batch/v1"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+    // hibernationSnapshot is the name of the snapshot taken when a cluster
+    // without durable storage hibernates, under the backup prefix.
+    hibernationSnapshot = "hibernation.rdb"
+
+    // ReasonHibernated is the reason of the event recorded when a cluster
+    // starts hibernating.
+    ReasonHibernated = "Hibernated"
+
+    // ReasonResumed is the reason of the event recorded when a hibernated
+    // cluster resumes.
+    ReasonResumed = "Resumed"
+)
+
+// durableStorage reports whether the data of the nodes outlives their pods.
+func durableStorage(spec RedisClusterSpec) bool {
+    return spec.Storage != nil && !spec.Storage.Ephemeral
+}
+
+// hibernationJobName returns the name of the job snapshotting a cluster
+// before it hibernates.
+func hibernationJobName(cluster *RedisCluster) string {
+    return cluster.ObjectMeta.Name + "-hibernate"
+}
+
+// hibernationKey returns the key of the snapshot taken when the cluster
+// hibernates.
+func hibernationKey(cluster *RedisCluster) string {
+    return backupKeyPrefix(cluster) + "/" + hibernationSnapshot
+}
+
+// newHibernationJob builds the job snapshotting the cluster before it
+// hibernates. It runs like a backup, with the same environment locating the
+// bucket, but uploads the snapshot under a fixed key for the cluster to
+// restore it when it resumes.
+func newHibernationJob(cluster *RedisCluster, namespace string) *batchv1.Job {
+    template := newBackupCronJob(cluster, namespace).Spec.JobTemplate
+    source := backupMountPath + "/" + backupFile
+    destination := `"s3://$` + bucketEnv + `/$` + keyEnv + `/` + hibernationSnapshot + `"`
+    script := s3CopyScript(source, destination, cluster.Spec.Backup.Endpoint)
+    template.Spec.Template.Spec.Containers[0].Command = []string{"sh", "-c", script}
+    return &batchv1.Job{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            hibernationJobName(cluster),
+            Namespace:       namespace,
+            Labels:          template.Labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: template.Spec,
+    }
+}
+
+// hibernationPhase returns the phase of a hibernated cluster, which is
+// Hibernated once its pods are gone.
+func hibernationPhase(pods int) string {
+    if pods == 0 {
+        return PhaseHibernated
+    }
+    return PhaseHibernating
+}
+
+// hibernate scales the workloads of the cluster to zero, keeping its volume
+// claims, Services and Secrets. The data of a cluster without durable
+// storage is first snapshotted to the backup bucket when the spec has one;
+// a failed snapshot keeps the cluster running.
+func (h *RedisClusterHandler) hibernate(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    status := cluster.Status.Hibernation
+    if status == nil {
+        now := metav1.Now()
+        status = &RedisHibernationStatus{Since: &now}
+        if !durableStorage(cluster.Spec) && cluster.Spec.Backup == nil {
+            h.recorder.Event(cluster, corev1.EventTypeWarning, ReasonHibernated, "Hibernating without durable storage or backup, the data is not kept")
+        } else {
+            h.recorder.Event(cluster, corev1.EventTypeNormal, ReasonHibernated, "Hibernating, keeping the volume claims, Services and Secrets")
+        }
+    }
+    cluster.Status.Hibernation = status
+
+    // Snapshot the data the volumes do not keep before removing the pods
+    if !durableStorage(cluster.Spec) && cluster.Spec.Backup != nil && status.SnapshotKey == "" {
+        done, err := h.snapshotForHibernation(namespace, cluster)
+        if err != nil {
+            return err
+        }
+        if !done {
+            return updateStatus(cluster)
+        }
+        status.SnapshotKey = hibernationKey(cluster)
+    }
+
+    // Scale the workloads to zero and suspend the backups, which have no
+    // master to snapshot
+    for _, name := range []string{cluster.ObjectMeta.Name, sentinelName(cluster)} {
+        err := scaleToZero(namespace, name)
+        if err != nil {
+            return err
+        }
+    }
+    err := suspendBackups(namespace, cluster, true)
+    if err != nil {
+        return err
+    }
+
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    setPhase(cluster, hibernationPhase(len(pods.Items)), 0)
+    meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+        Type:    ConditionHibernated,
+        Status:  metav1.ConditionTrue,
+        Reason:  hibernationPhase(len(pods.Items)),
+        Message: "The cluster is scaled to zero on request",
+    })
+    return updateStatus(cluster)
+}
+
+// snapshotForHibernation runs the hibernation snapshot job and reports
+// whether it succeeded, recording its progress in the Hibernated condition.
+func (h *RedisClusterHandler) snapshotForHibernation(namespace string, cluster *RedisCluster) (bool, error) {
+    job := newHibernationJob(cluster, namespace)
+    existing := &batchv1.Job{}
+    err := sdk.Get(existing, namespace, job.Name)
+    if apierrors.IsNotFound(err) {
+        err = sdk.Create(job)
+        existing = job
+    }
+    if err != nil {
+        return false, err
+    }
+
+    condition := metav1.Condition{
+        Type:    ConditionHibernated,
+        Status:  metav1.ConditionFalse,
+        Reason:  "Snapshotting",
+        Message: fmt.Sprintf("Waiting for job %s to snapshot the data before scaling to zero", job.Name),
+    }
+    switch {
+    case existing.Status.Succeeded > 0:
+        return true, deleteIfExists(&batchv1.Job{}, namespace, job.Name)
+    case jobFailed(existing):
+        condition.Reason = "SnapshotFailed"
+        condition.Message = fmt.Sprintf("Job %s failed to snapshot the data, the cluster keeps running; delete the job to retry", job.Name)
+    }
+    setPhase(cluster, PhaseHibernating, int(cluster.Status.ReadyReplicas))
+    meta.SetStatusCondition(&cluster.Status.Conditions, condition)
+    return false, nil
+}
+
+// resume brings a hibernated cluster back. A cluster snapshotted when it
+// hibernated restores the snapshot through a RedisClusterRestore, and stays
+// at zero pods until the restore holds the cluster, so that the pods start
+// from the snapshot. It reports whether the cluster waits for the restore.
+func (h *RedisClusterHandler) resume(namespace string, cluster *RedisCluster) (bool, error) {
+    status := cluster.Status.Hibernation
+    if status == nil {
+        return false, nil
+    }
+
+    // Restore the snapshot taken when hibernating
+    if status.SnapshotKey != "" && cluster.Spec.Backup != nil {
+        restore := newResumeRestore(cluster, namespace)
+        existing := &RedisClusterRestore{}
+        err := sdk.Get(existing, namespace, restore.ObjectMeta.Name)
+        if apierrors.IsNotFound(err) {
+            return true, sdk.Create(restore)
+        }
+        if err != nil {
+            return false, err
+        }
+        if existing.Status.Phase == "" {
+            return true, nil
+        }
+    }
+
+    err := suspendBackups(namespace, cluster, false)
+    if err != nil {
+        return false, err
+    }
+    cluster.Status.Hibernation = nil
+    meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+        Type:    ConditionHibernated,
+        Status:  metav1.ConditionFalse,
+        Reason:  ReasonResumed,
+        Message: "The cluster runs at its full size",
+    })
+    err = updateStatus(cluster)
+    if err != nil {
+        return false, err
+    }
+    h.recorder.Event(cluster, corev1.EventTypeNormal, ReasonResumed, "Resuming from hibernation")
+    return false, nil
+}
+
+// newResumeRestore builds the restore of the snapshot taken when the cluster
+// hibernated, named after the start of the hibernation.
+func newResumeRestore(cluster *RedisCluster, namespace string) *RedisClusterRestore {
+    spec := cluster.Spec.Backup
+    return &RedisClusterRestore{
+        TypeMeta: metav1.TypeMeta{
+            APIVersion: SchemeGroupVersion.String(),
+            Kind:       "RedisClusterRestore",
+        },
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            fmt.Sprintf("%s-resume-%d", cluster.ObjectMeta.Name, cluster.Status.Hibernation.Since.Unix()),
+            Namespace:       namespace,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: RedisClusterRestoreSpec{
+            ClusterName:          cluster.ObjectMeta.Name,
+            Bucket:               spec.Bucket,
+            Key:                  cluster.Status.Hibernation.SnapshotKey,
+            Endpoint:             spec.Endpoint,
+            Region:               spec.Region,
+            CredentialsSecretRef: spec.CredentialsSecretRef,
+            Image:                spec.Image,
+        },
+    }
+}
+
+// scaleToZero scales a StatefulSet of the cluster to zero pods.
+func scaleToZero(namespace, name string) error {
+    statefulSet := &appsv1.StatefulSet{}
+    err := sdk.Get(statefulSet, namespace, name)
+    if apierrors.IsNotFound(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas == 0 {
+        return nil
+    }
+    zero := int32(0)
+    statefulSet.Spec.Replicas = &zero
+    return sdk.Update(statefulSet)
+}
+
+// suspendBackups suspends or resumes the backup CronJob of the cluster.
+func suspendBackups(namespace string, cluster *RedisCluster, suspend bool) error {
+    cronJob := &batchv1.CronJob{}
+    err := sdk.Get(cronJob, namespace, backupName(cluster))
+    if apierrors.IsNotFound(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend == suspend {
+        return nil
+    }
+    cronJob.Spec.Suspend = &suspend
+    return sdk.Update(cronJob)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+    "fmt"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// defaultRedisImage is the Redis image used when the spec does not set one.
+const defaultRedisImage = "redis:latest"
+
+// defaultRedisRepository is the repository the version of the spec is
+// pulled from when the spec does not set an image.
+const defaultRedisRepository = "redis"
+
+// redisImage returns the Redis image of the spec, tagged with its version
+// when it sets one.
+func redisImage(spec RedisClusterSpec) string {
+    if spec.Version != "" {
+        if spec.Image == "" {
+            return defaultRedisRepository + ":" + spec.Version
+        }
+        return spec.Image + ":" + spec.Version
+    }
+    if spec.Image == "" {
+        return defaultRedisImage
+    }
+    return spec.Image
+}
+
+// validateImagePullSecrets checks that the image pull secrets of the spec exist.
+func validateImagePullSecrets(namespace string, spec RedisClusterSpec) error {
+    for _, ref := range spec.ImagePullSecrets {
+        err := sdk.Get(&corev1.Secret{}, namespace, ref.Name)
+        if apierrors.IsNotFound(err) {
+            return fmt.Errorf("image pull secret %s not found", ref.Name)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
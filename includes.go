@@ -0,0 +1,143 @@
+package main
+
+import (
+    "fmt"
+    "path"
+    "strings"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+    // configFilePath is where the config file ConfigMap is mounted.
+    configFilePath = "/usr/local/etc/redis/redis.conf"
+
+    // configFileVolumeName is the name of the config file volume.
+    configFileVolumeName = "config"
+
+    // configIncludeDir is where the config include ConfigMaps are mounted.
+    configIncludeDir = "/usr/local/etc/redis/include"
+
+    // configIncludeKey is the ConfigMap key holding an included config.
+    configIncludeKey = "redis.conf"
+)
+
+// configIncludePath returns the path of an included config file.
+func configIncludePath(name string) string {
+    return path.Join(configIncludeDir, name, configIncludeKey)
+}
+
+// configFileVolume returns the volume and mount of the config file.
+func configFileVolume(spec RedisClusterSpec) (corev1.Volume, corev1.VolumeMount) {
+    volume := corev1.Volume{
+        Name: configFileVolumeName,
+        VolumeSource: corev1.VolumeSource{
+            ConfigMap: &corev1.ConfigMapVolumeSource{
+                LocalObjectReference: *spec.ConfigMapRef,
+            },
+        },
+    }
+    mount := corev1.VolumeMount{
+        Name:      configFileVolumeName,
+        MountPath: configFilePath,
+        SubPath:   configIncludeKey,
+        ReadOnly:  true,
+    }
+    return volume, mount
+}
+
+// validateConfigFile checks that the config file ConfigMap exists and holds a
+// redis.conf key.
+func validateConfigFile(namespace string, spec RedisClusterSpec) error {
+    if spec.ConfigMapRef == nil {
+        return nil
+    }
+
+    configMap := &corev1.ConfigMap{}
+    err := getObject(configMap, namespace, spec.ConfigMapRef.Name)
+    if apierrors.IsNotFound(err) {
+        return fmt.Errorf("config ConfigMap %s not found", spec.ConfigMapRef.Name)
+    }
+    if err != nil {
+        return err
+    }
+    if _, ok := configMap.Data[configIncludeKey]; !ok {
+        return fmt.Errorf("config ConfigMap %s has no %s key", spec.ConfigMapRef.Name, configIncludeKey)
+    }
+    return nil
+}
+
+// configIncludeVolumes returns the volumes and mounts of the config includes.
+func configIncludeVolumes(spec RedisClusterSpec) ([]corev1.Volume, []corev1.VolumeMount) {
+    volumes := []corev1.Volume{}
+    mounts := []corev1.VolumeMount{}
+    for i, name := range spec.ConfigIncludes {
+        volumeName := fmt.Sprintf("config-include-%d", i)
+        volumes = append(volumes, corev1.Volume{
+            Name: volumeName,
+            VolumeSource: corev1.VolumeSource{
+                ConfigMap: &corev1.ConfigMapVolumeSource{
+                    LocalObjectReference: corev1.LocalObjectReference{Name: name},
+                },
+            },
+        })
+        mounts = append(mounts, corev1.VolumeMount{
+            Name:      volumeName,
+            MountPath: path.Join(configIncludeDir, name),
+            ReadOnly:  true,
+        })
+    }
+    return volumes, mounts
+}
+
+// validateConfigIncludes checks that each config include is listed once and
+// references an existing ConfigMap with a redis.conf key leaving the managed
+// directives alone.
+func validateConfigIncludes(namespace string, spec RedisClusterSpec) error {
+    seen := map[string]bool{}
+    for _, name := range spec.ConfigIncludes {
+        if name == "" {
+            return fmt.Errorf("configIncludes contains an empty ConfigMap name")
+        }
+        if seen[name] {
+            return fmt.Errorf("configIncludes lists ConfigMap %s more than once, the include order would be ambiguous", name)
+        }
+        seen[name] = true
+
+        // Check the ConfigMap exists and holds a config
+        configMap := &corev1.ConfigMap{}
+        err := sdk.Get(configMap, namespace, name)
+        if apierrors.IsNotFound(err) {
+            return fmt.Errorf("config include ConfigMap %s not found", name)
+        }
+        if err != nil {
+            return err
+        }
+        config, ok := configMap.Data[configIncludeKey]
+        if !ok {
+            return fmt.Errorf("config include ConfigMap %s has no %s key", name, configIncludeKey)
+        }
+        err = validateIncludedConfig(name, config)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// validateIncludedConfig checks that an included config sets none of the
+// directives the operator manages, which the spec config cannot set either.
+func validateIncludedConfig(name, config string) error {
+    for _, line := range strings.Split(config, "\n") {
+        fields := strings.Fields(line)
+        if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+            continue
+        }
+        key := strings.ToLower(fields[0])
+        if forbiddenConfigKeys[key] || strings.HasPrefix(key, "tls-") {
+            return fmt.Errorf("config include ConfigMap %s sets %s, which is managed by the operator", name, key)
+        }
+    }
+    return nil
+}
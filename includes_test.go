@@ -0,0 +1,98 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// findVolume returns the named volume of the pod spec, or nil.
+func findVolume(spec corev1.PodSpec, name string) *corev1.Volume {
+    for i := range spec.Volumes {
+        if spec.Volumes[i].Name == name {
+            return &spec.Volumes[i]
+        }
+    }
+    return nil
+}
+
+// findMount returns the mount of the named volume in the container, or nil.
+func findMount(container corev1.Container, name string) *corev1.VolumeMount {
+    for i := range container.VolumeMounts {
+        if container.VolumeMounts[i].Name == name {
+            return &container.VolumeMounts[i]
+        }
+    }
+    return nil
+}
+
+func TestConfigFileVolume(t *testing.T) {
+    cluster := newTestCluster(3)
+    template := newPodTemplate(cluster, nil)
+    if findVolume(template.Spec, configFileVolumeName) != nil || template.Spec.Containers[0].Command != nil {
+        t.Errorf("got a config file without a ConfigMap in the spec")
+    }
+
+    cluster.Spec.ConfigMapRef = &corev1.LocalObjectReference{Name: "cache-conf"}
+    template = newPodTemplate(cluster, nil)
+    container := template.Spec.Containers[0]
+    volume := findVolume(template.Spec, configFileVolumeName)
+    if volume == nil || volume.ConfigMap == nil || volume.ConfigMap.Name != "cache-conf" {
+        t.Fatalf("got volume %v, want the cache-conf ConfigMap", volume)
+    }
+    mount := findMount(container, configFileVolumeName)
+    if mount == nil || mount.MountPath != configFilePath || mount.SubPath != configIncludeKey || !mount.ReadOnly {
+        t.Errorf("got mount %v, want %s mounted read-only at %s", mount, configIncludeKey, configFilePath)
+    }
+    if !reflect.DeepEqual(container.Command, []string{"redis-server"}) || len(container.Args) == 0 || container.Args[0] != configFilePath {
+        t.Errorf("got command %v and args %v, want redis-server %s", container.Command, container.Args, configFilePath)
+    }
+}
+
+func TestValidateConfigFile(t *testing.T) {
+    spec := RedisClusterSpec{ConfigMapRef: &corev1.LocalObjectReference{Name: "cache-conf"}}
+    configMap := &corev1.ConfigMap{
+        ObjectMeta: metav1.ObjectMeta{Name: "cache-conf", Namespace: "default"},
+        Data:       map[string]string{"other.conf": "maxmemory 1gb\n"},
+    }
+
+    newFakeClient(t)
+    if err := validateConfigFile("default", spec); err == nil {
+        t.Error("got no error for a missing ConfigMap")
+    }
+    newFakeClient(t, configMap)
+    if err := validateConfigFile("default", spec); err == nil {
+        t.Errorf("got no error for a ConfigMap without a %s key", configIncludeKey)
+    }
+    configMap.Data[configIncludeKey] = "maxmemory 1gb\n"
+    newFakeClient(t, configMap)
+    if err := validateConfigFile("default", spec); err != nil {
+        t.Errorf("got %v, want the ConfigMap accepted", err)
+    }
+}
+
+func TestValidateIncludedConfig(t *testing.T) {
+    tests := []struct {
+        name   string
+        config string
+        valid  bool
+    }{
+        {"tunables and comments", "# tuning\nhz 20\n\ntimeout 300\n", true},
+        {"managed directive", "hz 20\nrequirepass secret\n", false},
+        {"uppercase managed directive", "PORT 6380\n", false},
+        {"indented tls directive", "  tls-port 6380\n", false},
+        {"commented managed directive", "# requirepass secret\n", true},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            err := validateIncludedConfig("cache-tuning", test.config)
+            if test.valid && err != nil {
+                t.Errorf("got %v, want no error", err)
+            }
+            if !test.valid && err == nil {
+                t.Error("got no error, want the include rejected")
+            }
+        })
+    }
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+    "reflect"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// updateKeyStats records the evicted and expired key counters from INFO STATS
+// of the nodes, with their growth since the last reconcile computed node by
+// node.
+func updateKeyStats(cluster *RedisCluster, stats map[string]map[string]string) {
+    keys := &RedisKeyStats{
+        EvictedKeys:     sumInfoField(stats, "evicted_keys"),
+        ExpiredKeys:     sumInfoField(stats, "expired_keys"),
+        NodeEvictedKeys: infoCounters(stats, "evicted_keys"),
+        NodeExpiredKeys: infoCounters(stats, "expired_keys"),
+        ObservedAt:      metav1.Now(),
+    }
+
+    // Keep the last observation while the counters did not move, with no
+    // growth to record
+    previous := cluster.Status.Keys
+    if previous != nil && reflect.DeepEqual(previous.NodeEvictedKeys, keys.NodeEvictedKeys) && reflect.DeepEqual(previous.NodeExpiredKeys, keys.NodeExpiredKeys) {
+        previous.EvictedKeysDelta = 0
+        previous.ExpiredKeysDelta = 0
+        return
+    }
+    cluster.Status.Keys = keys
+    if previous == nil {
+        return
+    }
+
+    // Record the growth since the last observation
+    keys.EvictedKeysDelta = nodeCountersDelta(previous.NodeEvictedKeys, keys.NodeEvictedKeys)
+    keys.ExpiredKeysDelta = nodeCountersDelta(previous.NodeExpiredKeys, keys.NodeExpiredKeys)
+}
+
+// observeKeyStats adds the growth of the key counters to the key metrics. It
+// runs once the status holding the growth is written, so that a failed
+// update does not count the same growth twice.
+func observeKeyStats(namespace string, cluster *RedisCluster) {
+    keys := cluster.Status.Keys
+    if keys == nil {
+        return
+    }
+    evictedKeysTotal.WithLabelValues(namespace, cluster.ObjectMeta.Name).Add(float64(keys.EvictedKeysDelta))
+    expiredKeysTotal.WithLabelValues(namespace, cluster.ObjectMeta.Name).Add(float64(keys.ExpiredKeysDelta))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "sync/atomic"
+    "time"
+    "github.com/operator-framework/operator-sdk/pkg/k8sclient"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/tools/leaderelection"
+    "k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+    // leaseName is the Lease the replicas of the operator compete for.
+    leaseName = "yaro-leader"
+
+    // operatorNamespaceEnv is the namespace the operator runs in, which
+    // holds the Lease.
+    operatorNamespaceEnv = "OPERATOR_NAMESPACE"
+
+    // podNameEnv is the name of the pod of the operator, identifying the
+    // instance in the Lease.
+    podNameEnv = "POD_NAME"
+
+    leaseDuration = 15 * time.Second
+    renewDeadline = 10 * time.Second
+    retryPeriod   = 2 * time.Second
+)
+
+var (
+    // electing is set once the instance takes part in the leader election.
+    electing int32
+
+    // leading is set while the instance holds the Lease.
+    leading int32
+)
+
+// operatorIdentity returns the identity of the operator instance, the name
+// of its pod or its host name.
+func operatorIdentity() string {
+    if name := os.Getenv(podNameEnv); name != "" {
+        return name
+    }
+    hostname, _ := os.Hostname()
+    return hostname
+}
+
+// isLeader reports whether the instance may reconcile: it holds the Lease,
+// or it runs without leader election.
+func isLeader() bool {
+    return atomic.LoadInt32(&electing) == 0 || atomic.LoadInt32(&leading) == 1
+}
+
+// setLeading records whether the instance holds the Lease.
+func setLeading(identity string, lead bool) {
+    value := 0.0
+    if lead {
+        atomic.StoreInt32(&leading, 1)
+        value = 1
+        logger.Info("Started leading", "identity", identity)
+    } else {
+        atomic.StoreInt32(&leading, 0)
+        logger.Info("Not leading", "identity", identity)
+    }
+    leaderGauge.WithLabelValues(identity).Set(value)
+}
+
+// RunWithLeaderElection waits for the instance to hold the leader Lease and
+// then calls run, so that only one of several replicas of the operator
+// issues failovers and deletes pods. It returns once the instance lost the
+// Lease; main exits then and leaves the reconciles to the new leader.
+func RunWithLeaderElection(run func()) error {
+    namespace := os.Getenv(operatorNamespaceEnv)
+    if namespace == "" {
+        return fmt.Errorf("%s must be set for the leader election", operatorNamespaceEnv)
+    }
+    identity := operatorIdentity()
+    if identity == "" {
+        return fmt.Errorf("%s must be set for the leader election", podNameEnv)
+    }
+
+    atomic.StoreInt32(&electing, 1)
+    setLeading(identity, false)
+    lock := &resourcelock.LeaseLock{
+        LeaseMeta: metav1.ObjectMeta{
+            Name:      leaseName,
+            Namespace: namespace,
+        },
+        Client: k8sclient.GetKubeClient().CoordinationV1(),
+        LockConfig: resourcelock.ResourceLockConfig{
+            Identity: identity,
+        },
+    }
+    leaderelection.RunOrDie(context.Background(), leaderelection.LeaderElectionConfig{
+        Lock:          lock,
+        LeaseDuration: leaseDuration,
+        RenewDeadline: renewDeadline,
+        RetryPeriod:   retryPeriod,
+        Callbacks: leaderelection.LeaderCallbacks{
+            OnStartedLeading: func(context.Context) {
+                setLeading(identity, true)
+                run()
+            },
+            OnStoppedLeading: func() {
+                setLeading(identity, false)
+            },
+        },
+    })
+    return fmt.Errorf("instance %s lost the leader lease", identity)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "sync/atomic"
+    "github.com/go-logr/logr"
+    "github.com/go-logr/zapr"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    "go.uber.org/zap"
+    "go.uber.org/zap/zapcore"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+    // logLevel is the lowest level logged: debug, info, warn or error.
+    logLevel = flag.String("log-level", "info", "lowest level of the logs: debug, info, warn or error")
+
+    // logJSON writes the logs as JSON objects rather than text.
+    logJSON = flag.Bool("log-json", false, "write the logs as JSON")
+)
+
+// logger is the root logger of the operator. It discards the logs until
+// SetupLogging runs.
+var logger = logr.Discard()
+
+// reconcileCount numbers the reconciles, so that the lines of one reconcile
+// can be told apart from the next.
+var reconcileCount uint64
+
+// SetupLogging builds the logger from the log flags. main calls it after
+// parsing the flags.
+func SetupLogging() error {
+    var level zapcore.Level
+    err := level.UnmarshalText([]byte(*logLevel))
+    if err != nil {
+        return fmt.Errorf("log level %q is invalid, it must be debug, info, warn or error", *logLevel)
+    }
+
+    config := zap.NewDevelopmentConfig()
+    if *logJSON {
+        config = zap.NewProductionConfig()
+    }
+    config.Level = zap.NewAtomicLevelAt(level)
+    config.DisableStacktrace = true
+    zapLogger, err := config.Build()
+    if err != nil {
+        return err
+    }
+    logger = zapr.NewLogger(zapLogger)
+    return nil
+}
+
+// reconcileLogger returns the logger of a reconcile of the cluster, tagging
+// its lines with the cluster, a reconcile ID and the phase the cluster was
+// in when the reconcile started.
+func reconcileLogger(cluster *RedisCluster) logr.Logger {
+    id := atomic.AddUint64(&reconcileCount, 1)
+    return logger.WithValues("namespace", cluster.Namespace, "cluster", cluster.Name, "reconcile", id, "phase", cluster.Status.Phase)
+}
+
+// objectLogger returns the logger of an event on an object, tagging its
+// lines with the kind, namespace and name of the object.
+func objectLogger(object sdk.Object) logr.Logger {
+    meta, ok := object.(metav1.Object)
+    if !ok {
+        return logger
+    }
+    return logger.WithValues("kind", object.GetObjectKind().GroupVersionKind().Kind, "namespace", meta.GetNamespace(), "name", meta.GetName())
+}
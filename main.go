@@ -0,0 +1,64 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "os"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+)
+
+var (
+    // metricsAddr is the address the Prometheus metrics are served on.
+    metricsAddr = flag.String("metrics-addr", ":8383", "address the metrics are served on, empty to disable them")
+
+    // webhookAddr, webhookCertFile and webhookKeyFile serve the admission
+    // webhooks over TLS.
+    webhookAddr     = flag.String("webhook-addr", "", "address the admission webhooks are served on, empty to disable them")
+    webhookCertFile = flag.String("webhook-cert-file", "", "certificate of the admission webhooks")
+    webhookKeyFile  = flag.String("webhook-key-file", "", "private key of the admission webhooks")
+
+    // leaderElect runs the handler only while the instance holds the leader
+    // Lease, for operators running several replicas.
+    leaderElect = flag.Bool("leader-elect", false, "elect a leader among the replicas of the operator")
+)
+
+func main() {
+    flag.Parse()
+    err := SetupLogging()
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+    logger.Info("Starting the operator", "version", Version)
+
+    // Serve the metrics and the webhooks next to the handler
+    if *metricsAddr != "" {
+        go func() {
+            err := ServeMetrics(*metricsAddr)
+            logger.Error(err, "Serving the metrics failed", "address", *metricsAddr)
+            os.Exit(1)
+        }()
+    }
+    if *webhookAddr != "" {
+        go func() {
+            err := ServeWebhook(*webhookAddr, *webhookCertFile, *webhookKeyFile)
+            logger.Error(err, "Serving the webhooks failed", "address", *webhookAddr)
+            os.Exit(1)
+        }()
+    }
+
+    // Watch the resources and run the handler, on the leader only when
+    // several replicas run
+    RegisterWatches()
+    sdk.Handle(NewHandler())
+    if !*leaderElect {
+        sdk.Run(context.TODO())
+        return
+    }
+    err = RunWithLeaderElection(func() {
+        sdk.Run(context.TODO())
+    })
+    logger.Error(err, "Stopped reconciling")
+    os.Exit(1)
+}
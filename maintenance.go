@@ -0,0 +1,86 @@
+package main
+
+import (
+    "fmt"
+    "time"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+    // pauseWritesAnnotation requests writes to be paused for the given duration.
+    pauseWritesAnnotation = "yaro.io/pause-writes"
+
+    // maxWritePause bounds how long writes can be paused for.
+    maxWritePause = time.Hour
+)
+
+// reconcileWritePause pauses the writes of the cluster while the
+// pause-writes annotation is set. The pause is issued with a timeout, so Redis
+// resumes writes on its own even if the operator is not running when it expires.
+func reconcileWritePause(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    value, requested := cluster.ObjectMeta.Annotations[pauseWritesAnnotation]
+    pausedUntil := cluster.Status.WritesPausedUntil
+    if !requested && pausedUntil == nil {
+        return nil
+    }
+
+    // Get the RedisCluster
+    name := cluster.ObjectMeta.Name
+    current := &RedisCluster{}
+    err := sdk.Get(current, namespace, name)
+    if err != nil {
+        return err
+    }
+
+    switch {
+    case requested && pausedUntil == nil:
+        // Pause the writes for the requested duration
+        duration, err := time.ParseDuration(value)
+        if err != nil || duration <= 0 || duration > maxWritePause {
+            return fmt.Errorf("invalid %s annotation %q, it must be a duration of at most %s", pauseWritesAnnotation, value, maxWritePause)
+        }
+        err = pauseWrites(ctx, namespace, name, duration)
+        if err != nil {
+            return err
+        }
+        until := metav1.NewTime(time.Now().Add(duration))
+        current.Status.WritesPausedUntil = &until
+
+    case requested && time.Now().Before(pausedUntil.Time):
+        // Keep the writes paused until the pause expires
+        return nil
+
+    default:
+        // Resume the writes once the pause expired or was cancelled
+        err = resumeWrites(ctx, namespace, name)
+        if err != nil {
+            return err
+        }
+        delete(current.ObjectMeta.Annotations, pauseWritesAnnotation)
+        current.Status.WritesPausedUntil = nil
+    }
+
+    // The status subresource ignores the annotation, which is removed once
+    // the status is written
+    err = updateStatus(current)
+    if err != nil || current.Status.WritesPausedUntil != nil {
+        return err
+    }
+    return sdk.Update(current)
+}
+
+// pauseWrites pauses the writes on the ready nodes of the cluster.
+func pauseWrites(ctx sdk.Context, namespace, name string, duration time.Duration) error {
+    return forEachReadyNode(ctx, namespace, name, func(client *redis.Client) error {
+        return client.Do("CLIENT", "PAUSE", int64(duration/time.Millisecond), "WRITE").Err()
+    })
+}
+
+// resumeWrites resumes the writes on the ready nodes of the cluster.
+func resumeWrites(ctx sdk.Context, namespace, name string) error {
+    return forEachReadyNode(ctx, namespace, name, func(client *redis.Client) error {
+        return client.Do("CLIENT", "UNPAUSE").Err()
+    })
+}
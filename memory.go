@@ -0,0 +1,153 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReasonWritesWillBeRejected is the reason of the event recorded when nodes
+// with the noeviction policy near maxmemory.
+const ReasonWritesWillBeRejected = "WritesWillBeRejected"
+
+// writeRejectionThreshold is the fraction of maxmemory above which a node
+// with the noeviction policy is reported as about to reject writes.
+const writeRejectionThreshold = 0.9
+
+// maxMemoryLimitRatio is the largest fraction of the memory limit of the
+// container maxmemory may use. The rest is left to the replication and
+// persistence buffers and to fragmentation, which maxmemory does not count.
+const maxMemoryLimitRatio = 0.8
+
+// maxMemoryPolicies are the eviction policies Redis accepts.
+var maxMemoryPolicies = []string{
+    "noeviction",
+    "allkeys-lru",
+    "allkeys-lfu",
+    "allkeys-random",
+    "volatile-lru",
+    "volatile-lfu",
+    "volatile-random",
+    "volatile-ttl",
+}
+
+// maxMemoryArgs returns the redis-server arguments setting maxmemory and
+// maxmemory-policy.
+func maxMemoryArgs(spec RedisClusterSpec) []string {
+    args := []string{}
+    if spec.MaxMemory != nil {
+        args = append(args, "--maxmemory", strconv.FormatInt(spec.MaxMemory.Value(), 10))
+    }
+    if spec.MaxMemoryPolicy != "" {
+        args = append(args, "--maxmemory-policy", spec.MaxMemoryPolicy)
+    }
+    if spec.LFU != nil && spec.LFU.LogFactor != nil {
+        args = append(args, "--lfu-log-factor", strconv.Itoa(int(*spec.LFU.LogFactor)))
+    }
+    if spec.LFU != nil && spec.LFU.DecayTime != nil {
+        args = append(args, "--lfu-decay-time", strconv.Itoa(int(*spec.LFU.DecayTime)))
+    }
+    return args
+}
+
+// isLFUPolicy reports whether the eviction policy counts the accesses of the
+// keys, which the LFU settings tune.
+func isLFUPolicy(policy string) bool {
+    return strings.HasSuffix(policy, "-lfu")
+}
+
+// validateLFU checks that the LFU settings are only set with an LFU eviction
+// policy, on which they have an effect, and are not negative.
+func validateLFU(spec RedisClusterSpec) error {
+    if spec.LFU == nil {
+        return nil
+    }
+    if !isLFUPolicy(spec.MaxMemoryPolicy) {
+        return fmt.Errorf("lfu can only be set with the allkeys-lfu or volatile-lfu maxMemoryPolicy, not %q", spec.MaxMemoryPolicy)
+    }
+    if spec.LFU.LogFactor != nil && *spec.LFU.LogFactor < 0 {
+        return fmt.Errorf("lfu.logFactor %d must not be negative", *spec.LFU.LogFactor)
+    }
+    if spec.LFU.DecayTime != nil && *spec.LFU.DecayTime < 0 {
+        return fmt.Errorf("lfu.decayTime %d must not be negative", *spec.LFU.DecayTime)
+    }
+    return nil
+}
+
+// validateMaxMemory checks maxmemory and maxmemory-policy. maxmemory must
+// leave room below the memory limit of the container, or the node would be
+// killed for running out of memory before it starts evicting.
+func validateMaxMemory(spec RedisClusterSpec) error {
+    if spec.MaxMemoryPolicy != "" {
+        valid := false
+        for _, policy := range maxMemoryPolicies {
+            if spec.MaxMemoryPolicy == policy {
+                valid = true
+            }
+        }
+        if !valid {
+            return fmt.Errorf("maxMemoryPolicy %s is invalid, it must be one of %s", spec.MaxMemoryPolicy, strings.Join(maxMemoryPolicies, ", "))
+        }
+    }
+    if spec.MaxMemory == nil {
+        return nil
+    }
+    if spec.MaxMemory.Sign() < 0 {
+        return fmt.Errorf("maxMemory %s must not be negative", spec.MaxMemory.String())
+    }
+    limit, ok := spec.Resources.Limits[corev1.ResourceMemory]
+    if !ok {
+        return nil
+    }
+    if spec.MaxMemory.Sign() == 0 {
+        return fmt.Errorf("maxMemory 0 lets Redis use more than the %s memory limit", limit.String())
+    }
+    if float64(spec.MaxMemory.Value()) > maxMemoryLimitRatio*float64(limit.Value()) {
+        return fmt.Errorf("maxMemory %s exceeds %d%% of the %s memory limit", spec.MaxMemory.String(), int(maxMemoryLimitRatio*100), limit.String())
+    }
+    return nil
+}
+
+// setWritesWillBeRejectedCondition sets the WritesWillBeRejected condition
+// from INFO MEMORY of the nodes. A node with the noeviction policy rejects
+// writes once it reaches maxmemory, so the condition warns before that, with
+// a Warning event when it turns true.
+func (h *RedisClusterHandler) setWritesWillBeRejectedCondition(cluster *RedisCluster, memory map[string]map[string]string) {
+    nearlyFull := []string{}
+    for name, info := range memory {
+        if info["maxmemory_policy"] != "noeviction" {
+            continue
+        }
+        maxMemory, _ := strconv.ParseInt(info["maxmemory"], 10, 64)
+        usedMemory, _ := strconv.ParseInt(info["used_memory"], 10, 64)
+        if maxMemory > 0 && float64(usedMemory) >= writeRejectionThreshold*float64(maxMemory) {
+            nearlyFull = append(nearlyFull, fmt.Sprintf("%s (%d%%)", name, usedMemory*100/maxMemory))
+        }
+    }
+
+    if len(nearlyFull) > 0 {
+        sort.Strings(nearlyFull)
+        message := fmt.Sprintf("Nodes with the noeviction policy are close to maxmemory and will reject writes: %s", strings.Join(nearlyFull, ", "))
+        if !meta.IsStatusConditionTrue(cluster.Status.Conditions, ConditionWritesWillBeRejected) {
+            h.recorder.Event(cluster, corev1.EventTypeWarning, ReasonWritesWillBeRejected, message)
+        }
+        meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+            Type:    ConditionWritesWillBeRejected,
+            Status:  metav1.ConditionTrue,
+            Reason:  "NoEvictionNearMaxMemory",
+            Message: message,
+        })
+        return
+    }
+
+    meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+        Type:    ConditionWritesWillBeRejected,
+        Status:  metav1.ConditionFalse,
+        Reason:  "MemoryAvailable",
+        Message: "No node is close to rejecting writes",
+    })
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+    "net/http"
+    "reflect"
+    "time"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    appsv1 "k8s.io/api/apps/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+    evictedKeysTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_redis_evicted_keys_total",
+        Help: "Number of keys evicted by the Redis nodes of a cluster because of the maxmemory limit.",
+    }, []string{"namespace", "cluster"})
+
+    expiredKeysTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_redis_expired_keys_total",
+        Help: "Number of keys expired by the Redis nodes of a cluster.",
+    }, []string{"namespace", "cluster"})
+
+    reconcilesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_reconciles_total",
+        Help: "Number of reconciles of a cluster by result, success or error.",
+    }, []string{"namespace", "cluster", "result"})
+
+    reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "yaro_reconcile_duration_seconds",
+        Help:    "Duration of the reconciles of a cluster.",
+        Buckets: prometheus.DefBuckets,
+    }, []string{"namespace", "cluster"})
+
+    readyNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "yaro_ready_nodes",
+        Help: "Number of ready Redis nodes of a cluster.",
+    }, []string{"namespace", "cluster"})
+
+    failoverPodDeletionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_failover_pod_deletions_total",
+        Help: "Number of pods of a cluster deleted by the automatic failover.",
+    }, []string{"namespace", "cluster"})
+
+    failoversTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_failovers_total",
+        Help: "Number of master failovers of a cluster started by the operator, by reason, failure, upgrade or operation.",
+    }, []string{"namespace", "cluster", "reason"})
+
+    errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_errors_total",
+        Help: "Number of events of a cluster whose handling failed, by kind of the object.",
+    }, []string{"namespace", "cluster", "kind"})
+
+    eventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_events_total",
+        Help: "Number of events handled by the operator, by kind of the object and result.",
+    }, []string{"kind", "result"})
+
+    convergencesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_convergences_total",
+        Help: "Number of updates bringing an object of a cluster back in line with its spec, after a spec change or a manual edit, by kind of the object.",
+    }, []string{"namespace", "cluster", "kind"})
+
+    leaderGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "yaro_leader",
+        Help: "Whether the operator instance holds the leader lease and reconciles the clusters, by identity of the instance.",
+    }, []string{"identity"})
+
+    slowCommandsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "yaro_redis_slow_commands_total",
+        Help: "Number of commands logged in the slow logs of the Redis nodes of a cluster, by command.",
+    }, []string{"namespace", "cluster", "command"})
+
+    slowCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "yaro_redis_slow_command_duration_seconds",
+        Help:    "Duration of the commands logged in the slow logs of the Redis nodes of a cluster.",
+        Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+    }, []string{"namespace", "cluster"})
+
+    latencySpikeMilliseconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "yaro_redis_latency_spike_milliseconds",
+        Help: "Latest latency spike of a Redis node of a cluster, by latency event.",
+    }, []string{"namespace", "cluster", "node", "event"})
+
+    eventDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "yaro_event_duration_seconds",
+        Help:    "Duration of the handling of the events, by kind of the object.",
+        Buckets: prometheus.DefBuckets,
+    }, []string{"kind"})
+)
+
+const (
+    // failoverReasonFailure labels the failovers replacing a failed master.
+    failoverReasonFailure = "failure"
+
+    // failoverReasonUpgrade labels the failovers before upgrading a master.
+    failoverReasonUpgrade = "upgrade"
+
+    // failoverReasonOperation labels the failovers requested by an operation.
+    failoverReasonOperation = "operation"
+)
+
+func init() {
+    prometheus.MustRegister(evictedKeysTotal, expiredKeysTotal, reconcilesTotal, reconcileDuration, readyNodes, failoverPodDeletionsTotal,
+        failoversTotal, errorsTotal, eventsTotal, eventDuration, convergencesTotal, leaderGauge, slowCommandsTotal, slowCommandDuration,
+        latencySpikeMilliseconds)
+}
+
+// observeEvent records the result and duration of the handling of an event
+// started at start, and counts its error against the cluster of the object.
+func observeEvent(object sdk.Object, start time.Time, err error) {
+    kind, cluster := "", ""
+    switch o := object.(type) {
+    case *RedisCluster:
+        kind, cluster = "RedisCluster", o.Name
+    case *appsv1.StatefulSet:
+        kind, cluster = "StatefulSet", o.Labels["controller"]
+    default:
+        return
+    }
+
+    result := "success"
+    if err != nil {
+        result = "error"
+        errorsTotal.WithLabelValues(object.(metav1.Object).GetNamespace(), cluster, kind).Inc()
+    }
+    eventsTotal.WithLabelValues(kind, result).Inc()
+    eventDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+}
+
+// observeConvergence counts an update of an object managed for a cluster.
+func observeConvergence(object sdk.Object) {
+    controller := metav1.GetControllerOf(object.(metav1.Object))
+    if controller == nil {
+        return
+    }
+    kind := object.GetObjectKind().GroupVersionKind().Kind
+    if kind == "" {
+        kind = reflect.TypeOf(object).Elem().Name()
+    }
+    convergencesTotal.WithLabelValues(object.(metav1.Object).GetNamespace(), controller.Name, kind).Inc()
+}
+
+// observeReconcile records the result and duration of a reconcile started at start.
+func observeReconcile(namespace, cluster string, start time.Time, err error) {
+    result := "success"
+    if err != nil {
+        result = "error"
+    }
+    reconcilesTotal.WithLabelValues(namespace, cluster, result).Inc()
+    reconcileDuration.WithLabelValues(namespace, cluster).Observe(time.Since(start).Seconds())
+}
+
+// deleteClusterMetrics drops the metrics of a deleted cluster.
+func deleteClusterMetrics(namespace, cluster string) {
+    evictedKeysTotal.DeleteLabelValues(namespace, cluster)
+    expiredKeysTotal.DeleteLabelValues(namespace, cluster)
+    reconcilesTotal.DeleteLabelValues(namespace, cluster, "success")
+    reconcilesTotal.DeleteLabelValues(namespace, cluster, "error")
+    reconcileDuration.DeleteLabelValues(namespace, cluster)
+    readyNodes.DeleteLabelValues(namespace, cluster)
+    failoverPodDeletionsTotal.DeleteLabelValues(namespace, cluster)
+    failoversTotal.DeleteLabelValues(namespace, cluster, failoverReasonFailure)
+    failoversTotal.DeleteLabelValues(namespace, cluster, failoverReasonUpgrade)
+    failoversTotal.DeleteLabelValues(namespace, cluster, failoverReasonOperation)
+    errorsTotal.DeleteLabelValues(namespace, cluster, "RedisCluster")
+    errorsTotal.DeleteLabelValues(namespace, cluster, "StatefulSet")
+    convergencesTotal.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "cluster": cluster})
+    slowCommandsTotal.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "cluster": cluster})
+    slowCommandDuration.DeleteLabelValues(namespace, cluster)
+    latencySpikeMilliseconds.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "cluster": cluster})
+}
+
+// ServeMetrics serves the metrics on /metrics at the address until the server
+// fails. main runs it in the background next to the handler, at the
+// --metrics-addr address.
+func ServeMetrics(address string) error {
+    mux := http.NewServeMux()
+    mux.Handle("/metrics", promhttp.Handler())
+    return http.ListenAndServe(address, mux)
+}
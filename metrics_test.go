@@ -0,0 +1,47 @@
+package main
+
+import (
+    "errors"
+    "testing"
+    "time"
+    "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveReconcile(t *testing.T) {
+    start := time.Now()
+    observeReconcile("metrics", "cache", start, nil)
+    observeReconcile("metrics", "cache", start, nil)
+    observeReconcile("metrics", "cache", start, errors.New("unreachable"))
+
+    if got := testutil.ToFloat64(reconcilesTotal.WithLabelValues("metrics", "cache", "success")); got != 2 {
+        t.Errorf("got %v successful reconciles, want 2", got)
+    }
+    if got := testutil.ToFloat64(reconcilesTotal.WithLabelValues("metrics", "cache", "error")); got != 1 {
+        t.Errorf("got %v failed reconciles, want 1", got)
+    }
+
+    deleteClusterMetrics("metrics", "cache")
+    if got := testutil.ToFloat64(reconcilesTotal.WithLabelValues("metrics", "cache", "success")); got != 0 {
+        t.Errorf("got %v successful reconciles after the cluster was deleted, want the series reset", got)
+    }
+    deleteClusterMetrics("metrics", "cache")
+}
+
+func TestNodeCountersDelta(t *testing.T) {
+    tests := []struct {
+        name     string
+        previous map[string]int64
+        current  map[string]int64
+        want     int64
+    }{
+        {"first observation", nil, map[string]int64{"cache-0": 10}, 0},
+        {"growing counters", map[string]int64{"cache-0": 10, "cache-1": 5}, map[string]int64{"cache-0": 12, "cache-1": 8}, 5},
+        {"restarted node", map[string]int64{"cache-0": 10, "cache-1": 5}, map[string]int64{"cache-0": 2, "cache-1": 6}, 3},
+        {"new node", map[string]int64{"cache-0": 10}, map[string]int64{"cache-0": 11, "cache-1": 40}, 1},
+    }
+    for _, test := range tests {
+        if got := nodeCountersDelta(test.previous, test.current); got != test.want {
+            t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+        }
+    }
+}
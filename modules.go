@@ -0,0 +1,197 @@
+package main
+
+import (
+    "fmt"
+    "path"
+    "sort"
+    "strings"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+    // modulesVolumeName and modulesMountPath identify the volume the module
+    // init containers copy the modules to.
+    modulesVolumeName = "modules"
+    modulesMountPath  = "/modules"
+
+    // moduleContainerPrefix prefixes the names of the module init containers.
+    moduleContainerPrefix = "module-"
+)
+
+// modulePath returns the path Redis loads the module from: the copy in the
+// modules volume for a module shipped in its own image, or its path in the
+// Redis image otherwise.
+func modulePath(module RedisModule) string {
+    if module.Image == "" {
+        return module.Path
+    }
+    return path.Join(modulesMountPath, module.Name+".so")
+}
+
+// moduleArgs returns the redis-server arguments loading the modules of the spec.
+func moduleArgs(spec RedisClusterSpec) []string {
+    args := []string{}
+    for _, module := range spec.Modules {
+        args = append(args, "--loadmodule", modulePath(module))
+        args = append(args, module.Args...)
+    }
+    return args
+}
+
+// moduleVolume returns the volume and mount the module init containers copy
+// the modules to, or nil when no module comes from its own image.
+func moduleVolume(spec RedisClusterSpec) (*corev1.Volume, *corev1.VolumeMount) {
+    for _, module := range spec.Modules {
+        if module.Image == "" {
+            continue
+        }
+        volume := &corev1.Volume{
+            Name: modulesVolumeName,
+            VolumeSource: corev1.VolumeSource{
+                EmptyDir: &corev1.EmptyDirVolumeSource{},
+            },
+        }
+        mount := &corev1.VolumeMount{
+            Name:      modulesVolumeName,
+            MountPath: modulesMountPath,
+        }
+        return volume, mount
+    }
+    return nil, nil
+}
+
+// moduleContainers builds the init containers copying the modules shipped in
+// their own images to the modules volume.
+func moduleContainers(spec RedisClusterSpec) []corev1.Container {
+    _, mount := moduleVolume(spec)
+    containers := []corev1.Container{}
+    for _, module := range spec.Modules {
+        if module.Image == "" {
+            continue
+        }
+        containers = append(containers, corev1.Container{
+            Name:            moduleContainerPrefix + module.Name,
+            Image:           module.Image,
+            ImagePullPolicy: spec.ImagePullPolicy,
+            Command:         []string{"cp", module.Path, modulePath(module)},
+            SecurityContext: containerSecurityContext(spec),
+            VolumeMounts:    []corev1.VolumeMount{*mount},
+        })
+    }
+    return containers
+}
+
+// validateModules checks the modules of the spec.
+func validateModules(spec RedisClusterSpec) error {
+    names := map[string]bool{}
+    for _, module := range spec.Modules {
+        if errs := validation.IsDNS1123Label(module.Name); len(errs) > 0 {
+            return fmt.Errorf("module name %q is invalid: %s", module.Name, strings.Join(errs, ", "))
+        }
+        if names[module.Name] {
+            return fmt.Errorf("module %s is listed more than once", module.Name)
+        }
+        names[module.Name] = true
+        if !path.IsAbs(module.Path) {
+            return fmt.Errorf("module %s needs the absolute path of its shared library", module.Name)
+        }
+        for _, arg := range module.Args {
+            if arg == "" || strings.HasPrefix(arg, "--") {
+                return fmt.Errorf("module %s argument %q is invalid", module.Name, arg)
+            }
+        }
+    }
+    return nil
+}
+
+// getModules returns the modules loaded by the Redis server of the pod, as
+// name@version, sorted.
+func getModules(pod *corev1.Pod) ([]string, error) {
+    client := newRedisClient(pod)
+    defer client.Close()
+
+    cmd := redis.NewSliceCmd("module", "list")
+    err := client.Process(cmd)
+    if err != nil {
+        return nil, err
+    }
+    modules := []string{}
+    for _, entry := range cmd.Val() {
+        fields, _ := entry.([]interface{})
+        info := map[string]string{}
+        for i := 0; i+1 < len(fields); i += 2 {
+            info[fmt.Sprint(fields[i])] = fmt.Sprint(fields[i+1])
+        }
+        modules = append(modules, info["name"]+"@"+info["ver"])
+    }
+    sort.Strings(modules)
+    return modules, nil
+}
+
+// setModulesInconsistentCondition sets the ModulesInconsistent condition from
+// the modules loaded by the ready nodes, which should all load one module per
+// module of the spec with the same versions. The condition is left out of
+// clusters without modules.
+func setModulesInconsistentCondition(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    if len(cluster.Spec.Modules) == 0 {
+        meta.RemoveStatusCondition(&cluster.Status.Conditions, ConditionModulesInconsistent)
+        return nil
+    }
+
+    // Group the ready nodes by the modules they load
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    nodes := map[string][]string{}
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        modules, err := getModules(pod)
+        if err != nil {
+            return fmt.Errorf("listing the modules of pod %s: %v", pod.Name, err)
+        }
+        if len(modules) != len(cluster.Spec.Modules) {
+            modules = append(modules, fmt.Sprintf("%d of %d modules", len(modules), len(cluster.Spec.Modules)))
+        }
+        key := strings.Join(modules, ", ")
+        nodes[key] = append(nodes[key], pod.Name)
+    }
+
+    inconsistent := len(nodes) > 1
+    for key := range nodes {
+        if strings.Contains(key, " modules") {
+            inconsistent = true
+        }
+    }
+    if inconsistent {
+        groups := []string{}
+        for key, names := range nodes {
+            sort.Strings(names)
+            groups = append(groups, fmt.Sprintf("%s load [%s]", strings.Join(names, ", "), key))
+        }
+        sort.Strings(groups)
+        meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+            Type:    ConditionModulesInconsistent,
+            Status:  metav1.ConditionTrue,
+            Reason:  "ModulesDiffer",
+            Message: fmt.Sprintf("The nodes do not load the same modules: %s", strings.Join(groups, "; ")),
+        })
+        return nil
+    }
+
+    meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+        Type:    ConditionModulesInconsistent,
+        Status:  metav1.ConditionFalse,
+        Reason:  "ModulesMatch",
+        Message: "All the ready nodes load the modules of the spec",
+    })
+    return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "strconv"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/meta"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+    // defaultExporterImage is the redis_exporter image used when the spec does not set one.
+    defaultExporterImage = "oliver006/redis_exporter:latest"
+
+    // exporterContainerName is the name of the exporter sidecar.
+    exporterContainerName = "exporter"
+
+    // exporterPort is the port the exporter serves the metrics on.
+    exporterPort = 9121
+
+    // exporterPortName is the name of the exporter container and Service port.
+    exporterPortName = "metrics"
+)
+
+// serviceMonitorKind is the Prometheus Operator kind scraping the exporters.
+var serviceMonitorKind = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+
+// monitoringEnabled reports whether the spec runs the exporter sidecar.
+func monitoringEnabled(spec RedisClusterSpec) bool {
+    return spec.Monitoring != nil && spec.Monitoring.Enabled
+}
+
+// exporterImage returns the exporter image of the spec.
+func exporterImage(spec RedisClusterSpec) string {
+    if spec.Monitoring.Image == "" {
+        return defaultExporterImage
+    }
+    return spec.Monitoring.Image
+}
+
+// exporterContainer builds the redis_exporter sidecar scraping the local
+// Redis server, over TLS and with the password when the spec sets them.
+func exporterContainer(spec RedisClusterSpec) corev1.Container {
+    scheme := "redis"
+    if spec.TLS != nil {
+        scheme = "rediss"
+    }
+    env := []corev1.EnvVar{{
+        Name:  "REDIS_ADDR",
+        Value: scheme + "://localhost:" + strconv.Itoa(int(clientPort(spec))),
+    }}
+    if ref := passwordSecretRef(spec); ref != nil {
+        env = append(env, corev1.EnvVar{
+            Name:      "REDIS_PASSWORD",
+            ValueFrom: &corev1.EnvVarSource{SecretKeyRef: ref},
+        })
+    }
+    container := corev1.Container{
+        Name:            exporterContainerName,
+        Image:           exporterImage(spec),
+        ImagePullPolicy: spec.ImagePullPolicy,
+        Env:             env,
+        Resources:       spec.Monitoring.Resources,
+        SecurityContext: containerSecurityContext(spec),
+        Ports: []corev1.ContainerPort{{
+            Name:          exporterPortName,
+            ContainerPort: exporterPort,
+        }},
+    }
+
+    // Connect over TLS with the certificates of the node
+    if spec.TLS != nil {
+        _, mount := tlsVolume(spec)
+        container.VolumeMounts = []corev1.VolumeMount{mount}
+        container.Env = append(container.Env,
+            corev1.EnvVar{Name: "REDIS_EXPORTER_TLS_CA_CERT_FILE", Value: mount.MountPath + "/" + corev1.ServiceAccountRootCAKey},
+            corev1.EnvVar{Name: "REDIS_EXPORTER_TLS_CLIENT_CERT_FILE", Value: mount.MountPath + "/" + corev1.TLSCertKey},
+            corev1.EnvVar{Name: "REDIS_EXPORTER_TLS_CLIENT_KEY_FILE", Value: mount.MountPath + "/" + corev1.TLSPrivateKeyKey},
+            corev1.EnvVar{Name: "REDIS_EXPORTER_SKIP_TLS_VERIFICATION", Value: "true"},
+        )
+    }
+    return container
+}
+
+// exporterServicePort returns the metrics port of the headless Service.
+func exporterServicePort() corev1.ServicePort {
+    return corev1.ServicePort{
+        Name:       exporterPortName,
+        Port:       exporterPort,
+        TargetPort: intstr.FromInt(exporterPort),
+    }
+}
+
+// updateSidecars brings the sidecars of an existing pod template in line
+// with the desired template, and reports whether it changed anything.
+func updateSidecars(existing *corev1.PodTemplateSpec, template corev1.PodTemplateSpec) bool {
+    sidecars := corev1.PodSpec{Containers: existing.Spec.Containers[1:]}
+    desired := corev1.PodSpec{Containers: template.Spec.Containers[1:]}
+    if sameContainers(sidecars, desired) && sameSidecarPorts(sidecars.Containers, desired.Containers) {
+        return false
+    }
+    existing.Spec.Containers = append(existing.Spec.Containers[:1], template.Spec.Containers[1:]...)
+    return true
+}
+
+// sameSidecarPorts reports whether the sidecars expose the same ports.
+func sameSidecarPorts(existing, desired []corev1.Container) bool {
+    for i := range existing {
+        if !reflect.DeepEqual(existing[i].Ports, desired[i].Ports) {
+            return false
+        }
+    }
+    return true
+}
+
+// isMissingKind reports whether an error comes from a kind the API server
+// does not serve, such as a CRD that is not installed.
+func isMissingKind(err error) bool {
+    return meta.IsNoMatchError(err) || apierrors.IsNotFound(err)
+}
+
+// newServiceMonitor builds the ServiceMonitor scraping the exporters through
+// the headless Service of the cluster.
+func newServiceMonitor(cluster *RedisCluster, namespace string) *unstructured.Unstructured {
+    name := cluster.ObjectMeta.Name
+    monitor := &unstructured.Unstructured{}
+    monitor.SetGroupVersionKind(serviceMonitorKind)
+    monitor.SetName(name)
+    monitor.SetNamespace(namespace)
+    monitor.SetLabels(map[string]string{"app": name, "controller": name})
+    monitor.SetOwnerReferences(ownerReferences(cluster))
+    monitor.Object["spec"] = map[string]interface{}{
+        "selector": map[string]interface{}{
+            "matchLabels": map[string]interface{}{"app": name, "controller": name},
+        },
+        "endpoints": []interface{}{
+            map[string]interface{}{"port": exporterPortName},
+        },
+    }
+    return monitor
+}
+
+// reconcileServiceMonitor creates the ServiceMonitor of a cluster asking for
+// one, and deletes it otherwise. Nothing is done when the Prometheus
+// Operator CRDs are not installed.
+func reconcileServiceMonitor(cluster *RedisCluster, namespace string) error {
+    existing := &unstructured.Unstructured{}
+    existing.SetGroupVersionKind(serviceMonitorKind)
+    if !monitoringEnabled(cluster.Spec) || !cluster.Spec.Monitoring.ServiceMonitor {
+        err := deleteIfExists(existing, namespace, cluster.ObjectMeta.Name)
+        if err != nil && meta.IsNoMatchError(err) {
+            return nil
+        }
+        return err
+    }
+
+    monitor := newServiceMonitor(cluster, namespace)
+    err := sdk.Get(existing, namespace, monitor.GetName())
+    if isMissingKind(err) {
+        err = sdk.Create(monitor)
+        if meta.IsNoMatchError(err) {
+            return nil
+        }
+    }
+    if err != nil {
+        return fmt.Errorf("reconciling ServiceMonitor %s: %v", monitor.GetName(), err)
+    }
+    return nil
+}
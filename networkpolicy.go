@@ -0,0 +1,124 @@
+package main
+
+import (
+    "os"
+    "reflect"
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// clusterBusPortOffset is the offset from the client port of the port the
+// nodes of a sharded cluster talk to each other on.
+const clusterBusPortOffset = 10000
+
+// networkPolicyEnabled reports whether the spec restricts the access to the
+// pods with a NetworkPolicy.
+func networkPolicyEnabled(spec RedisClusterSpec) bool {
+    return spec.NetworkPolicy != nil && spec.NetworkPolicy.Enabled
+}
+
+// operatorPeer selects the pods of the operator: all the pods of the
+// namespace the operator runs in, or of the namespace of the cluster when
+// the operator namespace is not known.
+func operatorPeer(namespace string) networkingv1.NetworkPolicyPeer {
+    if operatorNamespace := os.Getenv(operatorNamespaceEnv); operatorNamespace != "" {
+        namespace = operatorNamespace
+    }
+    return networkingv1.NetworkPolicyPeer{
+        NamespaceSelector: &metav1.LabelSelector{
+            MatchLabels: map[string]string{corev1.LabelMetadataName: namespace},
+        },
+    }
+}
+
+// networkPolicyPorts returns the ports of the given numbers.
+func networkPolicyPorts(numbers ...int32) []networkingv1.NetworkPolicyPort {
+    protocol := corev1.ProtocolTCP
+    ports := []networkingv1.NetworkPolicyPort{}
+    for _, number := range numbers {
+        port := intstr.FromInt(int(number))
+        ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+    }
+    return ports
+}
+
+// newNetworkPolicy builds the NetworkPolicy of the pods of the cluster, the
+// Redis nodes and the sentinels. The pods reach each other on all their
+// ports, the operator and the selected clients reach Redis and the
+// sentinels, and the selected monitoring peers reach the exporters. Peers
+// left out of the spec are denied.
+func newNetworkPolicy(cluster *RedisCluster, namespace string) *networkingv1.NetworkPolicy {
+    name := cluster.ObjectMeta.Name
+    spec := cluster.Spec
+    members := networkingv1.NetworkPolicyPeer{
+        PodSelector: &metav1.LabelSelector{
+            MatchLabels: map[string]string{"controller": name},
+        },
+    }
+
+    // Let the pods of the cluster talk to each other
+    clientPorts := []int32{clientPort(spec)}
+    peerPorts := []int32{clientPort(spec)}
+    if spec.Mode == ModeSentinel {
+        clientPorts = append(clientPorts, sentinelPort)
+        peerPorts = append(peerPorts, sentinelPort)
+    }
+    if spec.Mode == ModeCluster {
+        peerPorts = append(peerPorts, clientPort(spec)+clusterBusPortOffset)
+    }
+    ingress := []networkingv1.NetworkPolicyIngressRule{{
+        From:  []networkingv1.NetworkPolicyPeer{members},
+        Ports: networkPolicyPorts(peerPorts...),
+    }}
+
+    // Let the operator and the clients reach Redis and the sentinels
+    ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+        From:  append([]networkingv1.NetworkPolicyPeer{operatorPeer(namespace)}, spec.NetworkPolicy.Clients...),
+        Ports: networkPolicyPorts(clientPorts...),
+    })
+
+    // Let the monitoring scrape the exporters
+    if monitoringEnabled(spec) && len(spec.NetworkPolicy.Monitoring) > 0 {
+        ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+            From:  spec.NetworkPolicy.Monitoring,
+            Ports: networkPolicyPorts(exporterPort),
+        })
+    }
+
+    return &networkingv1.NetworkPolicy{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          map[string]string{"app": name, "controller": name},
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: networkingv1.NetworkPolicySpec{
+            PodSelector: metav1.LabelSelector{
+                MatchLabels: map[string]string{"controller": name},
+            },
+            PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+            Ingress:     ingress,
+        },
+    }
+}
+
+// reconcileNetworkPolicy makes sure the NetworkPolicy of the cluster exists
+// and matches the spec when enabled, and removes it otherwise.
+func reconcileNetworkPolicy(cluster *RedisCluster, namespace string) error {
+    if !networkPolicyEnabled(cluster.Spec) {
+        return deleteIfExists(&networkingv1.NetworkPolicy{}, namespace, cluster.ObjectMeta.Name)
+    }
+
+    policy := newNetworkPolicy(cluster, namespace)
+    existing := &networkingv1.NetworkPolicy{}
+    _, err := createOrUpdate(policy, existing, func() bool {
+        if reflect.DeepEqual(existing.Spec, policy.Spec) {
+            return false
+        }
+        existing.Spec = policy.Spec
+        return true
+    })
+    return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+    "fmt"
+    "github.com/operator-framework/operator-sdk/pkg/k8sclient"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+)
+
+// The object helpers reach the API server through these functions, which the
+// tests replace with an in-memory fake.
+var (
+    getObject    = sdk.Get
+    createObject = sdk.Create
+    updateObject = sdk.Update
+    deleteObject = sdk.Delete
+    updateStatus = updateClusterStatus
+    listPods     = listPodsWithClientset
+)
+
+// createOrUpdate creates the desired object if it does not exist yet.
+// Otherwise it reads the object into existing and calls update, which brings
+// existing in line with desired and reports whether it changed anything, and
+// restores the labels and owner of the object. The object is only updated
+// when something drifted, so a converged cluster reconciles without writes.
+// It reports whether the object was created.
+func createOrUpdate(desired, existing sdk.Object, update func() bool) (bool, error) {
+    object := desired.(metav1.Object)
+    err := getObject(existing, object.GetNamespace(), object.GetName())
+    if apierrors.IsNotFound(err) {
+        return true, createObject(desired)
+    }
+    if err != nil {
+        return false, err
+    }
+
+    changed := update()
+    if syncMetadata(existing.(metav1.Object), object) {
+        changed = true
+    }
+    if !changed {
+        return false, nil
+    }
+    observeConvergence(desired)
+    return false, updateObject(existing)
+}
+
+// updateClusterStatus writes the status of the RedisCluster through the status
+// subresource, which ignores changes to the spec and the metadata, and records
+// the new resource version in cluster so that it can be updated again.
+func updateClusterStatus(cluster *RedisCluster) error {
+    client, _, err := k8sclient.GetResourceClient(SchemeGroupVersion.String(), "RedisCluster", cluster.ObjectMeta.Namespace)
+    if err != nil {
+        return err
+    }
+    content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cluster)
+    if err != nil {
+        return err
+    }
+    object := &unstructured.Unstructured{Object: content}
+    object.SetAPIVersion(SchemeGroupVersion.String())
+    object.SetKind("RedisCluster")
+
+    updated, err := client.UpdateStatus(object, metav1.UpdateOptions{})
+    if err != nil {
+        return err
+    }
+    cluster.ObjectMeta.ResourceVersion = updated.GetResourceVersion()
+    return nil
+}
+
+// syncMetadata restores the labels and the controller the operator sets on
+// an object, which manual edits may have changed, and reports whether it
+// changed anything. Labels and owners added by others are kept, and an
+// object already controlled by another owner is left to it.
+func syncMetadata(existing, desired metav1.Object) bool {
+    changed := false
+    labels := existing.GetLabels()
+    for key, value := range desired.GetLabels() {
+        if labels[key] != value {
+            if labels == nil {
+                labels = map[string]string{}
+            }
+            labels[key] = value
+            changed = true
+        }
+    }
+    existing.SetLabels(labels)
+
+    controller := metav1.GetControllerOf(desired)
+    if controller != nil && metav1.GetControllerOf(existing) == nil {
+        existing.SetOwnerReferences(append(existing.GetOwnerReferences(), *controller))
+        changed = true
+    }
+    return changed
+}
+
+// deleteIfExists deletes the named object of the type of obj if it exists.
+func deleteIfExists(obj sdk.Object, namespace, name string) error {
+    err := getObject(obj, namespace, name)
+    if apierrors.IsNotFound(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    return deleteObject(obj)
+}
+
+// deleteIfControlled deletes the named object of the type of obj if it exists
+// and the cluster controls it, leaving the objects of others alone.
+func deleteIfControlled(obj sdk.Object, namespace, name string, cluster *RedisCluster) error {
+    err := getObject(obj, namespace, name)
+    if apierrors.IsNotFound(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if owner := metav1.GetControllerOf(obj.(metav1.Object)); owner == nil || owner.UID != cluster.UID {
+        return nil
+    }
+    return deleteObject(obj)
+}
+
+// objectNamespace returns the namespace of an object the operator handles.
+// The operator may watch several namespaces, so an object without one
+// cannot be placed.
+func objectNamespace(obj metav1.Object) (string, error) {
+    if obj.GetNamespace() == "" {
+        return "", fmt.Errorf("%s has no namespace", obj.GetName())
+    }
+    return obj.GetNamespace(), nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+    "testing"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeClient is an in-memory API server standing in for the sdk in the
+// object helpers, counting the writes it receives.
+type fakeClient struct {
+    objects map[string]sdk.Object
+    creates int
+    updates int
+    deletes int
+}
+
+// newFakeClient routes the object helpers to a fake holding the objects for
+// the duration of the test.
+func newFakeClient(t *testing.T, objects ...sdk.Object) *fakeClient {
+    fake := &fakeClient{objects: map[string]sdk.Object{}}
+    for _, object := range objects {
+        meta := object.(metav1.Object)
+        fake.objects[fakeKey(object, meta.GetNamespace(), meta.GetName())] = object.DeepCopyObject()
+    }
+
+    get, create, update, remove, list := getObject, createObject, updateObject, deleteObject, listPods
+    t.Cleanup(func() {
+        getObject, createObject, updateObject, deleteObject, listPods = get, create, update, remove, list
+    })
+    getObject = fake.get
+    createObject = fake.create
+    updateObject = fake.update
+    deleteObject = fake.delete
+    listPods = fake.listPods
+    return fake
+}
+
+// fakeKey identifies an object by its type, namespace and name.
+func fakeKey(object sdk.Object, namespace, name string) string {
+    return fmt.Sprintf("%T/%s/%s", object, namespace, name)
+}
+
+// notFound returns the error of the API server for a missing object.
+func notFound(object sdk.Object, name string) error {
+    return apierrors.NewNotFound(schema.GroupResource{Resource: fmt.Sprintf("%T", object)}, name)
+}
+
+func (f *fakeClient) get(into sdk.Object, namespace, name string) error {
+    stored, ok := f.objects[fakeKey(into, namespace, name)]
+    if !ok {
+        return notFound(into, name)
+    }
+    reflect.ValueOf(into).Elem().Set(reflect.ValueOf(stored.DeepCopyObject()).Elem())
+    return nil
+}
+
+func (f *fakeClient) create(object sdk.Object) error {
+    meta := object.(metav1.Object)
+    key := fakeKey(object, meta.GetNamespace(), meta.GetName())
+    if _, ok := f.objects[key]; ok {
+        return apierrors.NewAlreadyExists(schema.GroupResource{Resource: fmt.Sprintf("%T", object)}, meta.GetName())
+    }
+    f.creates++
+    f.objects[key] = object.DeepCopyObject()
+    return nil
+}
+
+func (f *fakeClient) update(object sdk.Object) error {
+    meta := object.(metav1.Object)
+    key := fakeKey(object, meta.GetNamespace(), meta.GetName())
+    if _, ok := f.objects[key]; !ok {
+        return notFound(object, meta.GetName())
+    }
+    f.updates++
+    f.objects[key] = object.DeepCopyObject()
+    return nil
+}
+
+func (f *fakeClient) delete(object sdk.Object, opts ...sdk.DeleteOption) error {
+    meta := object.(metav1.Object)
+    key := fakeKey(object, meta.GetNamespace(), meta.GetName())
+    if _, ok := f.objects[key]; !ok {
+        return notFound(object, meta.GetName())
+    }
+    f.deletes++
+    delete(f.objects, key)
+    return nil
+}
+
+func (f *fakeClient) listPods(ctx sdk.Context, namespace, selector string) (*corev1.PodList, error) {
+    parsed, err := labels.Parse(selector)
+    if err != nil {
+        return nil, err
+    }
+    pods := &corev1.PodList{}
+    for _, object := range f.objects {
+        pod, ok := object.(*corev1.Pod)
+        if ok && pod.Namespace == namespace && parsed.Matches(labels.Set(pod.Labels)) {
+            pods.Items = append(pods.Items, *pod.DeepCopy())
+        }
+    }
+    sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+    return pods, nil
+}
+
+// newTestCluster returns a RedisCluster of the given size in the default
+// namespace.
+func newTestCluster(size int32) *RedisCluster {
+    return &RedisCluster{
+        TypeMeta: metav1.TypeMeta{
+            APIVersion: SchemeGroupVersion.String(),
+            Kind:       "RedisCluster",
+        },
+        ObjectMeta: metav1.ObjectMeta{
+            Name:      "cache",
+            Namespace: "default",
+            UID:       "0b5f6e2a-3c4d-4e8f-9a1b-2c3d4e5f6a7b",
+        },
+        Spec: RedisClusterSpec{
+            Size: size,
+        },
+    }
+}
+
+func TestCreateOrUpdateIsIdempotent(t *testing.T) {
+    fake := newFakeClient(t)
+    cluster := newTestCluster(3)
+
+    for pass := 1; pass <= 2; pass++ {
+        err := reconcileHeadlessService(cluster, "default")
+        if err != nil {
+            t.Fatalf("reconcile %d: %v", pass, err)
+        }
+    }
+    if fake.creates != 1 {
+        t.Errorf("got %d creates, want 1", fake.creates)
+    }
+    if fake.updates != 0 {
+        t.Errorf("got %d updates of a converged Service, want 0", fake.updates)
+    }
+}
+
+func TestCreateOrUpdateRestoresDrift(t *testing.T) {
+    cluster := newTestCluster(3)
+    drifted := newHeadlessService(cluster, "default")
+    drifted.Spec.Ports[0].Port = 7000
+    drifted.ObjectMeta.Labels = nil
+    fake := newFakeClient(t, drifted)
+
+    err := reconcileHeadlessService(cluster, "default")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if fake.creates != 0 || fake.updates != 1 {
+        t.Fatalf("got %d creates and %d updates, want 0 and 1", fake.creates, fake.updates)
+    }
+    service := &corev1.Service{}
+    err = fake.get(service, "default", headlessServiceName(cluster))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if service.Spec.Ports[0].Port != redisPort {
+        t.Errorf("got port %d, want %d", service.Spec.Ports[0].Port, redisPort)
+    }
+    if service.ObjectMeta.Labels["controller"] != cluster.ObjectMeta.Name {
+        t.Errorf("got labels %v, want the controller label restored", service.ObjectMeta.Labels)
+    }
+}
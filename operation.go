@@ -0,0 +1,401 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisOperation is the custom resource running a one-off operation on a
+// RedisCluster, such as a failover or a snapshot.
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type RedisOperation struct {
+    metav1.TypeMeta   `json:",inline"`
+    metav1.ObjectMeta `json:"metadata"`
+    Spec              RedisOperationSpec   `json:"spec"`
+    Status            RedisOperationStatus `json:"status,omitempty"`
+}
+
+// RedisOperationList is a list of RedisOperation resources.
+// +kubebuilder:object:root=true
+type RedisOperationList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata"`
+    Items           []RedisOperation `json:"items"`
+}
+
+// RedisOperationSpec is the spec for a RedisOperation resource.
+type RedisOperationSpec struct {
+    // ClusterName is the RedisCluster to run the operation on, in the
+    // namespace of the operation.
+    ClusterName string `json:"clusterName"`
+
+    // Type is the operation: bgsave, failover, flushdb or rebalance.
+    Type string `json:"type"`
+
+    // Node is the master pod to fail over, required in cluster mode.
+    Node string `json:"node,omitempty"`
+
+    // Database is the database flushdb empties, 0 by default.
+    Database int32 `json:"database,omitempty"`
+}
+
+// RedisOperationStatus is the outcome of an operation. An operation runs
+// once; a RedisOperation or annotation with a phase is not run again.
+type RedisOperationStatus struct {
+    // Type is the operation that ran, for the operations requested by annotation.
+    Type string `json:"type,omitempty"`
+
+    // Phase is Running, Succeeded or Failed.
+    Phase string `json:"phase,omitempty"`
+
+    // Message explains the phase.
+    Message string `json:"message,omitempty"`
+
+    // StartTime is when the operation started.
+    StartTime *metav1.Time `json:"startTime,omitempty"`
+
+    // CompletionTime is when the operation succeeded or failed.
+    CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+const (
+    // OperationBGSave snapshots the data of the masters with BGSAVE.
+    OperationBGSave = "bgsave"
+
+    // OperationFailover hands the master role over to a replica.
+    OperationFailover = "failover"
+
+    // OperationFlushDB empties a database on the masters.
+    OperationFlushDB = "flushdb"
+
+    // OperationRebalance spreads the slots of a sharded cluster evenly over
+    // its masters.
+    OperationRebalance = "rebalance"
+)
+
+const (
+    // OperationPhaseRunning is the phase of an operation being run.
+    OperationPhaseRunning = "Running"
+
+    // OperationPhaseSucceeded is the phase of an operation that ran.
+    OperationPhaseSucceeded = "Succeeded"
+
+    // OperationPhaseFailed is the phase of an operation that failed or was
+    // interrupted. It is not retried.
+    OperationPhaseFailed = "Failed"
+)
+
+// operationAnnotation requests an operation on a RedisCluster, as
+// <type>[:<argument>], the argument being the node of a failover or the
+// database of a flushdb. The operator removes it once the operation ran.
+const operationAnnotation = "yaro.io/operation"
+
+// ReasonOperation is the reason of the event recorded when an operation ran.
+const ReasonOperation = "Operation"
+
+// parseOperationAnnotation returns the operation requested by the annotation.
+func parseOperationAnnotation(value string) (RedisOperationSpec, error) {
+    parts := strings.SplitN(value, ":", 2)
+    spec := RedisOperationSpec{Type: parts[0]}
+    if len(parts) == 1 {
+        return spec, nil
+    }
+    switch spec.Type {
+    case OperationFailover:
+        spec.Node = parts[1]
+    case OperationFlushDB:
+        database, err := strconv.Atoi(parts[1])
+        if err != nil {
+            return spec, fmt.Errorf("database %q is not a number", parts[1])
+        }
+        spec.Database = int32(database)
+    default:
+        return spec, fmt.Errorf("operation %s takes no argument", spec.Type)
+    }
+    return spec, nil
+}
+
+// validateOperation checks that the operation applies to the cluster.
+func validateOperation(cluster *RedisCluster, spec RedisOperationSpec) error {
+    switch spec.Type {
+    case OperationBGSave:
+    case OperationFailover:
+        if cluster.Spec.Mode == ModeCluster && spec.Node == "" {
+            return fmt.Errorf("a failover in cluster mode needs the master node to fail over")
+        }
+    case OperationFlushDB:
+        if spec.Database < 0 {
+            return fmt.Errorf("database %d is invalid", spec.Database)
+        }
+        if cluster.Spec.Mode == ModeCluster && spec.Database != 0 {
+            return fmt.Errorf("cluster mode only has database 0")
+        }
+    case OperationRebalance:
+        if cluster.Spec.Mode != ModeCluster {
+            return fmt.Errorf("rebalance needs the %s mode", ModeCluster)
+        }
+    default:
+        return fmt.Errorf("operation %q is invalid, it must be %s, %s, %s or %s", spec.Type, OperationBGSave, OperationFailover, OperationFlushDB, OperationRebalance)
+    }
+    return nil
+}
+
+// runOperation runs an operation on the cluster and returns what it did.
+func (h *RedisClusterHandler) runOperation(ctx sdk.Context, namespace string, cluster *RedisCluster, spec RedisOperationSpec) (string, error) {
+    err := validateOperation(cluster, spec)
+    if err != nil {
+        return "", err
+    }
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return "", err
+    }
+
+    switch spec.Type {
+    case OperationBGSave:
+        nodes, err := forEachReadyMaster(pods.Items, func(client *redis.Client) error {
+            return client.BgSave().Err()
+        })
+        return fmt.Sprintf("Started BGSAVE on %d masters", nodes), err
+    case OperationFlushDB:
+        nodes, err := forEachReadyMaster(pods.Items, func(client *redis.Client) error {
+            _, err := client.Pipelined(func(pipe redis.Pipeliner) error {
+                pipe.Select(int(spec.Database))
+                if cluster.Spec.LazyFlush != nil && *cluster.Spec.LazyFlush {
+                    pipe.FlushDBAsync()
+                } else {
+                    pipe.FlushDB()
+                }
+                return nil
+            })
+            return err
+        })
+        return fmt.Sprintf("Flushed database %d on %d masters", spec.Database, nodes), err
+    case OperationFailover:
+        return h.failoverOperation(ctx, namespace, cluster, pods.Items, spec.Node)
+    default:
+        return rebalanceOperation(ctx, namespace, cluster)
+    }
+}
+
+// forEachReadyMaster runs fn against the ready nodes acting as masters and
+// returns how many it ran on.
+func forEachReadyMaster(pods []corev1.Pod, fn func(client *redis.Client) error) (int, error) {
+    nodes := 0
+    for i := range pods {
+        pod := &pods[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        info, err := getInfo(pod, "replication")
+        if err != nil {
+            return nodes, fmt.Errorf("reading replication info of pod %s: %v", pod.Name, err)
+        }
+        if info["role"] != "master" {
+            continue
+        }
+        client := newRedisClient(pod)
+        err = fn(client)
+        client.Close()
+        if err != nil {
+            return nodes, fmt.Errorf("pod %s: %v", pod.Name, err)
+        }
+        nodes++
+    }
+    return nodes, nil
+}
+
+// failoverOperation hands the master role over to a replica: through the
+// sentinels in sentinel mode, with CLUSTER FAILOVER on a replica of the node
+// in cluster mode, and by promoting the best replica otherwise.
+func (h *RedisClusterHandler) failoverOperation(ctx sdk.Context, namespace string, cluster *RedisCluster, pods []corev1.Pod, node string) (string, error) {
+    name := cluster.ObjectMeta.Name
+    switch cluster.Spec.Mode {
+    case ModeSentinel:
+        err := sentinelFailover(ctx, namespace, cluster)
+        if err != nil {
+            return "", err
+        }
+        failoversTotal.WithLabelValues(namespace, name, failoverReasonOperation).Inc()
+        return "Asked the sentinels to fail the master over", nil
+    case ModeCluster:
+        for i := range pods {
+            if pods[i].Name != node {
+                continue
+            }
+            err := clusterFailover(pods, &pods[i])
+            if err != nil {
+                return "", err
+            }
+            failoversTotal.WithLabelValues(namespace, name, failoverReasonOperation).Inc()
+            return fmt.Sprintf("Failed master %s over to one of its replicas", node), nil
+        }
+        return "", fmt.Errorf("pod %s not found", node)
+    default:
+        master := cluster.Status.MasterNode
+        if master == "" || (node != "" && node != master) {
+            return "", fmt.Errorf("the cluster has no replicated master %s to fail over", node)
+        }
+        err := promoteReplica(cluster, pods)
+        if err != nil {
+            return "", err
+        }
+        failoversTotal.WithLabelValues(namespace, name, failoverReasonOperation).Inc()
+        return fmt.Sprintf("Promoted replica %s to master in place of %s", cluster.Status.MasterNode, master), nil
+    }
+}
+
+// rebalanceOperation starts moving the slots of a sharded cluster towards
+// even shares. Each reconcile moves a bounded number of slots, so the
+// following reconciles complete the rebalance.
+func rebalanceOperation(ctx sdk.Context, namespace string, cluster *RedisCluster) (string, error) {
+    members, err := getClusterMembers(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return "", err
+    }
+    defer closeClusterMembers(members)
+    if len(members) == 0 {
+        return "", fmt.Errorf("no node of the cluster is ready")
+    }
+    output, err := members[0].Client.ClusterNodes().Result()
+    if err != nil {
+        return "", err
+    }
+    moved, err := rebalanceSlots(cluster, members, parseClusterNodes(output), int(podCount(cluster.Spec)))
+    if err != nil {
+        return "", err
+    }
+    if !moved {
+        return "The slots are already spread evenly", nil
+    }
+    return "Started moving slots, the reconciles carry on until the masters serve even shares", nil
+}
+
+// handleOperation runs a RedisOperation once and records its outcome. An
+// operation found Running was interrupted, by a restart of the operator for
+// instance, and fails rather than running twice.
+func (h *RedisClusterHandler) handleOperation(ctx sdk.Context, operation *RedisOperation) error {
+    switch operation.Status.Phase {
+    case OperationPhaseSucceeded, OperationPhaseFailed:
+        return nil
+    case OperationPhaseRunning:
+        return setOperationPhase(operation, OperationPhaseFailed, "The operation was interrupted and is not run again")
+    }
+    namespace, err := objectNamespace(operation)
+    if err != nil {
+        return err
+    }
+
+    // Get the RedisCluster of the operation
+    cluster := &RedisCluster{}
+    err = sdk.Get(cluster, namespace, operation.Spec.ClusterName)
+    if apierrors.IsNotFound(err) {
+        return setOperationPhase(operation, OperationPhaseFailed, fmt.Sprintf("RedisCluster %s not found", operation.Spec.ClusterName))
+    }
+    if err != nil {
+        return err
+    }
+    if isPaused(cluster) {
+        return nil
+    }
+
+    // Record that the operation runs before running it
+    err = setOperationPhase(operation, OperationPhaseRunning, fmt.Sprintf("Running %s", operation.Spec.Type))
+    if err != nil {
+        return err
+    }
+    message, err := h.runOperation(ctx, namespace, cluster, operation.Spec)
+    if err != nil {
+        return setOperationPhase(operation, OperationPhaseFailed, err.Error())
+    }
+    h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonOperation, "Ran operation %s: %s", operation.Spec.Type, message)
+    return setOperationPhase(operation, OperationPhaseSucceeded, message)
+}
+
+// setOperationPhase records the phase of an operation, with its start time
+// when it starts running and its completion time when it ends.
+func setOperationPhase(operation *RedisOperation, phase, message string) error {
+    now := metav1.Now()
+    if phase == OperationPhaseRunning {
+        operation.Status.StartTime = &now
+    } else {
+        operation.Status.CompletionTime = &now
+    }
+    operation.Status.Phase = phase
+    operation.Status.Message = message
+    return sdk.Update(operation)
+}
+
+// reconcileOperationAnnotation runs the operation requested by the
+// operation annotation of the cluster once: it records the operation as
+// Running in the status, runs it, then records its outcome and removes the
+// annotation. An annotation found Running was interrupted and is removed
+// without running again.
+func (h *RedisClusterHandler) reconcileOperationAnnotation(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    value := cluster.ObjectMeta.Annotations[operationAnnotation]
+    if value == "" {
+        return nil
+    }
+    last := cluster.Status.LastOperation
+    now := metav1.Now()
+
+    // Give up on an interrupted operation
+    if last != nil && last.Phase == OperationPhaseRunning && last.Type == value {
+        last.Phase = OperationPhaseFailed
+        last.Message = "The operation was interrupted and is not run again"
+        last.CompletionTime = &now
+        return removeOperationAnnotation(cluster)
+    }
+
+    // Record that the operation runs before running it
+    cluster.Status.LastOperation = &RedisOperationStatus{
+        Type:      value,
+        Phase:     OperationPhaseRunning,
+        Message:   fmt.Sprintf("Running %s", value),
+        StartTime: &now,
+    }
+    err := updateStatus(cluster)
+    if err != nil {
+        return err
+    }
+    spec, err := parseOperationAnnotation(value)
+    message := ""
+    if err == nil {
+        message, err = h.runOperation(ctx, namespace, cluster, spec)
+    }
+
+    // Record the outcome and remove the annotation
+    completed := metav1.Now()
+    cluster.Status.LastOperation.CompletionTime = &completed
+    if err != nil {
+        cluster.Status.LastOperation.Phase = OperationPhaseFailed
+        cluster.Status.LastOperation.Message = err.Error()
+    } else {
+        cluster.Status.LastOperation.Phase = OperationPhaseSucceeded
+        cluster.Status.LastOperation.Message = message
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonOperation, "Ran operation %s: %s", value, message)
+    }
+    return removeOperationAnnotation(cluster)
+}
+
+// removeOperationAnnotation writes the outcome of the operation to the status
+// and then removes the operation annotation, which the status subresource
+// ignores.
+func removeOperationAnnotation(cluster *RedisCluster) error {
+    err := updateStatus(cluster)
+    if err != nil {
+        return err
+    }
+    delete(cluster.ObjectMeta.Annotations, operationAnnotation)
+    return sdk.Update(cluster)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SchemeGroupVersion is the group version of the RedisCluster custom resource.
+var SchemeGroupVersion = schema.GroupVersion{Group: "yaro.io", Version: "v1alpha1"}
+
+// ownerReferences returns the owner references making the RedisCluster the
+// controller of a child object, so that the child is garbage collected along
+// with it.
+func ownerReferences(cluster *RedisCluster) []metav1.OwnerReference {
+    return []metav1.OwnerReference{
+        *metav1.NewControllerRef(cluster, SchemeGroupVersion.WithKind("RedisCluster")),
+    }
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOwnerReferences(t *testing.T) {
+    cluster := newTestCluster(3)
+    references := ownerReferences(cluster)
+    if len(references) != 1 {
+        t.Fatalf("got %d owner references, want 1", len(references))
+    }
+    owner := references[0]
+    if owner.APIVersion != SchemeGroupVersion.String() || owner.Kind != "RedisCluster" {
+        t.Errorf("got owner %s %s, want %s RedisCluster", owner.APIVersion, owner.Kind, SchemeGroupVersion.String())
+    }
+    if owner.Name != cluster.ObjectMeta.Name || owner.UID != cluster.ObjectMeta.UID {
+        t.Errorf("got owner %s with UID %s, want %s with UID %s", owner.Name, owner.UID, cluster.ObjectMeta.Name, cluster.ObjectMeta.UID)
+    }
+    if owner.Controller == nil || !*owner.Controller {
+        t.Error("the RedisCluster is not the controller of its objects")
+    }
+    if owner.BlockOwnerDeletion == nil || !*owner.BlockOwnerDeletion {
+        t.Error("the owner reference does not block the deletion of the RedisCluster")
+    }
+}
+
+func TestStatefulSetIsControlledByTheCluster(t *testing.T) {
+    cluster := newTestCluster(3)
+    labels := map[string]string{"controller": cluster.ObjectMeta.Name}
+    statefulSet := newStatefulSet(cluster, "default", 3, labels, corev1.PodTemplateSpec{})
+
+    controller := metav1.GetControllerOf(statefulSet)
+    if controller == nil || controller.UID != cluster.ObjectMeta.UID {
+        t.Errorf("got controller %v, want the RedisCluster", controller)
+    }
+}
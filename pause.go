@@ -0,0 +1,38 @@
+package main
+
+import (
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pausedAnnotation freezes the reconciliation of a cluster when set to
+// "true", like Spec.Paused.
+const pausedAnnotation = "yaro.io/paused"
+
+// isPaused reports whether the reconciliation of the cluster is paused.
+func isPaused(cluster *RedisCluster) bool {
+    return cluster.Spec.Paused || cluster.ObjectMeta.Annotations[pausedAnnotation] == "true"
+}
+
+// reconcilePause records whether the cluster is paused in its Paused
+// condition and reports whether it is. A cluster that was never paused gets
+// no condition.
+func reconcilePause(namespace string, cluster *RedisCluster) (bool, error) {
+    if isPaused(cluster) {
+        return true, setClusterCondition(namespace, cluster.Name, metav1.Condition{
+            Type:    ConditionPaused,
+            Status:  metav1.ConditionTrue,
+            Reason:  "ReconcilePaused",
+            Message: "The operator leaves the cluster alone until it is resumed",
+        })
+    }
+    if meta.FindStatusCondition(cluster.Status.Conditions, ConditionPaused) == nil {
+        return false, nil
+    }
+    return false, setClusterCondition(namespace, cluster.Name, metav1.Condition{
+        Type:    ConditionPaused,
+        Status:  metav1.ConditionFalse,
+        Reason:  "ReconcileResumed",
+        Message: "The operator reconciles the cluster",
+    })
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "strconv"
+    "strings"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+)
+
+const (
+    // persistenceChecksumAnnotation records the checksum of the persistence
+    // settings the pods start with, so that new settings roll them once the
+    // nodes run with them.
+    persistenceChecksumAnnotation = "yaro.io/persistence-checksum"
+
+    // ReasonPersistenceChanged is the reason of the event recorded when the
+    // nodes run with new persistence settings.
+    ReasonPersistenceChanged = "PersistenceChanged"
+)
+
+// appendFsyncPolicies are the appendfsync values Redis accepts.
+var appendFsyncPolicies = []string{"always", "everysec", "no"}
+
+// persistenceArgs returns the redis-server arguments of the persistence
+// settings, none to keep the defaults of the image.
+func persistenceArgs(spec RedisClusterSpec) []string {
+    persistence := spec.Persistence
+    if persistence == nil {
+        return nil
+    }
+    args := []string{"--save", strings.Join(persistence.Save, " "), "--appendonly", yesNo(persistence.AppendOnly)}
+    if persistence.AppendFsync != "" {
+        args = append(args, "--appendfsync", persistence.AppendFsync)
+    }
+    return args
+}
+
+// validatePersistence checks the snapshot rules and the fsync policy.
+func validatePersistence(spec RedisClusterSpec) error {
+    persistence := spec.Persistence
+    if persistence == nil {
+        return nil
+    }
+    for _, rule := range persistence.Save {
+        fields := strings.Fields(rule)
+        if len(fields) != 2 {
+            return fmt.Errorf("persistence save rule %q must be <seconds> <changes>", rule)
+        }
+        for _, field := range fields {
+            n, err := strconv.Atoi(field)
+            if err != nil || n < 1 {
+                return fmt.Errorf("persistence save rule %q must be two positive numbers", rule)
+            }
+        }
+    }
+    if persistence.AppendFsync != "" {
+        valid := false
+        for _, policy := range appendFsyncPolicies {
+            if persistence.AppendFsync == policy {
+                valid = true
+            }
+        }
+        if !valid {
+            return fmt.Errorf("persistence appendFsync %s is invalid, it must be one of %s", persistence.AppendFsync, strings.Join(appendFsyncPolicies, ", "))
+        }
+    }
+    return nil
+}
+
+// persistenceChecksum returns the checksum of the persistence settings, or
+// an empty string without any.
+func persistenceChecksum(persistence *RedisPersistenceSpec) string {
+    if persistence == nil {
+        return ""
+    }
+    sum := sha256.Sum256([]byte(fmt.Sprintf("%q %t %s", persistence.Save, persistence.AppendOnly, persistence.AppendFsync)))
+    return hex.EncodeToString(sum[:])
+}
+
+// setPersistenceChecksum records on the pod template the checksum of the
+// persistence settings the nodes run with.
+func setPersistenceChecksum(template *corev1.PodTemplateSpec, checksum string) {
+    if checksum == "" {
+        return
+    }
+    if template.ObjectMeta.Annotations == nil {
+        template.ObjectMeta.Annotations = map[string]string{}
+    }
+    template.ObjectMeta.Annotations[persistenceChecksumAnnotation] = checksum
+}
+
+// reconcilePersistence applies changed persistence settings to the ready
+// nodes and records them in the status once every node runs with them and
+// holds its data in the new format. Only then does the checksum on the pod
+// template change, so that no pod restarts with an append only file still
+// being written, or without a snapshot of the data it kept in the file.
+func (h *RedisClusterHandler) reconcilePersistence(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    checksum := persistenceChecksum(cluster.Spec.Persistence)
+    if cluster.Status.PersistenceChecksum == checksum {
+        return nil
+    }
+
+    // Apply the settings to each ready node, until they all persisted
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    pending := false
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        done, err := applyNodePersistence(pod, cluster.Spec.Persistence)
+        if err != nil {
+            return fmt.Errorf("applying the persistence settings to pod %s: %v", pod.Name, err)
+        }
+        if !done {
+            pending = true
+        }
+    }
+    if pending {
+        return nil
+    }
+
+    cluster.Status.PersistenceChecksum = checksum
+    err = updateStatus(cluster)
+    if err != nil {
+        return err
+    }
+    h.recorder.Event(cluster, corev1.EventTypeNormal, ReasonPersistenceChanged, "The nodes run with the new persistence settings, the pods restart with them")
+    return nil
+}
+
+// applyNodePersistence applies the persistence settings to a node with
+// CONFIG SET and reports whether its data is persisted the new way. Turning
+// the append only file on makes Redis rewrite it, which must complete before
+// the node restarts and loads it. Turning it off takes a snapshot first, so
+// that the node does not restart from an older one.
+func applyNodePersistence(pod *corev1.Pod, persistence *RedisPersistenceSpec) (bool, error) {
+    if persistence == nil {
+        return true, nil
+    }
+    client := newRedisClient(pod)
+    defer client.Close()
+
+    // Update the snapshot rules and the fsync policy
+    err := configSet(client, "save", strings.Join(persistence.Save, " "))
+    if err != nil {
+        return false, err
+    }
+    if persistence.AppendFsync != "" {
+        err = configSet(client, "appendfsync", persistence.AppendFsync)
+        if err != nil {
+            return false, err
+        }
+    }
+
+    info, err := getInfo(pod, "persistence")
+    if err != nil {
+        return false, err
+    }
+    if persistence.AppendOnly {
+        // Turn the append only file on and wait for its rewrite
+        if info["aof_enabled"] != "1" {
+            return false, configSet(client, "appendonly", "yes")
+        }
+        if info["aof_rewrite_in_progress"] == "1" || info["aof_rewrite_scheduled"] == "1" {
+            return false, nil
+        }
+        if info["aof_last_bgrewrite_status"] != "ok" {
+            return false, client.BgRewriteAOF().Err()
+        }
+        return true, nil
+    }
+
+    // Snapshot the data before turning the append only file off
+    if info["aof_enabled"] == "1" {
+        err = configSet(client, "appendonly", "no")
+        if err != nil {
+            return false, err
+        }
+        if len(persistence.Save) == 0 {
+            return true, nil
+        }
+        return false, client.BgSave().Err()
+    }
+    if len(persistence.Save) > 0 && (info["rdb_bgsave_in_progress"] == "1" || info["rdb_last_bgsave_status"] != "ok") {
+        if info["rdb_bgsave_in_progress"] != "1" {
+            return false, client.BgSave().Err()
+        }
+        return false, nil
+    }
+    return true, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    corev1 "k8s.io/api/core/v1"
+)
+
+var (
+    // defaultReadinessProbe are the default settings of the readiness probe.
+    defaultReadinessProbe = RedisProbeSpec{
+        InitialDelaySeconds: 5,
+        PeriodSeconds:       10,
+        TimeoutSeconds:      5,
+        FailureThreshold:    3,
+    }
+
+    // defaultLivenessProbe are the default settings of the liveness probe.
+    defaultLivenessProbe = RedisProbeSpec{
+        InitialDelaySeconds: 30,
+        PeriodSeconds:       10,
+        TimeoutSeconds:      5,
+        FailureThreshold:    3,
+    }
+
+    // defaultStartupProbe are the default settings of the startup probe,
+    // giving Redis five minutes to load its dataset.
+    defaultStartupProbe = RedisProbeSpec{
+        InitialDelaySeconds: 5,
+        PeriodSeconds:       10,
+        TimeoutSeconds:      5,
+        FailureThreshold:    30,
+    }
+)
+
+const (
+    // pingReplyReady is the reply to PING of a server ready for clients.
+    pingReplyReady = "PONG"
+
+    // pingReplyAlive matches the replies to PING of a server that is alive,
+    // including one still loading its dataset, as a replica does after a
+    // full resync.
+    pingReplyAlive = "PONG|LOADING"
+)
+
+// probeSettings returns the settings of a probe, taking the defaults for the
+// fields the override leaves unset.
+func probeSettings(defaults RedisProbeSpec, override *RedisProbeSpec) RedisProbeSpec {
+    settings := defaults
+    if override == nil {
+        return settings
+    }
+    if override.InitialDelaySeconds != 0 {
+        settings.InitialDelaySeconds = override.InitialDelaySeconds
+    }
+    if override.PeriodSeconds != 0 {
+        settings.PeriodSeconds = override.PeriodSeconds
+    }
+    if override.TimeoutSeconds != 0 {
+        settings.TimeoutSeconds = override.TimeoutSeconds
+    }
+    if override.FailureThreshold != 0 {
+        settings.FailureThreshold = override.FailureThreshold
+    }
+    return settings
+}
+
+// newRedisProbe builds a probe that pings the local Redis server, over TLS
+// and authenticating with the password from the environment when they are
+// set, and succeeds when the reply matches the pattern.
+func newRedisProbe(spec RedisClusterSpec, settings RedisProbeSpec, reply string) *corev1.Probe {
+    cli := "redis-cli"
+    if spec.TLS != nil {
+        cli += " " + tlsCLIArgs()
+    }
+    command := fmt.Sprintf("%s -h 127.0.0.1 -p %d ping | grep -qE '%s'", cli, clientPort(spec), reply)
+    if passwordSecretRef(spec) != nil {
+        command = fmt.Sprintf("REDISCLI_AUTH=\"$%s\" %s", redisPasswordEnv, command)
+    }
+    return &corev1.Probe{
+        ProbeHandler: corev1.ProbeHandler{
+            Exec: &corev1.ExecAction{
+                Command: []string{"sh", "-c", command},
+            },
+        },
+        InitialDelaySeconds: settings.InitialDelaySeconds,
+        PeriodSeconds:       settings.PeriodSeconds,
+        TimeoutSeconds:      settings.TimeoutSeconds,
+        FailureThreshold:    settings.FailureThreshold,
+    }
+}
+
+// readinessProbe returns the readiness probe of the redis container. The
+// failover relies on it to tell unhealthy pods apart.
+func readinessProbe(spec RedisClusterSpec) *corev1.Probe {
+    var override *RedisProbeSpec
+    if spec.Probes != nil {
+        override = spec.Probes.Readiness
+    }
+    return newRedisProbe(spec, probeSettings(defaultReadinessProbe, override), pingReplyReady)
+}
+
+// livenessProbe returns the liveness probe of the redis container. A server
+// loading its dataset is alive, so it is not restarted in the middle of a
+// long load.
+func livenessProbe(spec RedisClusterSpec) *corev1.Probe {
+    var override *RedisProbeSpec
+    if spec.Probes != nil {
+        override = spec.Probes.Liveness
+    }
+    return newRedisProbe(spec, probeSettings(defaultLivenessProbe, override), pingReplyAlive)
+}
+
+// startupProbe returns the startup probe of the redis container, which holds
+// the liveness probe off until the server first answers.
+func startupProbe(spec RedisClusterSpec) *corev1.Probe {
+    var override *RedisProbeSpec
+    if spec.Probes != nil {
+        override = spec.Probes.Startup
+    }
+    return newRedisProbe(spec, probeSettings(defaultStartupProbe, override), pingReplyAlive)
+}
+
+// sameProbe reports whether two probes run the same command with the same
+// settings. The other fields are defaulted by the API server.
+func sameProbe(existing, desired *corev1.Probe) bool {
+    if existing == nil || desired == nil {
+        return existing == desired
+    }
+    if existing.Exec == nil || desired.Exec == nil || !reflect.DeepEqual(existing.Exec.Command, desired.Exec.Command) {
+        return false
+    }
+    return existing.InitialDelaySeconds == desired.InitialDelaySeconds &&
+        existing.PeriodSeconds == desired.PeriodSeconds &&
+        existing.TimeoutSeconds == desired.TimeoutSeconds &&
+        existing.FailureThreshold == desired.FailureThreshold
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+)
+
+func TestDefaultProbes(t *testing.T) {
+    spec := RedisClusterSpec{}
+    tests := []struct {
+        name     string
+        probe    *corev1.Probe
+        settings RedisProbeSpec
+        reply    string
+    }{
+        {"readiness", readinessProbe(spec), defaultReadinessProbe, pingReplyReady},
+        {"liveness", livenessProbe(spec), defaultLivenessProbe, pingReplyAlive},
+        {"startup", startupProbe(spec), defaultStartupProbe, pingReplyAlive},
+    }
+    for _, test := range tests {
+        probe := test.probe
+        if probe.Exec == nil || len(probe.Exec.Command) != 3 {
+            t.Fatalf("%s probe: got %v, want a shell command", test.name, probe.ProbeHandler)
+        }
+        command := probe.Exec.Command[2]
+        if !strings.Contains(command, "-p 6379 ping") || !strings.Contains(command, test.reply) {
+            t.Errorf("%s probe: got command %q, want a ping of port 6379 matching %s", test.name, command, test.reply)
+        }
+        if strings.Contains(command, "REDISCLI_AUTH") || strings.Contains(command, "--tls") {
+            t.Errorf("%s probe: got command %q, want no authentication or TLS", test.name, command)
+        }
+        if probe.InitialDelaySeconds != test.settings.InitialDelaySeconds || probe.PeriodSeconds != test.settings.PeriodSeconds ||
+            probe.TimeoutSeconds != test.settings.TimeoutSeconds || probe.FailureThreshold != test.settings.FailureThreshold {
+            t.Errorf("%s probe: got %+v, want the settings %+v", test.name, probe, test.settings)
+        }
+    }
+}
+
+func TestProbeOverrides(t *testing.T) {
+    spec := RedisClusterSpec{
+        Probes: &RedisProbesSpec{
+            Readiness: &RedisProbeSpec{PeriodSeconds: 2},
+        },
+    }
+    probe := readinessProbe(spec)
+    if probe.PeriodSeconds != 2 {
+        t.Errorf("got period %d, want the override of 2", probe.PeriodSeconds)
+    }
+    if probe.InitialDelaySeconds != defaultReadinessProbe.InitialDelaySeconds || probe.FailureThreshold != defaultReadinessProbe.FailureThreshold {
+        t.Errorf("got %+v, want the defaults for the fields the override leaves unset", probe)
+    }
+    if !sameProbe(livenessProbe(spec), livenessProbe(RedisClusterSpec{})) {
+        t.Error("the readiness override changed the liveness probe")
+    }
+}
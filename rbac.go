@@ -0,0 +1,165 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    rbacv1 "k8s.io/api/rbac/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// serviceAccountName returns the service account the pods of the cluster run
+// under: the one named in the spec, or the one generated for the cluster.
+func serviceAccountName(cluster *RedisCluster) string {
+    if cluster.Spec.ServiceAccountName != "" {
+        return cluster.Spec.ServiceAccountName
+    }
+    return cluster.ObjectMeta.Name
+}
+
+// validateServiceAccount checks that the service account named in the spec
+// exists.
+func validateServiceAccount(namespace string, spec RedisClusterSpec) error {
+    if spec.ServiceAccountName == "" {
+        return nil
+    }
+    err := sdk.Get(&corev1.ServiceAccount{}, namespace, spec.ServiceAccountName)
+    if apierrors.IsNotFound(err) {
+        return fmt.Errorf("service account %s not found", spec.ServiceAccountName)
+    }
+    return err
+}
+
+// clusterRoleRules returns the rules of the Role of the cluster, which reads
+// the ConfigMaps of the cluster and nothing else. The Secrets the pods use
+// are mounted by the kubelet, which needs no rule.
+func clusterRoleRules(cluster *RedisCluster) []rbacv1.PolicyRule {
+    configMaps := []string{configMapName(cluster)}
+    if cluster.Spec.ConfigMapRef != nil {
+        configMaps = append(configMaps, cluster.Spec.ConfigMapRef.Name)
+    }
+    return []rbacv1.PolicyRule{{
+        APIGroups:     []string{""},
+        Resources:     []string{"configmaps"},
+        ResourceNames: configMaps,
+        Verbs:         []string{"get"},
+    }}
+}
+
+// newServiceAccount builds the service account generated for the pods of the
+// cluster. Redis does not call the API, so the token is not mounted.
+func newServiceAccount(cluster *RedisCluster, namespace string) *corev1.ServiceAccount {
+    name := cluster.ObjectMeta.Name
+    automount := false
+    return &corev1.ServiceAccount{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          map[string]string{"app": name, "controller": name},
+            OwnerReferences: ownerReferences(cluster),
+        },
+        AutomountServiceAccountToken: &automount,
+    }
+}
+
+// newRole builds the Role of the generated service account.
+func newRole(cluster *RedisCluster, namespace string) *rbacv1.Role {
+    name := cluster.ObjectMeta.Name
+    return &rbacv1.Role{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          map[string]string{"app": name, "controller": name},
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Rules: clusterRoleRules(cluster),
+    }
+}
+
+// newRoleBinding builds the RoleBinding granting the Role to the generated
+// service account.
+func newRoleBinding(cluster *RedisCluster, namespace string) *rbacv1.RoleBinding {
+    name := cluster.ObjectMeta.Name
+    return &rbacv1.RoleBinding{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          map[string]string{"app": name, "controller": name},
+            OwnerReferences: ownerReferences(cluster),
+        },
+        RoleRef: rbacv1.RoleRef{
+            APIGroup: rbacv1.GroupName,
+            Kind:     "Role",
+            Name:     name,
+        },
+        Subjects: []rbacv1.Subject{{
+            Kind:      rbacv1.ServiceAccountKind,
+            Name:      name,
+            Namespace: namespace,
+        }},
+    }
+}
+
+// reconcileServiceAccount makes sure the service account of the pods, its
+// Role and its RoleBinding exist and match the spec. A cluster reusing an
+// existing service account gets none, and the ones generated earlier are
+// removed.
+func reconcileServiceAccount(cluster *RedisCluster, namespace string) error {
+    name := cluster.ObjectMeta.Name
+    if cluster.Spec.ServiceAccountName != "" {
+        err := deleteIfControlled(&rbacv1.RoleBinding{}, namespace, name, cluster)
+        if err != nil {
+            return err
+        }
+        err = deleteIfControlled(&rbacv1.Role{}, namespace, name, cluster)
+        if err != nil {
+            return err
+        }
+        if cluster.Spec.ServiceAccountName == name {
+            return nil
+        }
+        return deleteIfControlled(&corev1.ServiceAccount{}, namespace, name, cluster)
+    }
+
+    // Create or update the service account
+    account := newServiceAccount(cluster, namespace)
+    existingAccount := &corev1.ServiceAccount{}
+    _, err := createOrUpdate(account, existingAccount, func() bool {
+        if reflect.DeepEqual(existingAccount.AutomountServiceAccountToken, account.AutomountServiceAccountToken) {
+            return false
+        }
+        existingAccount.AutomountServiceAccountToken = account.AutomountServiceAccountToken
+        return true
+    })
+    if err != nil {
+        return err
+    }
+
+    // Create or update the Role
+    role := newRole(cluster, namespace)
+    existingRole := &rbacv1.Role{}
+    _, err = createOrUpdate(role, existingRole, func() bool {
+        if reflect.DeepEqual(existingRole.Rules, role.Rules) {
+            return false
+        }
+        existingRole.Rules = role.Rules
+        return true
+    })
+    if err != nil {
+        return err
+    }
+
+    // Create or update the RoleBinding, whose role reference is immutable
+    binding := newRoleBinding(cluster, namespace)
+    existingBinding := &rbacv1.RoleBinding{}
+    _, err = createOrUpdate(binding, existingBinding, func() bool {
+        if reflect.DeepEqual(existingBinding.Subjects, binding.Subjects) {
+            return false
+        }
+        existingBinding.Subjects = binding.Subjects
+        return true
+    })
+    return err
+}
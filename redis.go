@@ -0,0 +1,224 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "strconv"
+    "strings"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+// listClusterPods returns the pods of the Redis cluster.
+func listClusterPods(ctx sdk.Context, namespace, name string) (*corev1.PodList, error) {
+    selector := labels.SelectorFromSet(map[string]string{"app": name, "controller": name})
+    return listPods(ctx, namespace, selector.String())
+}
+
+// listPodsWithClientset lists the pods of the namespace matching the label
+// selector through the clientset of the context.
+func listPodsWithClientset(ctx sdk.Context, namespace, selector string) (*corev1.PodList, error) {
+    return ctx.GetClientset().CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector})
+}
+
+// isPodReady reports whether the pod has the PodReady condition.
+func isPodReady(pod *corev1.Pod) bool {
+    for _, condition := range pod.Status.Conditions {
+        if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+            return true
+        }
+    }
+    return false
+}
+
+// forEachReadyNode runs fn against the Redis server of each ready pod of the cluster.
+func forEachReadyNode(ctx sdk.Context, namespace, name string, fn func(client *redis.Client) error) error {
+    // Get the pods for the cluster
+    pods, err := listClusterPods(ctx, namespace, name)
+    if err != nil {
+        return err
+    }
+
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+
+        client := newRedisClient(pod)
+        err = fn(client)
+        client.Close()
+        if err != nil {
+            return fmt.Errorf("pod %s: %v", pod.Name, err)
+        }
+    }
+
+    return nil
+}
+
+// podRedisPort returns the port the Redis server of the pod listens on.
+func podRedisPort(pod *corev1.Pod) int32 {
+    for _, container := range pod.Spec.Containers {
+        for _, port := range container.Ports {
+            if port.Name == redisPortName {
+                return port.ContainerPort
+            }
+        }
+    }
+    return redisPort
+}
+
+// podAddress returns the address of the Redis server of the pod.
+func podAddress(pod *corev1.Pod) string {
+    return net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(podRedisPort(pod))))
+}
+
+// newRedisClient returns a client connected to the Redis server of the pod.
+func newRedisClient(pod *corev1.Pod) *redis.Client {
+    return redis.NewClient(&redis.Options{
+        Addr:      podAddress(pod),
+        Password:  podPassword(pod),
+        TLSConfig: podTLSConfig(pod),
+    })
+}
+
+// configGet returns the current value of a Redis configuration parameter.
+func configGet(client *redis.Client, parameter string) (string, error) {
+    values, err := client.ConfigGet(parameter).Result()
+    if err != nil {
+        return "", err
+    }
+    if len(values) < 2 {
+        return "", nil
+    }
+    value, _ := values[1].(string)
+    return value, nil
+}
+
+// configSet sets a Redis configuration parameter, unless it already has the value.
+func configSet(client *redis.Client, parameter, value string) error {
+    current, err := configGet(client, parameter)
+    if err != nil {
+        return err
+    }
+    if current == value {
+        return nil
+    }
+    return client.ConfigSet(parameter, value).Err()
+}
+
+// redisVersionAtLeast reports whether the Redis server runs at least the given version.
+func redisVersionAtLeast(client *redis.Client, major, minor int) (bool, error) {
+    info, err := client.Info("server").Result()
+    if err != nil {
+        return false, err
+    }
+
+    parts := strings.Split(parseInfo(info)["redis_version"], ".")
+    if len(parts) < 2 {
+        return false, fmt.Errorf("unexpected redis_version %q", parseInfo(info)["redis_version"])
+    }
+    serverMajor, _ := strconv.Atoi(parts[0])
+    serverMinor, _ := strconv.Atoi(parts[1])
+    return serverMajor > major || (serverMajor == major && serverMinor >= minor), nil
+}
+
+// parseInfo parses the output of the INFO command into a field map.
+func parseInfo(info string) map[string]string {
+    fields := map[string]string{}
+    for _, line := range strings.Split(info, "\r\n") {
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        parts := strings.SplitN(line, ":", 2)
+        if len(parts) == 2 {
+            fields[parts[0]] = parts[1]
+        }
+    }
+    return fields
+}
+
+// getInfo runs INFO for a section on the Redis server of the pod.
+func getInfo(pod *corev1.Pod, section string) (map[string]string, error) {
+    client := newRedisClient(pod)
+    defer client.Close()
+
+    info, err := client.Info(section).Result()
+    if err != nil {
+        return nil, err
+    }
+    return parseInfo(info), nil
+}
+
+// getClusterInfo runs INFO for a section on the ready pods of the cluster and
+// returns the fields of each pod by pod name.
+func getClusterInfo(ctx sdk.Context, namespace, name, section string) (map[string]map[string]string, error) {
+    // Get the pods for the cluster
+    pods, err := listClusterPods(ctx, namespace, name)
+    if err != nil {
+        return nil, err
+    }
+
+    infos := map[string]map[string]string{}
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+
+        info, err := getInfo(pod, section)
+        if err != nil {
+            return nil, fmt.Errorf("reading %s info of pod %s: %v", section, pod.Name, err)
+        }
+        infos[pod.Name] = info
+    }
+
+    return infos, nil
+}
+
+// sumInfoField sums an integer INFO field over the nodes.
+func sumInfoField(infos map[string]map[string]string, field string) int64 {
+    var sum int64
+    for _, info := range infos {
+        value, _ := strconv.ParseInt(info[field], 10, 64)
+        sum += value
+    }
+    return sum
+}
+
+// infoCounters returns an integer INFO field of each node.
+func infoCounters(infos map[string]map[string]string, field string) map[string]int64 {
+    counters := map[string]int64{}
+    for node, info := range infos {
+        value, _ := strconv.ParseInt(info[field], 10, 64)
+        counters[node] = value
+    }
+    return counters
+}
+
+// nodeCountersDelta returns how much the counters of the nodes grew between
+// two observations, node by node. A node missing from the previous
+// observation, which was not ready then, adds nothing, so that a node
+// leaving and coming back does not count its whole history again.
+func nodeCountersDelta(previous, current map[string]int64) int64 {
+    var delta int64
+    for node, value := range current {
+        if last, ok := previous[node]; ok {
+            delta += counterDelta(last, value)
+        }
+    }
+    return delta
+}
+
+// counterDelta returns how much a Redis counter grew between two observations.
+// Counters restart from zero with the nodes, in which case the current value
+// is the growth.
+func counterDelta(previous, current int64) int64 {
+    if current < previous {
+        return current
+    }
+    return current - previous
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getReplicationStatus reads INFO REPLICATION from the ready pods of the cluster.
+func getReplicationStatus(ctx sdk.Context, namespace, name string) ([]RedisNodeStatus, error) {
+    // Get the pods for the cluster
+    pods, err := listClusterPods(ctx, namespace, name)
+    if err != nil {
+        return nil, err
+    }
+
+    nodes := []RedisNodeStatus{}
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+
+        info, err := getInfo(pod, "replication")
+        if err != nil {
+            return nil, fmt.Errorf("reading replication info of pod %s: %v", pod.Name, err)
+        }
+
+        connectedSlaves, _ := strconv.Atoi(info["connected_slaves"])
+        nodes = append(nodes, RedisNodeStatus{
+            Name:             pod.Name,
+            Role:             info["role"],
+            ConnectedSlaves:  int32(connectedSlaves),
+            MasterLinkStatus: info["master_link_status"],
+        })
+    }
+
+    return nodes, nil
+}
+
+// setReplicaDisconnectedCondition sets the ReplicaDisconnected condition from
+// the replication status of the cluster.
+func setReplicaDisconnectedCondition(cluster *RedisCluster) {
+    disconnected := []string{}
+    for _, node := range cluster.Status.Replication {
+        if node.MasterLinkStatus == "down" {
+            disconnected = append(disconnected, node.Name)
+        }
+    }
+
+    if len(disconnected) > 0 {
+        meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+            Type:    ConditionReplicaDisconnected,
+            Status:  metav1.ConditionTrue,
+            Reason:  "MasterLinkDown",
+            Message: fmt.Sprintf("Replicas with master link down: %s", strings.Join(disconnected, ", ")),
+        })
+        return
+    }
+
+    meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+        Type:    ConditionReplicaDisconnected,
+        Status:  metav1.ConditionFalse,
+        Reason:  "MasterLinkUp",
+        Message: "All replicas are connected to their master",
+    })
+}
+
+// fullResyncRateThreshold is the number of full resyncs per hour above which the
+// FrequentFullResyncs condition is set.
+const fullResyncRateThreshold = 6
+
+// ReasonFrequentFullResyncs is the reason of the event recorded when the full
+// resync rate of the replicas rises above fullResyncRateThreshold.
+const ReasonFrequentFullResyncs = "FrequentFullResyncs"
+
+// updateResyncStats sums the resync counters from INFO STATS of the nodes and
+// sets the FrequentFullResyncs condition from their rate since the last
+// reconcile, computed node by node, with a Warning event when it rises.
+func (h *RedisClusterHandler) updateResyncStats(cluster *RedisCluster, stats map[string]map[string]string) {
+    // Sum the counters over the nodes
+    resyncs := &RedisResyncStats{
+        SyncFull:       sumInfoField(stats, "sync_full"),
+        SyncPartialErr: sumInfoField(stats, "sync_partial_err"),
+        NodeSyncFull:   infoCounters(stats, "sync_full"),
+        ObservedAt:     metav1.Now(),
+    }
+
+    // Keep the last observation while the counters did not move, no full
+    // resync happened since
+    previous := cluster.Status.Resyncs
+    if previous != nil && reflect.DeepEqual(previous.NodeSyncFull, resyncs.NodeSyncFull) && previous.SyncPartialErr == resyncs.SyncPartialErr {
+        meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+            Type:    ConditionFrequentFullResyncs,
+            Status:  metav1.ConditionFalse,
+            Reason:  "FullResyncRateNormal",
+            Message: fmt.Sprintf("No full resyncs since %s", previous.ObservedAt.UTC().Format(time.RFC3339)),
+        })
+        return
+    }
+    cluster.Status.Resyncs = resyncs
+    if previous == nil {
+        return
+    }
+
+    // Compute the full resync rate since the last observation
+    fullResyncs := nodeCountersDelta(previous.NodeSyncFull, resyncs.NodeSyncFull)
+    elapsed := resyncs.ObservedAt.Sub(previous.ObservedAt.Time)
+    if elapsed <= 0 {
+        return
+    }
+    rate := float64(fullResyncs) / elapsed.Hours()
+
+    if rate > fullResyncRateThreshold {
+        message := fmt.Sprintf("%d full resyncs in the last %s", fullResyncs, elapsed.Round(time.Second))
+        if !meta.IsStatusConditionTrue(cluster.Status.Conditions, ConditionFrequentFullResyncs) {
+            h.recorder.Event(cluster, corev1.EventTypeWarning, ReasonFrequentFullResyncs, message)
+        }
+        meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+            Type:    ConditionFrequentFullResyncs,
+            Status:  metav1.ConditionTrue,
+            Reason:  "FullResyncRateHigh",
+            Message: message,
+        })
+        return
+    }
+
+    meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+        Type:    ConditionFrequentFullResyncs,
+        Status:  metav1.ConditionFalse,
+        Reason:  "FullResyncRateNormal",
+        Message: fmt.Sprintf("%d full resyncs in the last %s", fullResyncs, elapsed.Round(time.Second)),
+    })
+}
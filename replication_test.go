@@ -0,0 +1,57 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    "time"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// resyncStats returns INFO STATS of a node with the given full resyncs.
+func resyncStats(syncFull string) map[string]map[string]string {
+    return map[string]map[string]string{"cache-0": {"sync_full": syncFull, "sync_partial_err": "0"}}
+}
+
+func TestUpdateResyncStatsWarnsOnce(t *testing.T) {
+    handler, recorder := newTestHandler()
+    cluster := newTestCluster(3)
+    cluster.Status.Resyncs = &RedisResyncStats{
+        NodeSyncFull: map[string]int64{"cache-0": 0},
+        ObservedAt:   metav1.NewTime(time.Now().Add(-time.Hour)),
+    }
+
+    handler.updateResyncStats(cluster, resyncStats("10"))
+    if !meta.IsStatusConditionTrue(cluster.Status.Conditions, ConditionFrequentFullResyncs) {
+        t.Fatal("got FrequentFullResyncs unset for 10 full resyncs in an hour")
+    }
+    events := recordedEvents(recorder)
+    if len(events) != 1 || !strings.HasPrefix(events[0], "Warning "+ReasonFrequentFullResyncs) {
+        t.Fatalf("got events %v, want one %s warning", events, ReasonFrequentFullResyncs)
+    }
+
+    cluster.Status.Resyncs.ObservedAt = metav1.NewTime(time.Now().Add(-time.Hour))
+    handler.updateResyncStats(cluster, resyncStats("20"))
+    if events := recordedEvents(recorder); len(events) != 0 {
+        t.Errorf("got events %v while the condition was already set, want none", events)
+    }
+}
+
+func TestUpdateResyncStatsUnchangedCounters(t *testing.T) {
+    handler, _ := newTestHandler()
+    cluster := newTestCluster(3)
+    observedAt := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+    cluster.Status.Resyncs = &RedisResyncStats{
+        SyncFull:     2,
+        NodeSyncFull: map[string]int64{"cache-0": 2},
+        ObservedAt:   observedAt,
+    }
+
+    handler.updateResyncStats(cluster, resyncStats("2"))
+    if !cluster.Status.Resyncs.ObservedAt.Equal(&observedAt) {
+        t.Errorf("got ObservedAt %s, want %s kept while the counters did not move", cluster.Status.Resyncs.ObservedAt, observedAt)
+    }
+    if meta.IsStatusConditionTrue(cluster.Status.Conditions, ConditionFrequentFullResyncs) {
+        t.Error("got FrequentFullResyncs set without full resyncs")
+    }
+}
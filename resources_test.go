@@ -0,0 +1,30 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPodTemplateResources(t *testing.T) {
+    cluster := newTestCluster(3)
+    container := newPodTemplate(cluster, nil).Spec.Containers[0]
+    if len(container.Resources.Requests) != 0 || len(container.Resources.Limits) != 0 {
+        t.Errorf("got resources %v without resources in the spec, want none", container.Resources)
+    }
+
+    cluster.Spec.Resources = corev1.ResourceRequirements{
+        Requests: corev1.ResourceList{
+            corev1.ResourceCPU:    resource.MustParse("100m"),
+            corev1.ResourceMemory: resource.MustParse("256Mi"),
+        },
+        Limits: corev1.ResourceList{
+            corev1.ResourceMemory: resource.MustParse("512Mi"),
+        },
+    }
+    container = newPodTemplate(cluster, nil).Spec.Containers[0]
+    if !reflect.DeepEqual(container.Resources, cluster.Spec.Resources) {
+        t.Errorf("got resources %v, want %v", container.Resources, cluster.Spec.Resources)
+    }
+}
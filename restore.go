@@ -0,0 +1,408 @@
+package main
+
+import (
+    "fmt"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisClusterRestore is the custom resource restoring a RedisCluster from a
+// snapshot in object storage.
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type RedisClusterRestore struct {
+    metav1.TypeMeta   `json:",inline"`
+    metav1.ObjectMeta `json:"metadata"`
+    Spec              RedisClusterRestoreSpec   `json:"spec"`
+    Status            RedisClusterRestoreStatus `json:"status,omitempty"`
+}
+
+// RedisClusterRestoreList is a list of RedisClusterRestore resources.
+// +kubebuilder:object:root=true
+type RedisClusterRestoreList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata"`
+    Items           []RedisClusterRestore `json:"items"`
+}
+
+// RedisClusterRestoreSpec is the spec for a RedisClusterRestore resource.
+type RedisClusterRestoreSpec struct {
+    // ClusterName is the RedisCluster to restore, in the namespace of the restore.
+    ClusterName string `json:"clusterName"`
+
+    // Bucket is the bucket holding the snapshot.
+    Bucket string `json:"bucket"`
+
+    // Key is the key of the RDB snapshot in the bucket, as uploaded by the
+    // backups under <prefix>/<namespace>/<cluster>/.
+    Key string `json:"key"`
+
+    // Endpoint is the URL of an S3-compatible service, AWS S3 by default.
+    Endpoint string `json:"endpoint,omitempty"`
+
+    // Region is the region of the bucket.
+    Region string `json:"region,omitempty"`
+
+    // CredentialsSecretRef names a Secret holding the AWS_ACCESS_KEY_ID and
+    // AWS_SECRET_ACCESS_KEY of the bucket.
+    CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+
+    // Image is the image downloading the snapshot, which needs the aws CLI.
+    Image string `json:"image,omitempty"`
+}
+
+// RedisClusterRestoreStatus is the progress of a restore.
+type RedisClusterRestoreStatus struct {
+    // Phase is Restoring, Loading, Completed or Failed.
+    Phase string `json:"phase,omitempty"`
+
+    // Message explains the phase.
+    Message string `json:"message,omitempty"`
+
+    // StartTime is when the restore started.
+    StartTime *metav1.Time `json:"startTime,omitempty"`
+
+    // CompletionTime is when the restore completed or failed.
+    CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+const (
+    // RestorePhaseRestoring is the phase of a restore waiting for the pod
+    // template of the cluster to download the snapshot.
+    RestorePhaseRestoring = "Restoring"
+
+    // RestorePhaseLoading is the phase of a restore whose pods were
+    // replaced and are loading the snapshot.
+    RestorePhaseLoading = "Loading"
+
+    // RestorePhaseCompleted is the phase of a restore whose pods all came
+    // back with the snapshot.
+    RestorePhaseCompleted = "Completed"
+
+    // RestorePhaseFailed is the phase of a restore that did not complete.
+    RestorePhaseFailed = "Failed"
+)
+
+const (
+    // restoreAnnotation names the restore in progress on a RedisCluster.
+    restoreAnnotation = "yaro.io/restore"
+
+    // restoreContainerName is the name of the init container downloading the snapshot.
+    restoreContainerName = "restore"
+
+    // restoreUIDEnv carries the UID of the restore in the restore init container.
+    restoreUIDEnv = "YARO_RESTORE_UID"
+
+    // restoreDirEnv carries the working directory of Redis in the restore
+    // init container.
+    restoreDirEnv = "YARO_DATA_DIR"
+
+    // restoreMaxRestarts is the number of failed downloads after which the restore fails.
+    restoreMaxRestarts = 3
+
+    // ReasonRestored is the reason of the event recorded when a restore completes.
+    ReasonRestored = "Restored"
+
+    // ReasonRestoreFailed is the reason of the event recorded when a restore fails.
+    ReasonRestoreFailed = "RestoreFailed"
+)
+
+// restoreScript returns the script replacing the data of a node with the
+// snapshot. A marker file named after the restore keeps restarted pods from
+// downloading the snapshot again. The append-only files are removed, or
+// Redis would load them instead of the snapshot.
+func restoreScript(restore *RedisClusterRestore) string {
+    dir := `"$` + restoreDirEnv + `"`
+    marker := `"$` + restoreDirEnv + `/.restored-$` + restoreUIDEnv + `"`
+    download := s3CopyScript(`"s3://$`+bucketEnv+`/$`+keyEnv+`"`, `"$`+restoreDirEnv+`/`+backupFile+`"`, restore.Spec.Endpoint)
+    return fmt.Sprintf(`set -e; if [ ! -f %s ]; then mkdir -p %s; rm -rf "$%s/appendonlydir" "$%s/appendonly.aof"; %s; touch %s; fi`,
+        marker, dir, restoreDirEnv, restoreDirEnv, download, marker)
+}
+
+// restoreContainer builds the init container seeding the data volume of a
+// node with the snapshot of the restore.
+func restoreContainer(spec RedisClusterSpec, restore *RedisClusterRestore) corev1.Container {
+    image := restore.Spec.Image
+    if image == "" {
+        image = defaultBackupImage
+    }
+    container := corev1.Container{
+        Name:            restoreContainerName,
+        Image:           image,
+        Command:         []string{"sh", "-c", restoreScript(restore)},
+        SecurityContext: containerSecurityContext(spec),
+        EnvFrom: []corev1.EnvFromSource{{
+            SecretRef: &corev1.SecretEnvSource{
+                LocalObjectReference: restore.Spec.CredentialsSecretRef,
+            },
+        }},
+        Env: append([]corev1.EnvVar{
+            {Name: restoreUIDEnv, Value: string(restore.ObjectMeta.UID)},
+            {Name: restoreDirEnv, Value: workingDir(spec)},
+        }, objectStorageEnv(restore.Spec.Bucket, restore.Spec.Key, restore.Spec.Endpoint)...),
+        VolumeMounts: []corev1.VolumeMount{{
+            Name:      dataVolumeName,
+            MountPath: dataMountPath,
+        }},
+    }
+    if restore.Spec.Region != "" {
+        container.Env = append(container.Env, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: restore.Spec.Region})
+    }
+    return container
+}
+
+// activeRestore returns the restore in progress on a cluster, or nil if there is none.
+func activeRestore(namespace string, cluster *RedisCluster) (*RedisClusterRestore, error) {
+    name := cluster.ObjectMeta.Annotations[restoreAnnotation]
+    if name == "" {
+        return nil, nil
+    }
+    restore := &RedisClusterRestore{}
+    err := sdk.Get(restore, namespace, name)
+    if apierrors.IsNotFound(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if restore.Status.Phase != RestorePhaseRestoring && restore.Status.Phase != RestorePhaseLoading {
+        return nil, nil
+    }
+    return restore, nil
+}
+
+// hasRestoreContainer reports whether the pod template downloads the snapshot of the restore.
+func hasRestoreContainer(template corev1.PodTemplateSpec, restore *RedisClusterRestore) bool {
+    for _, container := range template.Spec.InitContainers {
+        if container.Name != restoreContainerName {
+            continue
+        }
+        for _, env := range container.Env {
+            if env.Name == restoreUIDEnv && env.Value == string(restore.ObjectMeta.UID) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// isRestoredPod reports whether the pod is a ready replacement that ran the
+// restore init container.
+func isRestoredPod(pod *corev1.Pod) bool {
+    if pod.DeletionTimestamp != nil || !isPodReady(pod) {
+        return false
+    }
+    for _, status := range pod.Status.InitContainerStatuses {
+        if status.Name == restoreContainerName {
+            return true
+        }
+    }
+    return false
+}
+
+// restoreFailure returns why a pod failed to download the snapshot, or an
+// empty string if it did not fail repeatedly.
+func restoreFailure(pod *corev1.Pod) string {
+    for _, status := range pod.Status.InitContainerStatuses {
+        if status.Name != restoreContainerName || status.RestartCount < restoreMaxRestarts {
+            continue
+        }
+        if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.ExitCode != 0 {
+            return fmt.Sprintf("pod %s failed to download the snapshot %d times, last exit code %d", pod.Name, status.RestartCount, terminated.ExitCode)
+        }
+    }
+    return ""
+}
+
+// handleRestore drives a restore through its phases. It names itself on the
+// cluster so that the pod template gets the restore init container, then
+// replaces all the pods at once, so that no node resyncs the old data from
+// another, and completes once they are all ready.
+func (h *RedisClusterHandler) handleRestore(ctx sdk.Context, restore *RedisClusterRestore) error {
+    namespace, err := objectNamespace(restore)
+    if err != nil {
+        return err
+    }
+    if restore.Status.Phase == RestorePhaseCompleted || restore.Status.Phase == RestorePhaseFailed {
+        return nil
+    }
+
+    // Get the RedisCluster to restore
+    cluster := &RedisCluster{}
+    err = sdk.Get(cluster, namespace, restore.Spec.ClusterName)
+    if apierrors.IsNotFound(err) {
+        return setRestorePhase(restore, RestorePhaseFailed, fmt.Sprintf("RedisCluster %s not found", restore.Spec.ClusterName))
+    }
+    if err != nil {
+        return err
+    }
+
+    // Hold the restore while the cluster is paused
+    if isPaused(cluster) {
+        return nil
+    }
+
+    switch restore.Status.Phase {
+    case "":
+        return h.startRestore(namespace, cluster, restore)
+    case RestorePhaseRestoring:
+        return h.replaceRestoredPods(ctx, namespace, cluster, restore)
+    default:
+        return h.completeRestore(ctx, namespace, cluster, restore)
+    }
+}
+
+// startRestore checks the restore and names it on the cluster.
+func (h *RedisClusterHandler) startRestore(namespace string, cluster *RedisCluster, restore *RedisClusterRestore) error {
+    err := validateRestore(namespace, cluster, restore)
+    if err != nil {
+        return setRestorePhase(restore, RestorePhaseFailed, err.Error())
+    }
+    if current := cluster.ObjectMeta.Annotations[restoreAnnotation]; current != "" && current != restore.ObjectMeta.Name {
+        other, err := activeRestore(namespace, cluster)
+        if err != nil {
+            return err
+        }
+        if other != nil {
+            return fmt.Errorf("RedisCluster %s is being restored by %s", cluster.ObjectMeta.Name, current)
+        }
+    }
+
+    // Name the restore on the cluster
+    if cluster.ObjectMeta.Annotations == nil {
+        cluster.ObjectMeta.Annotations = map[string]string{}
+    }
+    cluster.ObjectMeta.Annotations[restoreAnnotation] = restore.ObjectMeta.Name
+    err = sdk.Update(cluster)
+    if err != nil {
+        return err
+    }
+
+    now := metav1.Now()
+    restore.Status.StartTime = &now
+    return setRestorePhase(restore, RestorePhaseRestoring, "Waiting for the pod template to download the snapshot")
+}
+
+// replaceRestoredPods deletes all the pods of the cluster once its
+// StatefulSet downloads the snapshot.
+func (h *RedisClusterHandler) replaceRestoredPods(ctx sdk.Context, namespace string, cluster *RedisCluster, restore *RedisClusterRestore) error {
+    statefulSet := &appsv1.StatefulSet{}
+    err := sdk.Get(statefulSet, namespace, cluster.ObjectMeta.Name)
+    if apierrors.IsNotFound(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if !hasRestoreContainer(statefulSet.Spec.Template, restore) || statefulSet.Status.ObservedGeneration < statefulSet.ObjectMeta.Generation {
+        return nil
+    }
+
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    for _, pod := range pods.Items {
+        err = ctx.GetClientset().CoreV1().Pods(namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+        if err != nil && !apierrors.IsNotFound(err) {
+            return err
+        }
+    }
+    return setRestorePhase(restore, RestorePhaseLoading, fmt.Sprintf("Replaced %d pods to load the snapshot", len(pods.Items)))
+}
+
+// completeRestore waits for the pods to come back with the snapshot, then
+// completes the restore and removes it from the cluster. A pod failing to
+// download the snapshot fails the restore.
+func (h *RedisClusterHandler) completeRestore(ctx sdk.Context, namespace string, cluster *RedisCluster, restore *RedisClusterRestore) error {
+    statefulSet := &appsv1.StatefulSet{}
+    err := sdk.Get(statefulSet, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+
+    // Fail on a pod that cannot download the snapshot
+    for i := range pods.Items {
+        if failure := restoreFailure(&pods.Items[i]); failure != "" {
+            h.recorder.Eventf(cluster, corev1.EventTypeWarning, ReasonRestoreFailed, "Restore %s failed: %s", restore.ObjectMeta.Name, failure)
+            return h.endRestore(cluster, restore, RestorePhaseFailed, failure)
+        }
+    }
+
+    // Wait for all the pods to be ready with the snapshot
+    ready := 0
+    for i := range pods.Items {
+        if isRestoredPod(&pods.Items[i]) {
+            ready++
+        }
+    }
+    if statefulSet.Spec.Replicas == nil || ready < int(*statefulSet.Spec.Replicas) {
+        return nil
+    }
+
+    h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonRestored, "Restored from s3://%s/%s", restore.Spec.Bucket, restore.Spec.Key)
+    return h.endRestore(cluster, restore, RestorePhaseCompleted, fmt.Sprintf("Restored %d pods from s3://%s/%s", ready, restore.Spec.Bucket, restore.Spec.Key))
+}
+
+// endRestore removes the restore from the cluster and records its outcome.
+// The pod template loses the restore init container, which the pods drop on
+// their next replacement.
+func (h *RedisClusterHandler) endRestore(cluster *RedisCluster, restore *RedisClusterRestore, phase, message string) error {
+    delete(cluster.ObjectMeta.Annotations, restoreAnnotation)
+    err := sdk.Update(cluster)
+    if err != nil {
+        return err
+    }
+    now := metav1.Now()
+    restore.Status.CompletionTime = &now
+    return setRestorePhase(restore, phase, message)
+}
+
+// setRestorePhase records the phase of a restore.
+func setRestorePhase(restore *RedisClusterRestore, phase, message string) error {
+    restore.Status.Phase = phase
+    restore.Status.Message = message
+    if phase == RestorePhaseFailed && restore.Status.CompletionTime == nil {
+        now := metav1.Now()
+        restore.Status.CompletionTime = &now
+    }
+    return sdk.Update(restore)
+}
+
+// validateRestore checks the restore against the cluster and that the
+// credentials Secret holds the keys the download needs.
+func validateRestore(namespace string, cluster *RedisCluster, restore *RedisClusterRestore) error {
+    if restore.Spec.Bucket == "" || restore.Spec.Key == "" {
+        return fmt.Errorf("bucket and key must be set")
+    }
+    err := validateObjectStorage(restore.Spec.Bucket, restore.Spec.Key, restore.Spec.Endpoint)
+    if err != nil {
+        return err
+    }
+    if cluster.Spec.Mode == ModeCluster {
+        return fmt.Errorf("clusters in cluster mode cannot be restored from a single snapshot")
+    }
+    secret := &corev1.Secret{}
+    err = sdk.Get(secret, namespace, restore.Spec.CredentialsSecretRef.Name)
+    if apierrors.IsNotFound(err) {
+        return fmt.Errorf("credentials secret %s not found", restore.Spec.CredentialsSecretRef.Name)
+    }
+    if err != nil {
+        return err
+    }
+    for _, key := range backupCredentialKeys {
+        if len(secret.Data[key]) == 0 {
+            return fmt.Errorf("credentials secret %s has no key %s", restore.Spec.CredentialsSecretRef.Name, key)
+        }
+    }
+    return nil
+}
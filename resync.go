@@ -0,0 +1,101 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "time"
+    "golang.org/x/time/rate"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+var (
+    // resyncPeriod is how often the watches deliver all the objects again,
+    // which catches drift that raised no watch event.
+    resyncPeriod = flag.Duration("resync-period", 30*time.Second, "how often every watched object is reconciled again")
+
+    // reconcileQPS and reconcileBurst limit the rate of the reconciles of
+    // the RedisClusters across all clusters.
+    reconcileQPS   = flag.Float64("reconcile-qps", 10, "largest number of cluster reconciles per second")
+    reconcileBurst = flag.Int("reconcile-burst", 20, "number of cluster reconciles allowed above reconcile-qps in a burst")
+
+    // initialBackoff and maxBackoff bound the delay before retrying a failed
+    // reconcile, which doubles with each consecutive failure.
+    initialBackoff = flag.Duration("reconcile-backoff", 5*time.Second, "delay before retrying a failed reconcile")
+    maxBackoff     = flag.Duration("reconcile-max-backoff", 5*time.Minute, "longest delay between retries of a failing reconcile")
+)
+
+// lastReconcile is the last successful reconcile of a RedisCluster, with the
+// generation of its spec and its annotations at the time.
+// +kubebuilder:object:generate=false
+type lastReconcile struct {
+    generation  int64
+    annotations map[string]string
+    time        time.Time
+}
+
+// newReconcileLimiter returns the limiter shared by the reconciles of the
+// RedisClusters.
+func newReconcileLimiter() *rate.Limiter {
+    return rate.NewLimiter(rate.Limit(*reconcileQPS), *reconcileBurst)
+}
+
+// waitReconcile blocks until the rate limit lets another reconcile through.
+func (h *RedisClusterHandler) waitReconcile() error {
+    return h.limiter.Wait(context.Background())
+}
+
+// validateReconcilePeriod checks the reconcile period of the spec.
+func validateReconcilePeriod(spec RedisClusterSpec) error {
+    if spec.ReconcilePeriod != nil && spec.ReconcilePeriod.Duration < 0 {
+        return fmt.Errorf("reconcilePeriod %s is invalid, it must not be negative", spec.ReconcilePeriod.Duration)
+    }
+    return nil
+}
+
+// isResyncDue reports whether the cluster needs a reconcile. A cluster whose
+// spec and annotations did not change since its last successful reconcile is
+// only reconciled again once its reconcile period elapsed; the period is
+// counted in resyncs, which deliver the unchanged cluster every
+// --resync-period. Status updates, which the reconciles write themselves, do
+// not make a reconcile due.
+func (h *RedisClusterHandler) isResyncDue(cluster *RedisCluster) bool {
+    period := cluster.Spec.ReconcilePeriod
+    if period == nil {
+        return true
+    }
+    key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+    h.mu.Lock()
+    last, ok := h.lastReconciles[key]
+    h.mu.Unlock()
+    if !ok || last.generation != cluster.Generation || !sameAnnotations(last.annotations, cluster.Annotations) {
+        return true
+    }
+    return time.Since(last.time) >= period.Duration
+}
+
+// sameAnnotations reports whether two sets of annotations are equal, a nil set
+// being equal to an empty one.
+func sameAnnotations(a, b map[string]string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for name, value := range a {
+        if other, ok := b[name]; !ok || other != value {
+            return false
+        }
+    }
+    return true
+}
+
+// recordReconcile records a successful reconcile of the cluster.
+func (h *RedisClusterHandler) recordReconcile(cluster *RedisCluster) {
+    key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+    annotations := map[string]string{}
+    for name, value := range cluster.Annotations {
+        annotations[name] = value
+    }
+    h.mu.Lock()
+    h.lastReconciles[key] = lastReconcile{generation: cluster.Generation, annotations: annotations, time: time.Now()}
+    h.mu.Unlock()
+}
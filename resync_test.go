@@ -0,0 +1,45 @@
+package main
+
+import (
+    "testing"
+    "time"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+func TestIsResyncDue(t *testing.T) {
+    handler, _ := newTestHandler()
+    cluster := newTestCluster(3)
+    cluster.Generation = 1
+    cluster.ResourceVersion = "100"
+    cluster.Spec.ReconcilePeriod = &metav1.Duration{Duration: 10 * time.Minute}
+    if !handler.isResyncDue(cluster) {
+        t.Fatal("got a cluster never reconciled left alone")
+    }
+    handler.recordReconcile(cluster)
+
+    // The reconcile writes the status, which bumps the resource version
+    cluster.ResourceVersion = "101"
+    cluster.Status.ReadyReplicas = 3
+    if handler.isResyncDue(cluster) {
+        t.Error("got a status update making the reconcile due")
+    }
+
+    annotated := cluster.DeepCopy()
+    annotated.Annotations = map[string]string{pausedAnnotation: "true"}
+    if !handler.isResyncDue(annotated) {
+        t.Error("got an annotation change left alone")
+    }
+
+    changed := cluster.DeepCopy()
+    changed.Generation = 2
+    if !handler.isResyncDue(changed) {
+        t.Error("got a spec change left alone")
+    }
+
+    key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+    handler.lastReconciles[key] = lastReconcile{generation: 1, time: time.Now().Add(-11 * time.Minute)}
+    if !handler.isResyncDue(cluster) {
+        t.Error("got the cluster left alone after its reconcile period")
+    }
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+    "fmt"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+)
+
+const (
+    // roleLabel is the pod label holding the replication role of the node.
+    roleLabel = "role"
+
+    // RoleMaster is the role label of the nodes accepting writes.
+    RoleMaster = "master"
+
+    // RoleReplica is the role label of the nodes replicating a master.
+    RoleReplica = "replica"
+)
+
+// podRole returns the role label of a node from its INFO replication role.
+func podRole(role string) string {
+    switch role {
+    case "master":
+        return RoleMaster
+    case "slave":
+        return RoleReplica
+    default:
+        return ""
+    }
+}
+
+// labelPodRoles labels the pods with the replication roles of their nodes,
+// so that the master and replica Services follow failovers. Pods whose role
+// is unknown keep their label until it is read again.
+func labelPodRoles(pods []corev1.Pod, nodes []RedisNodeStatus) error {
+    roles := map[string]string{}
+    for _, node := range nodes {
+        roles[node.Name] = podRole(node.Role)
+    }
+
+    for i := range pods {
+        pod := &pods[i]
+        role := roles[pod.Name]
+        if role == "" || pod.Labels[roleLabel] == role {
+            continue
+        }
+        if pod.Labels == nil {
+            pod.Labels = map[string]string{}
+        }
+        pod.Labels[roleLabel] = role
+        err := sdk.Update(pod)
+        if err != nil {
+            return fmt.Errorf("labelling pod %s as %s: %v", pod.Name, role, err)
+        }
+    }
+    return nil
+}
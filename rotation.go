@@ -0,0 +1,140 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "time"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+    // passwordChecksumAnnotation records the checksum of the password the
+    // pods start with, so that a new password rolls them.
+    passwordChecksumAnnotation = "yaro.io/password-checksum"
+
+    // rotatedAtAnnotation records when the operator last generated the
+    // password of an auth Secret.
+    rotatedAtAnnotation = "yaro.io/rotated-at"
+
+    // ReasonPasswordRotated is the reason of the event recorded when the
+    // nodes accept a new password.
+    ReasonPasswordRotated = "PasswordRotated"
+)
+
+// passwordChecksum returns the checksum of a password recorded on the pod
+// template, or an empty string without a password.
+func passwordChecksum(password string) string {
+    if password == "" {
+        return ""
+    }
+    sum := sha256.Sum256([]byte(password))
+    return hex.EncodeToString(sum[:])
+}
+
+// setPasswordChecksum records the checksum of the password on the pod template.
+func setPasswordChecksum(template *corev1.PodTemplateSpec, password string) {
+    checksum := passwordChecksum(password)
+    if checksum == "" {
+        return
+    }
+    if template.ObjectMeta.Annotations == nil {
+        template.ObjectMeta.Annotations = map[string]string{}
+    }
+    template.ObjectMeta.Annotations[passwordChecksumAnnotation] = checksum
+}
+
+// rotateGeneratedPassword generates a new password in the auth Secret the
+// operator generated for the cluster once the rotation period of the spec
+// elapsed. Secrets named in the spec are rotated by their owners.
+func rotateGeneratedPassword(namespace string, cluster *RedisCluster) error {
+    auth := cluster.Spec.Auth
+    if auth == nil || auth.RotationPeriod == nil || auth.SecretName != authSecretName(cluster) {
+        return nil
+    }
+    secret := &corev1.Secret{}
+    err := sdk.Get(secret, namespace, auth.SecretName)
+    if err != nil {
+        return err
+    }
+    if owner := metav1.GetControllerOf(secret); owner == nil || owner.UID != cluster.UID {
+        return nil
+    }
+
+    // Wait for the rotation period to elapse
+    rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[rotatedAtAnnotation])
+    if err != nil {
+        rotatedAt = secret.CreationTimestamp.Time
+    }
+    if time.Since(rotatedAt) < auth.RotationPeriod.Duration {
+        return nil
+    }
+
+    // Generate the new password
+    password, err := generatePassword()
+    if err != nil {
+        return err
+    }
+    if secret.Data == nil {
+        secret.Data = map[string][]byte{}
+    }
+    secret.Data[authSecretKey] = []byte(password)
+    if secret.Annotations == nil {
+        secret.Annotations = map[string]string{}
+    }
+    secret.Annotations[rotatedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+    return sdk.Update(secret)
+}
+
+// acceptNewPassword makes the running nodes accept the new password of the
+// cluster next to the one they started with, and the replicas authenticate
+// to their master with it, before the pods roll to it. The old password
+// keeps working until each pod is replaced, so clients can move over in the
+// meantime.
+//
+// The operator authenticates with the password it last read for the
+// cluster. If it restarted after the Secret changed, it no longer knows the
+// old password, and the pods only pick the new one up as they roll.
+func (h *RedisClusterHandler) acceptNewPassword(ctx sdk.Context, namespace string, cluster *RedisCluster, password string) error {
+    key := types.NamespacedName{Namespace: namespace, Name: cluster.ObjectMeta.Name}
+    passwordsMu.Lock()
+    previous, known := passwords[key]
+    passwordsMu.Unlock()
+    if !known || password == "" || previous == password {
+        return nil
+    }
+
+    // Add the new password on each ready node
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    nodes := 0
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        client := redis.NewClient(&redis.Options{
+            Addr:      podAddress(pod),
+            Password:  previous,
+            TLSConfig: podTLSConfig(pod),
+        })
+        err = client.Process(redis.NewStatusCmd("acl", "setuser", reservedUsername, ">"+password))
+        if err == nil {
+            err = configSet(client, "masterauth", password)
+        }
+        client.Close()
+        if err != nil {
+            return fmt.Errorf("adding the new password on pod %s: %v", pod.Name, err)
+        }
+        nodes++
+    }
+
+    h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonPasswordRotated, "Added the new password on %d nodes, the pods are replaced to drop the old one", nodes)
+    return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+// scaleSelector returns the label selector of the pods of the cluster, which
+// the scale subresource exposes so that a HorizontalPodAutoscaler can read
+// the metrics of the pods.
+func scaleSelector(name string) string {
+    return labels.SelectorFromSet(map[string]string{"app": name, "controller": name}).String()
+}
+
+// scaleReplicas returns the size the cluster runs at, in the unit of
+// Spec.Size, from its pod count. The size of a sharded cluster counts its
+// masters, each running with its replicas.
+func scaleReplicas(spec RedisClusterSpec, pods int) int32 {
+    if spec.Mode == ModeCluster {
+        return int32(pods) / (1 + replicasPerMaster(spec))
+    }
+    return int32(pods)
+}
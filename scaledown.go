@@ -0,0 +1,232 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+// ReasonScalingDown is the reason of the event recorded when the operator
+// moves the master off the pods being removed before it scales down.
+const ReasonScalingDown = "ScalingDown"
+
+// replicationReplicas returns the replica count of the StatefulSet of a
+// cluster in standalone or sentinel mode. When the cluster shrinks and the
+// master runs on one of the pods being removed, the pods are kept until the
+// master role moved to one of the remaining pods.
+func (h *RedisClusterHandler) replicationReplicas(ctx sdk.Context, namespace string, cluster *RedisCluster) (int32, error) {
+    desired := podCount(cluster.Spec)
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return 0, err
+    }
+
+    // Find the master among the pods being removed
+    var master *corev1.Pod
+    kept := []corev1.Pod{}
+    leaving := []*corev1.Pod{}
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if podOrdinal(pod) < int(desired) {
+            kept = append(kept, *pod)
+            continue
+        }
+        if !isPodReady(pod) {
+            continue
+        }
+        leaving = append(leaving, pod)
+        replicated, err := isReplicatedMaster(pod)
+        if err != nil {
+            return 0, fmt.Errorf("reading the role of pod %s: %v", pod.Name, err)
+        }
+        if replicated {
+            master = pod
+        }
+    }
+    if master == nil {
+        return desired, nil
+    }
+
+    // Once a remaining pod took over, the old master still replicates to the
+    // other pods being removed, and the move is done
+    if cluster.Spec.Mode != ModeSentinel && hasMaster(kept) {
+        return desired, nil
+    }
+
+    // Hand the master role over to a remaining pod, keeping the pods until
+    // the master moved
+    replicas := int32(podOrdinal(master)) + 1
+    for _, pod := range leaving {
+        if int32(podOrdinal(pod))+1 > replicas {
+            replicas = int32(podOrdinal(pod)) + 1
+        }
+    }
+    h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonScalingDown, "Moving the master off pod %s before removing it", master.Name)
+    switch cluster.Spec.Mode {
+    case ModeSentinel:
+        // Keep the sentinels from electing another pod being removed
+        for _, pod := range leaving {
+            if pod == master {
+                continue
+            }
+            client := newRedisClient(pod)
+            err = configSet(client, "slave-priority", "0")
+            client.Close()
+            if err != nil {
+                return 0, fmt.Errorf("excluding pod %s from the election: %v", pod.Name, err)
+            }
+        }
+        err = sentinelFailover(ctx, namespace, cluster)
+        if err != nil && strings.Contains(err.Error(), "INPROG") {
+            err = nil
+        }
+    default:
+        cluster.Status.MasterNode = master.Name
+        err = promoteReplica(cluster, kept)
+    }
+    if err != nil {
+        return 0, err
+    }
+    return replicas, nil
+}
+
+// hasMaster reports whether one of the ready pods is a master.
+func hasMaster(pods []corev1.Pod) bool {
+    for i := range pods {
+        pod := &pods[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        info, err := getInfo(pod, "replication")
+        if err == nil && info["role"] == "master" {
+            return true
+        }
+    }
+    return false
+}
+
+// scaleDownHeld reports whether the StatefulSet of a cluster in standalone
+// or sentinel mode, running the given replicas, is kept above the size of
+// the spec because the master still runs on one of the pods being removed.
+func scaleDownHeld(ctx sdk.Context, namespace string, cluster *RedisCluster, replicas int32) (bool, error) {
+    desired := podCount(cluster.Spec)
+    if replicas <= desired {
+        return false, nil
+    }
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return false, err
+    }
+    kept := []corev1.Pod{}
+    leaving := []*corev1.Pod{}
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if podOrdinal(pod) < int(desired) {
+            kept = append(kept, *pod)
+        } else if isPodReady(pod) {
+            leaving = append(leaving, pod)
+        }
+    }
+    if cluster.Spec.Mode != ModeSentinel && hasMaster(kept) {
+        return false, nil
+    }
+    for _, pod := range leaving {
+        replicated, err := isReplicatedMaster(pod)
+        if err != nil {
+            return false, fmt.Errorf("reading the role of pod %s: %v", pod.Name, err)
+        }
+        if replicated {
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+// detachClusterMembers takes the members being removed out of a sharded
+// cluster once they serve no slots: each one resets its cluster state and
+// the remaining members forget it, so they do not wait for it to time out.
+func detachClusterMembers(members []*clusterMember, desired int) error {
+    for _, leaving := range members {
+        if leaving.Ordinal < desired {
+            continue
+        }
+        err := leaving.Client.ClusterResetHard().Err()
+        if err != nil {
+            return fmt.Errorf("resetting the cluster state of pod %s: %v", leaving.Pod.Name, err)
+        }
+        for _, member := range members {
+            if member.Ordinal >= desired {
+                continue
+            }
+            err = member.Client.ClusterForget(leaving.Node.ID).Err()
+            if err != nil && !strings.Contains(err.Error(), "Unknown node") {
+                return fmt.Errorf("forgetting pod %s on pod %s: %v", leaving.Pod.Name, member.Pod.Name, err)
+            }
+        }
+    }
+    return nil
+}
+
+// resetSentinels makes a sentinel that still lists replicas of removed pods
+// forget them with SENTINEL RESET. It then rediscovers the live replicas
+// from the master, so only one sentinel is reset per reconcile.
+func resetSentinels(cluster *RedisCluster, sentinels []*corev1.Pod, replicas int) error {
+    name := cluster.ObjectMeta.Name
+    for _, sentinel := range sentinels {
+        client := newSentinelClient(sentinel)
+        known := redis.NewSliceCmd("sentinel", "slaves", name)
+        err := client.Process(known)
+        if err == nil && len(known.Val()) > replicas {
+            err = client.Process(redis.NewIntCmd("sentinel", "reset", name))
+            client.Close()
+            if err != nil {
+                return fmt.Errorf("resetting sentinel %s: %v", sentinel.Name, err)
+            }
+            return nil
+        }
+        client.Close()
+        if err != nil {
+            return fmt.Errorf("listing the replicas known to sentinel %s: %v", sentinel.Name, err)
+        }
+    }
+    return nil
+}
+
+// deleteScaledDownVolumeClaims deletes the volume claims of the pods the
+// StatefulSet no longer runs when the storage scale-down policy is Delete.
+// A claim is only deleted once its pod is gone.
+func deleteScaledDownVolumeClaims(ctx sdk.Context, namespace string, cluster *RedisCluster, replicas int32) error {
+    storage := cluster.Spec.Storage
+    if storage == nil || storage.ScaleDownPolicy != RetentionPolicyDelete {
+        return nil
+    }
+
+    name := cluster.ObjectMeta.Name
+    prefix := dataVolumeName + "-" + name + "-"
+    selector := labels.SelectorFromSet(map[string]string{"app": name, "controller": name})
+    claims, err := ctx.GetClientset().CoreV1().PersistentVolumeClaims(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+    if err != nil {
+        return err
+    }
+    for _, claim := range claims.Items {
+        ordinal, err := strconv.Atoi(strings.TrimPrefix(claim.Name, prefix))
+        if err != nil || !strings.HasPrefix(claim.Name, prefix) || int32(ordinal) < replicas {
+            continue
+        }
+        _, err = ctx.GetClientset().CoreV1().Pods(namespace).Get(name+"-"+strconv.Itoa(ordinal), metav1.GetOptions{})
+        if !apierrors.IsNotFound(err) {
+            continue
+        }
+        err = ctx.GetClientset().CoreV1().PersistentVolumeClaims(namespace).Delete(claim.Name, &metav1.DeleteOptions{})
+        if err != nil && !apierrors.IsNotFound(err) {
+            return fmt.Errorf("deleting volume claim %s: %v", claim.Name, err)
+        }
+    }
+    return nil
+}
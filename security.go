@@ -0,0 +1,86 @@
+package main
+
+import (
+    "fmt"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// redisUID is the uid and gid of the redis user of the official Redis images.
+const redisUID = 999
+
+// podSecurityContext returns the security context of the pods of the
+// cluster. By default the pods run as the redis user, which owns the data
+// volume through the fsGroup, with the runtime seccomp profile.
+func podSecurityContext(spec RedisClusterSpec) *corev1.PodSecurityContext {
+    if spec.PodSecurityContext != nil {
+        return spec.PodSecurityContext
+    }
+    uid := int64(redisUID)
+    nonRoot := true
+    return &corev1.PodSecurityContext{
+        RunAsUser:    &uid,
+        RunAsGroup:   &uid,
+        FSGroup:      &uid,
+        RunAsNonRoot: &nonRoot,
+        SeccompProfile: &corev1.SeccompProfile{
+            Type: corev1.SeccompProfileTypeRuntimeDefault,
+        },
+    }
+}
+
+// containerSecurityContext returns the security context of the containers
+// of the cluster. By default the containers drop all capabilities and
+// cannot escalate their privileges, as the restricted Pod Security
+// Standard requires.
+func containerSecurityContext(spec RedisClusterSpec) *corev1.SecurityContext {
+    if spec.SecurityContext != nil {
+        return spec.SecurityContext
+    }
+    escalation := false
+    return &corev1.SecurityContext{
+        AllowPrivilegeEscalation: &escalation,
+        Capabilities: &corev1.Capabilities{
+            Drop: []corev1.Capability{"ALL"},
+        },
+    }
+}
+
+// redisIDs returns the uid and gid the Redis containers run as and the
+// fsGroup owning the data volume, taking the container security context over
+// the pod one. Any of them may be unset.
+func redisIDs(spec RedisClusterSpec) (uid, gid, fsGroup *int64) {
+    pod := podSecurityContext(spec)
+    uid, gid, fsGroup = pod.RunAsUser, pod.RunAsGroup, pod.FSGroup
+    container := containerSecurityContext(spec)
+    if container.RunAsUser != nil {
+        uid = container.RunAsUser
+    }
+    if container.RunAsGroup != nil {
+        gid = container.RunAsGroup
+    }
+    return uid, gid, fsGroup
+}
+
+// validateSecurityContext checks that the pod and container security
+// contexts agree on the uid Redis runs as, and that a non-root Redis can
+// write the data volume, which the fsGroup owns. Mismatches only show once
+// Redis fails to persist its data.
+func validateSecurityContext(spec RedisClusterSpec) error {
+    pod := podSecurityContext(spec)
+    container := containerSecurityContext(spec)
+    if pod.RunAsUser != nil && container.RunAsUser != nil && *pod.RunAsUser != *container.RunAsUser {
+        return fmt.Errorf("securityContext.runAsUser %d disagrees with podSecurityContext.runAsUser %d", *container.RunAsUser, *pod.RunAsUser)
+    }
+
+    uid, gid, fsGroup := redisIDs(spec)
+    if spec.Storage == nil || uid == nil || *uid == 0 {
+        return nil
+    }
+    if fsGroup == nil {
+        return fmt.Errorf("podSecurityContext.fsGroup must be set for uid %d to write the data volume", *uid)
+    }
+    if gid != nil && *gid != *fsGroup {
+        return fmt.Errorf("the containers run as gid %d but the data volume is owned by fsGroup %d", *gid, *fsGroup)
+    }
+    return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDefaultSecurityContextIDsAgree(t *testing.T) {
+    cluster := newTestCluster(3)
+    cluster.Spec.Storage = &RedisStorageSpec{Size: resource.MustParse("1Gi")}
+    template := newPodTemplate(cluster, map[string]string{"controller": cluster.ObjectMeta.Name})
+
+    pod := template.Spec.SecurityContext
+    if pod.RunAsUser == nil || pod.RunAsGroup == nil || pod.FSGroup == nil {
+        t.Fatalf("got pod security context %+v, want runAsUser, runAsGroup and fsGroup set", pod)
+    }
+    if *pod.RunAsUser != redisUID || *pod.RunAsGroup != redisUID || *pod.FSGroup != redisUID {
+        t.Errorf("got uid %d, gid %d and fsGroup %d, want %d for all", *pod.RunAsUser, *pod.RunAsGroup, *pod.FSGroup, redisUID)
+    }
+    for _, container := range append(template.Spec.InitContainers, template.Spec.Containers...) {
+        if container.SecurityContext.RunAsUser != nil && *container.SecurityContext.RunAsUser != *pod.RunAsUser {
+            t.Errorf("container %s runs as uid %d, want %d", container.Name, *container.SecurityContext.RunAsUser, *pod.RunAsUser)
+        }
+    }
+    err := validateSecurityContext(cluster.Spec)
+    if err != nil {
+        t.Errorf("the default security contexts are rejected: %v", err)
+    }
+}
+
+func TestValidateSecurityContext(t *testing.T) {
+    id := func(value int64) *int64 { return &value }
+    tests := []struct {
+        name      string
+        pod       *corev1.PodSecurityContext
+        container *corev1.SecurityContext
+        storage   bool
+        valid     bool
+    }{
+        {"defaults", nil, nil, true, true},
+        {"custom uid with matching fsGroup", &corev1.PodSecurityContext{RunAsUser: id(1001), RunAsGroup: id(1001), FSGroup: id(1001)}, nil, true, true},
+        {"container uid overrides the default one", nil, &corev1.SecurityContext{RunAsUser: id(1001)}, true, false},
+        {"container uid matches the pod one", &corev1.PodSecurityContext{RunAsUser: id(1001), FSGroup: id(1001)}, &corev1.SecurityContext{RunAsUser: id(1001)}, true, true},
+        {"container gid differs from the fsGroup", nil, &corev1.SecurityContext{RunAsGroup: id(1001)}, true, false},
+        {"no fsGroup with storage", &corev1.PodSecurityContext{RunAsUser: id(1001)}, nil, true, false},
+        {"no fsGroup without storage", &corev1.PodSecurityContext{RunAsUser: id(1001)}, nil, false, true},
+        {"no fsGroup as root", &corev1.PodSecurityContext{RunAsUser: id(0)}, nil, true, true},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            spec := RedisClusterSpec{PodSecurityContext: test.pod, SecurityContext: test.container}
+            if test.storage {
+                spec.Storage = &RedisStorageSpec{Size: resource.MustParse("1Gi")}
+            }
+            err := validateSecurityContext(spec)
+            if test.valid && err != nil {
+                t.Errorf("got %v, want no error", err)
+            }
+            if !test.valid && err == nil {
+                t.Error("got no error, want the security contexts rejected")
+            }
+        })
+    }
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "strconv"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+    // ModeStandalone runs the nodes as independent Redis servers.
+    ModeStandalone = "standalone"
+
+    // ModeSentinel runs the nodes as a master and replicas supervised by
+    // Redis Sentinel.
+    ModeSentinel = "sentinel"
+)
+
+const (
+    // sentinelPort is the port the sentinels listen on.
+    sentinelPort = 26379
+
+    // sentinelPortName is the name of the sentinel container and Service port.
+    sentinelPortName = "sentinel"
+
+    // sentinelConfigDir holds the sentinel config file, which the sentinels
+    // rewrite as they learn the topology.
+    sentinelConfigDir = "/sentinel"
+
+    // defaultSentinelReplicas is the number of sentinels when the spec does not set it.
+    defaultSentinelReplicas = 3
+
+    // defaultDownAfterMilliseconds is how long a master must be unreachable
+    // before the sentinels consider it down.
+    defaultDownAfterMilliseconds = 5000
+)
+
+// sentinelName returns the name of the sentinel StatefulSet and Service of the cluster.
+func sentinelName(cluster *RedisCluster) string {
+    return cluster.ObjectMeta.Name + "-sentinel"
+}
+
+// sentinelReplicas returns the number of sentinels of the spec.
+func sentinelReplicas(spec RedisClusterSpec) int32 {
+    if spec.Sentinel == nil || spec.Sentinel.Replicas == 0 {
+        return defaultSentinelReplicas
+    }
+    return spec.Sentinel.Replicas
+}
+
+// sentinelQuorum returns the number of sentinels that must agree a master is
+// down, a majority of the sentinels by default.
+func sentinelQuorum(spec RedisClusterSpec) int32 {
+    if spec.Sentinel == nil || spec.Sentinel.Quorum == 0 {
+        return sentinelReplicas(spec)/2 + 1
+    }
+    return spec.Sentinel.Quorum
+}
+
+// downAfterMilliseconds returns how long a master must be unreachable before
+// the sentinels consider it down.
+func downAfterMilliseconds(spec RedisClusterSpec) int32 {
+    if spec.Sentinel == nil || spec.Sentinel.DownAfterMilliseconds == 0 {
+        return defaultDownAfterMilliseconds
+    }
+    return spec.Sentinel.DownAfterMilliseconds
+}
+
+// validateMode checks the mode of the spec and its settings.
+func validateMode(spec RedisClusterSpec) error {
+    switch spec.Mode {
+    case "", ModeStandalone:
+        return nil
+    case ModeSentinel:
+    case ModeCluster:
+        return validateClusterMode(spec)
+    default:
+        return fmt.Errorf("mode %s is invalid, it must be %s, %s or %s", spec.Mode, ModeStandalone, ModeSentinel, ModeCluster)
+    }
+
+    if spec.Size < 2 {
+        return fmt.Errorf("sentinel mode needs a size of at least 2, a master and a replica")
+    }
+    if spec.TLS != nil {
+        return fmt.Errorf("sentinel mode does not support TLS yet")
+    }
+    replicas := sentinelReplicas(spec)
+    if replicas < 1 {
+        return fmt.Errorf("sentinel replicas must be at least 1")
+    }
+    if replicas%2 == 0 {
+        return fmt.Errorf("sentinel replicas must be odd, %d sentinels can split evenly and elect no leader", replicas)
+    }
+    if quorum := sentinelQuorum(spec); quorum < 1 || quorum > replicas {
+        return fmt.Errorf("sentinel quorum %d is out of range, it must be between 1 and the %d sentinels", quorum, replicas)
+    }
+    if downAfterMilliseconds(spec) < 1 {
+        return fmt.Errorf("sentinel downAfterMilliseconds must be positive")
+    }
+    return nil
+}
+
+// newSentinelStatefulSet builds the StatefulSet of the sentinels of the
+// cluster. The sentinels start without a master to monitor; the operator
+// points them at the master once the replication is set up.
+func newSentinelStatefulSet(cluster *RedisCluster, namespace string) *appsv1.StatefulSet {
+    name := sentinelName(cluster)
+    labels := map[string]string{"app": name, "controller": cluster.ObjectMeta.Name}
+    replicas := sentinelReplicas(cluster.Spec)
+    configFile := sentinelConfigDir + "/sentinel.conf"
+    script := fmt.Sprintf("[ -f %s ] || echo 'port %d' > %s; exec redis-sentinel %s", configFile, sentinelPort, configFile, configFile)
+    probe := &corev1.Probe{
+        ProbeHandler: corev1.ProbeHandler{
+            Exec: &corev1.ExecAction{
+                Command: []string{"sh", "-c", fmt.Sprintf("redis-cli -h 127.0.0.1 -p %d ping | grep -q PONG", sentinelPort)},
+            },
+        },
+        InitialDelaySeconds: defaultReadinessProbe.InitialDelaySeconds,
+        PeriodSeconds:       defaultReadinessProbe.PeriodSeconds,
+        TimeoutSeconds:      defaultReadinessProbe.TimeoutSeconds,
+        FailureThreshold:    defaultReadinessProbe.FailureThreshold,
+    }
+
+    statefulSet := &appsv1.StatefulSet{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: appsv1.StatefulSetSpec{
+            Replicas:    &replicas,
+            ServiceName: name,
+            Selector: &metav1.LabelSelector{
+                MatchLabels: labels,
+            },
+            Template: corev1.PodTemplateSpec{
+                ObjectMeta: metav1.ObjectMeta{
+                    Labels: labels,
+                },
+                Spec: corev1.PodSpec{
+                    ServiceAccountName: serviceAccountName(cluster),
+                    ImagePullSecrets:   cluster.Spec.ImagePullSecrets,
+                    SecurityContext:    podSecurityContext(cluster.Spec),
+                    Containers: []corev1.Container{{
+                        Name:            "sentinel",
+                        Image:           redisImage(cluster.Spec),
+                        ImagePullPolicy: cluster.Spec.ImagePullPolicy,
+                        Command:         []string{"sh", "-c", script},
+                        SecurityContext: containerSecurityContext(cluster.Spec),
+                        ReadinessProbe:  probe,
+                        Ports: []corev1.ContainerPort{{
+                            Name:          sentinelPortName,
+                            ContainerPort: sentinelPort,
+                        }},
+                        VolumeMounts: []corev1.VolumeMount{{
+                            Name:      "config",
+                            MountPath: sentinelConfigDir,
+                        }},
+                    }},
+                    Volumes: []corev1.Volume{{
+                        Name: "config",
+                        VolumeSource: corev1.VolumeSource{
+                            EmptyDir: &corev1.EmptyDirVolumeSource{},
+                        },
+                    }},
+                },
+            },
+        },
+    }
+
+    // Schedule the sentinels on the nodes of the cluster
+    setScheduling(&statefulSet.Spec.Template.Spec, cluster.Spec)
+    return statefulSet
+}
+
+// newSentinelService builds the Service clients use to ask the sentinels for
+// the master.
+func newSentinelService(cluster *RedisCluster, namespace string) *corev1.Service {
+    name := sentinelName(cluster)
+    labels := map[string]string{"app": name, "controller": cluster.ObjectMeta.Name}
+    return &corev1.Service{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: corev1.ServiceSpec{
+            Selector: labels,
+            Ports: []corev1.ServicePort{{
+                Name:       sentinelPortName,
+                Port:       sentinelPort,
+                TargetPort: intstr.FromInt(sentinelPort),
+            }},
+        },
+    }
+}
+
+// reconcileSentinel deploys the sentinels of a cluster in sentinel mode, sets
+// up the replication and points the sentinels at the master. The sentinels
+// are removed when the cluster leaves sentinel mode.
+func (h *RedisClusterHandler) reconcileSentinel(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    if cluster.Spec.Mode != ModeSentinel {
+        err := deleteIfExists(&appsv1.StatefulSet{}, namespace, sentinelName(cluster))
+        if err != nil {
+            return err
+        }
+        return deleteIfExists(&corev1.Service{}, namespace, sentinelName(cluster))
+    }
+
+    // Make sure the sentinel Service exists
+    service := newSentinelService(cluster, namespace)
+    _, err := createOrUpdate(service, &corev1.Service{}, func() bool { return false })
+    if err != nil {
+        return err
+    }
+
+    // Create/update the sentinel StatefulSet
+    statefulSet := newSentinelStatefulSet(cluster, namespace)
+    existing := &appsv1.StatefulSet{}
+    created, err := createOrUpdate(statefulSet, existing, func() bool {
+        changed := false
+        if *existing.Spec.Replicas != *statefulSet.Spec.Replicas {
+            existing.Spec.Replicas = statefulSet.Spec.Replicas
+            changed = true
+        }
+        container := &existing.Spec.Template.Spec.Containers[0]
+        if container.Image != redisImage(cluster.Spec) || container.ImagePullPolicy != cluster.Spec.ImagePullPolicy {
+            container.Image = redisImage(cluster.Spec)
+            container.ImagePullPolicy = cluster.Spec.ImagePullPolicy
+            changed = true
+        }
+        if updateScheduling(&existing.Spec.Template, statefulSet.Spec.Template) {
+            changed = true
+        }
+        if existing.Spec.Template.Spec.ServiceAccountName != statefulSet.Spec.Template.Spec.ServiceAccountName {
+            existing.Spec.Template.Spec.ServiceAccountName = statefulSet.Spec.Template.Spec.ServiceAccountName
+            changed = true
+        }
+        return changed
+    })
+    if err != nil {
+        return err
+    }
+    if created {
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonCreated, "Created StatefulSet %s", statefulSet.Name)
+    }
+
+    // Set up the replication and the monitoring
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    sentinels, err := listSentinelPods(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+    master, err := findMaster(cluster, pods.Items, sentinels)
+    if err != nil || master == nil {
+        return err
+    }
+    err = attachReplicas(master, pods.Items)
+    if err != nil {
+        return err
+    }
+    err = configureSentinels(cluster, master, sentinels)
+    if err != nil {
+        return err
+    }
+
+    // Have the sentinels forget the replicas of removed pods
+    return resetSentinels(cluster, sentinels, len(pods.Items)-1)
+}
+
+// listSentinelPods returns the ready sentinel pods of the cluster.
+func listSentinelPods(ctx sdk.Context, namespace string, cluster *RedisCluster) ([]*corev1.Pod, error) {
+    selector := labels.SelectorFromSet(map[string]string{"app": sentinelName(cluster), "controller": cluster.ObjectMeta.Name})
+    pods, err := ctx.GetClientset().CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+    if err != nil {
+        return nil, err
+    }
+    ready := []*corev1.Pod{}
+    for i := range pods.Items {
+        if isPodReady(&pods.Items[i]) {
+            ready = append(ready, &pods.Items[i])
+        }
+    }
+    return ready, nil
+}
+
+// newSentinelClient returns a client connected to the sentinel of the pod.
+func newSentinelClient(pod *corev1.Pod) *redis.SentinelClient {
+    return redis.NewSentinelClient(&redis.Options{
+        Addr: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(sentinelPort)),
+    })
+}
+
+// findMaster returns the ready pod acting as master. The master the most
+// sentinels agree on wins; without one, the master that already has replicas,
+// and otherwise the first pod of the StatefulSet. It returns nil if the
+// master is not ready yet.
+func findMaster(cluster *RedisCluster, pods []corev1.Pod, sentinels []*corev1.Pod) (*corev1.Pod, error) {
+    byAddress := map[string]*corev1.Pod{}
+    for i := range pods {
+        if isPodReady(&pods[i]) {
+            byAddress[net.JoinHostPort(pods[i].Status.PodIP, strconv.Itoa(int(podRedisPort(&pods[i]))))] = &pods[i]
+        }
+    }
+
+    // Ask the sentinels
+    votes := map[*corev1.Pod]int{}
+    var elected *corev1.Pod
+    for _, sentinel := range sentinels {
+        client := newSentinelClient(sentinel)
+        address, err := client.GetMasterAddrByName(cluster.ObjectMeta.Name).Result()
+        client.Close()
+        if err != nil || len(address) != 2 {
+            continue
+        }
+        if pod := byAddress[net.JoinHostPort(address[0], address[1])]; pod != nil {
+            votes[pod]++
+            if elected == nil || votes[pod] > votes[elected] {
+                elected = pod
+            }
+        }
+    }
+    if elected != nil {
+        return elected, nil
+    }
+
+    // Fall back to the replication state of the nodes
+    for _, pod := range byAddress {
+        info, err := getInfo(pod, "replication")
+        if err != nil {
+            return nil, fmt.Errorf("reading replication info of pod %s: %v", pod.Name, err)
+        }
+        connectedSlaves, _ := strconv.Atoi(info["connected_slaves"])
+        if info["role"] == "master" && connectedSlaves > 0 {
+            return pod, nil
+        }
+    }
+    for _, pod := range byAddress {
+        if pod.Name == cluster.ObjectMeta.Name+"-0" {
+            return pod, nil
+        }
+    }
+    return nil, nil
+}
+
+// attachReplicas makes the ready standalone nodes replicas of the master.
+// Replicas following another master are left to the sentinels, which may be
+// in the middle of a failover.
+func attachReplicas(master *corev1.Pod, pods []corev1.Pod) error {
+    host, port := master.Status.PodIP, strconv.Itoa(int(podRedisPort(master)))
+    for i := range pods {
+        pod := &pods[i]
+        if pod.Name == master.Name || !isPodReady(pod) {
+            continue
+        }
+        info, err := getInfo(pod, "replication")
+        if err != nil {
+            return fmt.Errorf("reading replication info of pod %s: %v", pod.Name, err)
+        }
+        if info["role"] != "master" || info["connected_slaves"] != "0" {
+            continue
+        }
+
+        client := newRedisClient(pod)
+        err = client.SlaveOf(host, port).Err()
+        client.Close()
+        if err != nil {
+            return fmt.Errorf("replicating %s from %s: %v", pod.Name, net.JoinHostPort(host, port), err)
+        }
+    }
+    return nil
+}
+
+// configureSentinels points the sentinels that do not monitor a live master
+// at the master, and applies the quorum, the down-after delay and the
+// password to all of them.
+func configureSentinels(cluster *RedisCluster, master *corev1.Pod, sentinels []*corev1.Pod) error {
+    name := cluster.ObjectMeta.Name
+    host, port := master.Status.PodIP, strconv.Itoa(int(podRedisPort(master)))
+    quorum := strconv.Itoa(int(sentinelQuorum(cluster.Spec)))
+    for _, sentinel := range sentinels {
+        err := configureSentinel(newSentinelClient(sentinel), name, host, port, quorum, cluster.Spec, podPassword(master))
+        if err != nil {
+            return fmt.Errorf("configuring sentinel %s: %v", sentinel.Name, err)
+        }
+    }
+    return nil
+}
+
+// configureSentinel configures a single sentinel and closes its client.
+func configureSentinel(client *redis.SentinelClient, name, host, port, quorum string, spec RedisClusterSpec, password string) error {
+    defer client.Close()
+
+    // Monitor the master unless the sentinel already follows a live master
+    address, err := client.GetMasterAddrByName(name).Result()
+    if err != nil && err != redis.Nil {
+        return err
+    }
+    if len(address) != 2 {
+        err = client.Process(redis.NewStatusCmd("sentinel", "monitor", name, host, port, quorum))
+        if err != nil {
+            return err
+        }
+    }
+
+    // Apply the settings
+    settings := []interface{}{"sentinel", "set", name, "quorum", quorum, "down-after-milliseconds", strconv.Itoa(int(downAfterMilliseconds(spec)))}
+    if password != "" {
+        settings = append(settings, "auth-pass", password)
+    }
+    return client.Process(redis.NewStatusCmd(settings...))
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+    "reflect"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// redisPort is the port Redis listens on by default.
+const redisPort = 6379
+
+// redisPortName is the name of the Redis container and Service port.
+const redisPortName = "redis"
+
+// clientPort returns the port Redis listens on for the spec.
+func clientPort(spec RedisClusterSpec) int32 {
+    if spec.Port == 0 {
+        return redisPort
+    }
+    return spec.Port
+}
+
+// serviceType returns the type of the client Service of the spec.
+func serviceType(spec RedisClusterSpec) corev1.ServiceType {
+    if spec.Service == nil || spec.Service.Type == "" {
+        return corev1.ServiceTypeClusterIP
+    }
+    return spec.Service.Type
+}
+
+// newService builds the client Service for the Redis cluster. The Service of a
+// cordoned cluster selects no pods.
+func newService(cluster *RedisCluster, namespace string, cordoned bool) *corev1.Service {
+    name := cluster.ObjectMeta.Name
+    labels := map[string]string{"app": name, "controller": name}
+    selector := map[string]string{"app": name, "controller": name}
+    if cordoned {
+        selector[cordonedSelectorLabel] = "true"
+    }
+    service := &corev1.Service{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            name,
+            Namespace:       namespace,
+            Labels:          labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: corev1.ServiceSpec{
+            Type:     serviceType(cluster.Spec),
+            Selector: selector,
+            Ports: []corev1.ServicePort{{
+                Name:       redisPortName,
+                Port:       clientPort(cluster.Spec),
+                TargetPort: intstr.FromInt(int(clientPort(cluster.Spec))),
+            }},
+        },
+    }
+    if cluster.Spec.Service != nil {
+        service.ObjectMeta.Annotations = cluster.Spec.Service.Annotations
+    }
+    return service
+}
+
+// roleServiceName returns the name of the Service of the nodes with a role.
+func roleServiceName(cluster *RedisCluster, role string) string {
+    return cluster.ObjectMeta.Name + "-" + role
+}
+
+// newRoleService builds the Service of the nodes with a role: the master for
+// read-write clients, or the replicas for read-only ones. It selects no pods
+// while the cluster is cordoned.
+func newRoleService(cluster *RedisCluster, namespace, role string, cordoned bool) *corev1.Service {
+    name := cluster.ObjectMeta.Name
+    labels := map[string]string{"app": name, "controller": name}
+    selector := map[string]string{"app": name, "controller": name, roleLabel: role}
+    if cordoned {
+        selector[cordonedSelectorLabel] = "true"
+    }
+    return &corev1.Service{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            roleServiceName(cluster, role),
+            Namespace:       namespace,
+            Labels:          labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: corev1.ServiceSpec{
+            Selector: selector,
+            Ports: []corev1.ServicePort{{
+                Name:       redisPortName,
+                Port:       clientPort(cluster.Spec),
+                TargetPort: intstr.FromInt(int(clientPort(cluster.Spec))),
+            }},
+        },
+    }
+}
+
+// reconcileRoleServices makes sure the master and replica Services of the
+// cluster exist and keeps their port and selector in line with the spec and
+// the cordon.
+func reconcileRoleServices(cluster *RedisCluster, namespace string, cordoned bool) error {
+    for _, role := range []string{RoleMaster, RoleReplica} {
+        service := newRoleService(cluster, namespace, role, cordoned)
+        existing := &corev1.Service{}
+        created, err := createOrUpdate(service, existing, func() bool {
+            changed := false
+            if len(existing.Spec.Ports) != 1 || existing.Spec.Ports[0].Port != service.Spec.Ports[0].Port {
+                existing.Spec.Ports = service.Spec.Ports
+                changed = true
+            }
+            if !reflect.DeepEqual(existing.Spec.Selector, service.Spec.Selector) {
+                existing.Spec.Selector = service.Spec.Selector
+                changed = true
+            }
+            return changed
+        })
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// headlessServiceName returns the name of the headless Service of the cluster.
+func headlessServiceName(cluster *RedisCluster) string {
+    return cluster.ObjectMeta.Name + "-headless"
+}
+
+// newHeadlessService builds the headless Service giving each pod of the
+// StatefulSet a stable DNS name. It lists the pods before they are ready so
+// that nodes can find each other while they start.
+func newHeadlessService(cluster *RedisCluster, namespace string) *corev1.Service {
+    name := cluster.ObjectMeta.Name
+    labels := map[string]string{"app": name, "controller": name}
+    service := &corev1.Service{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            headlessServiceName(cluster),
+            Namespace:       namespace,
+            Labels:          labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: corev1.ServiceSpec{
+            ClusterIP:                corev1.ClusterIPNone,
+            Selector:                 labels,
+            PublishNotReadyAddresses: true,
+            Ports: []corev1.ServicePort{{
+                Name:       redisPortName,
+                Port:       clientPort(cluster.Spec),
+                TargetPort: intstr.FromInt(int(clientPort(cluster.Spec))),
+            }},
+        },
+    }
+    if monitoringEnabled(cluster.Spec) {
+        service.Spec.Ports = append(service.Spec.Ports, exporterServicePort())
+    }
+    return service
+}
+
+// reconcileHeadlessService makes sure the headless Service of the cluster
+// exists and exposes the Redis port, and the metrics port when monitoring
+// is enabled.
+func reconcileHeadlessService(cluster *RedisCluster, namespace string) error {
+    service := newHeadlessService(cluster, namespace)
+    existing := &corev1.Service{}
+    _, err := createOrUpdate(service, existing, func() bool {
+        if sameServicePorts(existing.Spec.Ports, service.Spec.Ports) {
+            return false
+        }
+        existing.Spec.Ports = service.Spec.Ports
+        return true
+    })
+    return err
+}
+
+// sameServicePorts reports whether two Services expose the same named ports.
+func sameServicePorts(existing, desired []corev1.ServicePort) bool {
+    if len(existing) != len(desired) {
+        return false
+    }
+    for i := range existing {
+        if existing[i].Name != desired[i].Name || existing[i].Port != desired[i].Port {
+            return false
+        }
+    }
+    return true
+}
+
+// sameContainerPorts reports whether two containers expose the same named
+// ports, ignoring the protocol the API server defaults.
+func sameContainerPorts(existing, desired []corev1.ContainerPort) bool {
+    if len(existing) != len(desired) {
+        return false
+    }
+    for i := range existing {
+        if existing[i].Name != desired[i].Name || existing[i].ContainerPort != desired[i].ContainerPort {
+            return false
+        }
+    }
+    return true
+}
+
+// reconcileService makes sure the client Service for the Redis cluster exists,
+// recreating it and recording an event if it has been deleted, and keeps its
+// type, annotations and selector in line with the spec and the cordon.
+func (h *RedisClusterHandler) reconcileService(cluster *RedisCluster, namespace string, cordoned bool) error {
+    // Create the Service if it has been deleted, otherwise update it in place
+    // so it keeps its cluster and external IPs
+    service := newService(cluster, namespace, cordoned)
+    existing := &corev1.Service{}
+    _, err := createOrUpdate(service, existing, func() bool {
+        changed := false
+        if len(existing.Spec.Ports) == 0 || existing.Spec.Ports[0].Port != service.Spec.Ports[0].Port {
+            if len(existing.Spec.Ports) > 0 {
+                service.Spec.Ports[0].NodePort = existing.Spec.Ports[0].NodePort
+            }
+            existing.Spec.Ports = service.Spec.Ports
+            changed = true
+        }
+        for key, value := range service.ObjectMeta.Annotations {
+            if existing.ObjectMeta.Annotations[key] != value {
+                if existing.ObjectMeta.Annotations == nil {
+                    existing.ObjectMeta.Annotations = map[string]string{}
+                }
+                existing.ObjectMeta.Annotations[key] = value
+                changed = true
+            }
+        }
+        if existing.Spec.Type != service.Spec.Type {
+            setServiceType(existing, service.Spec.Type)
+            changed = true
+        }
+        if !reflect.DeepEqual(existing.Spec.Selector, service.Spec.Selector) {
+            existing.Spec.Selector = service.Spec.Selector
+            changed = true
+        }
+        return changed
+    })
+    if err != nil {
+        return err
+    }
+
+    // A cluster reconciled before had its Service deleted from under it
+    if created && cluster.Status.ObservedGeneration > 0 {
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonRecreated, "Recreated Service %s, which had been deleted", service.Name)
+    } else if created {
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonCreated, "Created Service %s", service.Name)
+    }
+
+    return updateServiceStatus(namespace, cluster, existing)
+}
+
+// setServiceType changes the type of a Service, clearing the fields the new
+// type does not allow. Moving away from NodePort and LoadBalancer frees the
+// node ports.
+func setServiceType(service *corev1.Service, serviceType corev1.ServiceType) {
+    service.Spec.Type = serviceType
+    if serviceType == corev1.ServiceTypeClusterIP {
+        for i := range service.Spec.Ports {
+            service.Spec.Ports[i].NodePort = 0
+        }
+        service.Spec.ExternalTrafficPolicy = ""
+        service.Spec.HealthCheckNodePort = 0
+    }
+    if serviceType != corev1.ServiceTypeLoadBalancer {
+        service.Spec.LoadBalancerSourceRanges = nil
+        service.Spec.AllocateLoadBalancerNodePorts = nil
+    }
+}
+
+// updateServiceStatus records the external addresses of a LoadBalancer
+// Service in the status of the RedisCluster.
+func updateServiceStatus(namespace string, cluster *RedisCluster, service *corev1.Service) error {
+    endpoints := []string{}
+    for _, ingress := range service.Status.LoadBalancer.Ingress {
+        if ingress.IP != "" {
+            endpoints = append(endpoints, ingress.IP)
+        }
+        if ingress.Hostname != "" {
+            endpoints = append(endpoints, ingress.Hostname)
+        }
+    }
+    if reflect.DeepEqual(endpoints, cluster.Status.ExternalEndpoints) || (len(endpoints) == 0 && len(cluster.Status.ExternalEndpoints) == 0) {
+        return nil
+    }
+
+    // Get the RedisCluster
+    current := &RedisCluster{}
+    err := sdk.Get(current, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+
+    current.Status.ExternalEndpoints = endpoints
+    return updateStatus(current)
+}
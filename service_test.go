@@ -0,0 +1,93 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+func TestServiceSelectsThePods(t *testing.T) {
+    cluster := newTestCluster(3)
+    name := cluster.ObjectMeta.Name
+    template := newPodTemplate(cluster, map[string]string{"app": name, "controller": name})
+
+    for _, service := range []*corev1.Service{newService(cluster, "default", false), newHeadlessService(cluster, "default")} {
+        selector := labels.SelectorFromSet(service.Spec.Selector)
+        if !selector.Matches(labels.Set(template.ObjectMeta.Labels)) {
+            t.Errorf("Service %s selects %v, which the pod labels %v do not match", service.Name, service.Spec.Selector, template.ObjectMeta.Labels)
+        }
+    }
+
+    cordoned := newService(cluster, "default", true)
+    if labels.SelectorFromSet(cordoned.Spec.Selector).Matches(labels.Set(template.ObjectMeta.Labels)) {
+        t.Error("the Service of a cordoned cluster selects its pods")
+    }
+}
+
+func TestServicePort(t *testing.T) {
+    tests := []struct {
+        port int32
+        want int32
+    }{
+        {0, redisPort},
+        {7000, 7000},
+    }
+    for _, test := range tests {
+        cluster := newTestCluster(3)
+        cluster.Spec.Port = test.port
+        service := newService(cluster, "default", false)
+        if len(service.Spec.Ports) != 1 {
+            t.Fatalf("got %d ports, want 1", len(service.Spec.Ports))
+        }
+        port := service.Spec.Ports[0]
+        if port.Port != test.want || port.TargetPort.IntValue() != int(test.want) {
+            t.Errorf("port %d: got port %d targeting %s, want %d", test.port, port.Port, port.TargetPort.String(), test.want)
+        }
+        container := newPodTemplate(cluster, nil).Spec.Containers[0]
+        if container.Ports[0].ContainerPort != test.want {
+            t.Errorf("port %d: got container port %d, want %d", test.port, container.Ports[0].ContainerPort, test.want)
+        }
+    }
+}
+
+func TestReconcileServiceRecreatesDeletedService(t *testing.T) {
+    handler, recorder := newTestHandler()
+    fake := newFakeClient(t)
+    cluster := newTestCluster(3)
+
+    err := handler.reconcileService(cluster, "default", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    events := recordedEvents(recorder)
+    if len(events) != 1 || !strings.HasPrefix(events[0], "Normal "+ReasonCreated+" ") {
+        t.Errorf("got events %v, want the Service creation", events)
+    }
+
+    // Delete the Service of the reconciled cluster
+    cluster.Status.ObservedGeneration = 1
+    err = deleteObject(newService(cluster, "default", false))
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = handler.reconcileService(cluster, "default", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if fake.creates != 2 {
+        t.Errorf("got %d creates, want the Service recreated", fake.creates)
+    }
+    events = recordedEvents(recorder)
+    if len(events) != 1 || !strings.HasPrefix(events[0], "Normal "+ReasonRecreated+" ") {
+        t.Errorf("got events %v, want the Service recreation", events)
+    }
+
+    err = handler.reconcileService(cluster, "default", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if events = recordedEvents(recorder); len(events) != 0 {
+        t.Errorf("got events %v for an existing Service, want none", events)
+    }
+}
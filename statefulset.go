@@ -0,0 +1,154 @@
+package main
+
+import (
+    "reflect"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newStatefulSet builds the StatefulSet of the Redis cluster. The pods get
+// stable names and DNS entries through the headless Service, and a volume
+// claim for the data when the spec requests persistent storage.
+func newStatefulSet(cluster *RedisCluster, namespace string, replicas int32, labels map[string]string, template corev1.PodTemplateSpec) *appsv1.StatefulSet {
+    return &appsv1.StatefulSet{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            cluster.ObjectMeta.Name,
+            Namespace:       namespace,
+            Labels:          labels,
+            OwnerReferences: ownerReferences(cluster),
+        },
+        Spec: appsv1.StatefulSetSpec{
+            Replicas:    &replicas,
+            ServiceName: headlessServiceName(cluster),
+            Selector: &metav1.LabelSelector{
+                MatchLabels: labels,
+            },
+            Template:             template,
+            UpdateStrategy:       updateStrategy(cluster.Spec),
+            VolumeClaimTemplates: dataVolumeClaimTemplates(cluster.Spec, labels),
+        },
+    }
+}
+
+// reconcileStatefulSet creates the StatefulSet, or updates the existing one
+// when its replica count, update strategy or pod template changed. Template
+// changes replace the pods by a rolling update.
+func (h *RedisClusterHandler) reconcileStatefulSet(cluster *RedisCluster, statefulSet *appsv1.StatefulSet) error {
+    // Recreate a StatefulSet whose immutable fields no longer match, keeping
+    // its pods running for the new StatefulSet to adopt
+    existing := &appsv1.StatefulSet{}
+    err := getObject(existing, statefulSet.Namespace, statefulSet.Name)
+    if err == nil && (existing.Spec.ServiceName != statefulSet.Spec.ServiceName || len(existing.Spec.VolumeClaimTemplates) != len(statefulSet.Spec.VolumeClaimTemplates)) {
+        orphan := metav1.DeletePropagationOrphan
+        err = deleteObject(existing, sdk.WithDeleteOptions(&metav1.DeleteOptions{PropagationPolicy: &orphan}))
+        if err != nil {
+            return err
+        }
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonRecreated, "Deleted StatefulSet %s keeping its pods, to recreate it with a new service name or volume claims", existing.Name)
+        return nil
+    }
+
+    var scaledFrom *int32
+    existing = &appsv1.StatefulSet{}
+    created, err := createOrUpdate(statefulSet, existing, func() bool {
+        changed := false
+
+        // Scale the existing StatefulSet
+        if existing.Spec.Replicas == nil || *existing.Spec.Replicas != *statefulSet.Spec.Replicas {
+            scaledFrom = existing.Spec.Replicas
+            existing.Spec.Replicas = statefulSet.Spec.Replicas
+            changed = true
+        }
+
+        // Update the strategy before the template so it applies to the rollout
+        if !reflect.DeepEqual(existing.Spec.UpdateStrategy, statefulSet.Spec.UpdateStrategy) {
+            existing.Spec.UpdateStrategy = statefulSet.Spec.UpdateStrategy
+            changed = true
+        }
+
+        // Update the pod template, which rolls the pods
+        if updatePodTemplate(&existing.Spec.Template, statefulSet.Spec.Template) {
+            changed = true
+        }
+
+        return changed
+    })
+    if err != nil {
+        return err
+    }
+    if created {
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonCreated, "Created StatefulSet %s", statefulSet.Name)
+    }
+    if scaledFrom != nil {
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonScaled, "Scaled StatefulSet %s from %d to %d", statefulSet.Name, *scaledFrom, *statefulSet.Spec.Replicas)
+    }
+    return nil
+}
+
+// handleStatefulSet handles the StatefulSet of a Redis cluster.
+func (h *RedisClusterHandler) handleStatefulSet(ctx sdk.Context, statefulSet *appsv1.StatefulSet) error {
+    // Get the namespace of the StatefulSet
+    namespace, err := objectNamespace(statefulSet)
+    if err != nil {
+        return err
+    }
+
+    // Only the StatefulSet of the Redis nodes is handled here, the sentinels
+    // are reconciled with the RedisCluster
+    name := statefulSet.Spec.Selector.MatchLabels["controller"]
+    if statefulSet.Name != name {
+        return nil
+    }
+
+    // Get the corresponding RedisCluster
+    cluster := &RedisCluster{}
+    err = sdk.Get(cluster, namespace, name)
+    if err != nil {
+        return err
+    }
+    if isPaused(cluster) {
+        return nil
+    }
+
+    // Only track the pods of a hibernated cluster going away
+    if cluster.Spec.Hibernated {
+        return h.updateRedisClusterStatus(ctx, namespace, name)
+    }
+
+    // Correct replica count changes made directly on the StatefulSet
+    err = h.reconcileExternalScale(ctx, namespace, cluster, statefulSet, statefulSet.Spec.Replicas)
+    if err != nil {
+        return err
+    }
+
+    // Delete the volume claims of the pods removed by a scale-down
+    if statefulSet.Spec.Replicas != nil {
+        err = deleteScaledDownVolumeClaims(ctx, namespace, cluster, *statefulSet.Spec.Replicas)
+        if err != nil {
+            return err
+        }
+    }
+
+    // Carry on with the upgrade as the replaced pods come back
+    err = h.reconcileUpgrade(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Update the status of the custom resource
+    err = h.updateRedisClusterStatus(ctx, namespace, name)
+    if err != nil {
+        return err
+    }
+
+    // Perform the automatic failover
+    err = h.performAutomaticFailover(ctx, namespace, name)
+    if err != nil {
+        return err
+    }
+
+    // Set the ACL users again on the restarted and replaced nodes
+    return syncClusterUsers(ctx, namespace, cluster)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+    "fmt"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+    // RetentionPolicyRetain keeps the volume claims of a deleted cluster.
+    RetentionPolicyRetain = "Retain"
+
+    // RetentionPolicyDelete deletes the volume claims with the cluster.
+    RetentionPolicyDelete = "Delete"
+)
+
+// dataVolumeClaimSpec returns the spec of the volume claim holding the data
+// of a pod.
+func dataVolumeClaimSpec(storage *RedisStorageSpec) corev1.PersistentVolumeClaimSpec {
+    accessModes := storage.AccessModes
+    if len(accessModes) == 0 {
+        accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+    }
+    return corev1.PersistentVolumeClaimSpec{
+        AccessModes:      accessModes,
+        StorageClassName: storage.StorageClassName,
+        Resources: corev1.VolumeResourceRequirements{
+            Requests: corev1.ResourceList{
+                corev1.ResourceStorage: storage.Size,
+            },
+        },
+    }
+}
+
+// dataVolume returns the data volume of the pod template, or nil when the
+// data goes to a volume claim of the StatefulSet. Without storage the data
+// is kept on an emptyDir, and ephemeral storage gets a claim living as long
+// as the pod.
+func dataVolume(spec RedisClusterSpec, labels map[string]string) *corev1.Volume {
+    storage := spec.Storage
+    if storage == nil {
+        return &corev1.Volume{
+            Name: dataVolumeName,
+            VolumeSource: corev1.VolumeSource{
+                EmptyDir: &corev1.EmptyDirVolumeSource{},
+            },
+        }
+    }
+    if !storage.Ephemeral {
+        return nil
+    }
+    return &corev1.Volume{
+        Name: dataVolumeName,
+        VolumeSource: corev1.VolumeSource{
+            Ephemeral: &corev1.EphemeralVolumeSource{
+                VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+                    ObjectMeta: metav1.ObjectMeta{
+                        Labels: labels,
+                    },
+                    Spec: dataVolumeClaimSpec(storage),
+                },
+            },
+        },
+    }
+}
+
+// dataVolumeClaimTemplates returns the volume claim templates of the
+// StatefulSet, which keep the data of each pod across restarts.
+func dataVolumeClaimTemplates(spec RedisClusterSpec, labels map[string]string) []corev1.PersistentVolumeClaim {
+    if spec.Storage == nil || spec.Storage.Ephemeral {
+        return nil
+    }
+    return []corev1.PersistentVolumeClaim{{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:   dataVolumeName,
+            Labels: labels,
+        },
+        Spec: dataVolumeClaimSpec(spec.Storage),
+    }}
+}
+
+// sameVolumes reports whether two lists of volumes have the same names and
+// kinds of sources. The sources themselves are defaulted by the API server
+// and would always differ.
+func sameVolumes(existing, desired []corev1.Volume) bool {
+    if len(existing) != len(desired) {
+        return false
+    }
+    for i := range existing {
+        a, b := existing[i], desired[i]
+        if a.Name != b.Name || (a.EmptyDir == nil) != (b.EmptyDir == nil) || (a.Ephemeral == nil) != (b.Ephemeral == nil) || (a.ConfigMap == nil) != (b.ConfigMap == nil) || (a.Secret == nil) != (b.Secret == nil) {
+            return false
+        }
+        if (a.PersistentVolumeClaim == nil) != (b.PersistentVolumeClaim == nil) || (a.Projected == nil) != (b.Projected == nil) || (a.HostPath == nil) != (b.HostPath == nil) || (a.CSI == nil) != (b.CSI == nil) {
+            return false
+        }
+    }
+    return true
+}
+
+// validateStorage checks the storage settings of the spec.
+func validateStorage(spec RedisClusterSpec) error {
+    storage := spec.Storage
+    if storage == nil {
+        return nil
+    }
+    if storage.Size.Sign() <= 0 {
+        return fmt.Errorf("storage size must be positive")
+    }
+    switch storage.RetentionPolicy {
+    case "", RetentionPolicyRetain, RetentionPolicyDelete:
+    default:
+        return fmt.Errorf("storage retentionPolicy %s is invalid, it must be %s or %s", storage.RetentionPolicy, RetentionPolicyRetain, RetentionPolicyDelete)
+    }
+    switch storage.ScaleDownPolicy {
+    case "", RetentionPolicyRetain, RetentionPolicyDelete:
+    default:
+        return fmt.Errorf("storage scaleDownPolicy %s is invalid, it must be %s or %s", storage.ScaleDownPolicy, RetentionPolicyRetain, RetentionPolicyDelete)
+    }
+    for _, mode := range storage.AccessModes {
+        switch mode {
+        case corev1.ReadWriteOnce, corev1.ReadWriteOncePod, corev1.ReadWriteMany:
+        default:
+            return fmt.Errorf("storage access mode %s is invalid, Redis needs to write to its volume", mode)
+        }
+    }
+    return nil
+}
+
+// deleteVolumeClaims deletes the volume claims of a deleted cluster whose
+// storage retention policy is Delete. The claims are created by the
+// StatefulSet and not owned by the cluster, so they outlive it otherwise.
+func deleteVolumeClaims(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    storage := cluster.Spec.Storage
+    if storage == nil || storage.RetentionPolicy != RetentionPolicyDelete {
+        return nil
+    }
+
+    name := cluster.ObjectMeta.Name
+    selector := labels.SelectorFromSet(map[string]string{"app": name, "controller": name})
+    claims, err := ctx.GetClientset().CoreV1().PersistentVolumeClaims(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+    if err != nil {
+        return err
+    }
+    for _, claim := range claims.Items {
+        err = ctx.GetClientset().CoreV1().PersistentVolumeClaims(namespace).Delete(claim.Name, &metav1.DeleteOptions{})
+        if err != nil && !apierrors.IsNotFound(err) {
+            return fmt.Errorf("deleting volume claim %s: %v", claim.Name, err)
+        }
+    }
+    return nil
+}
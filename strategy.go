@@ -0,0 +1,57 @@
+package main
+
+import (
+    "fmt"
+    appsv1 "k8s.io/api/apps/v1"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// defaultStrategyMaxUnavailable keeps all but one member of a cluster up
+// during an update.
+var defaultStrategyMaxUnavailable = intstr.FromInt(1)
+
+// updateStrategy returns the update strategy of the StatefulSet of the spec.
+// The StatefulSet leaves the pods alone when the operator replaces them.
+func updateStrategy(spec RedisClusterSpec) appsv1.StatefulSetUpdateStrategy {
+    if strategyType(spec) != appsv1.RollingUpdateStatefulSetStrategyType {
+        return appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+    }
+
+    maxUnavailable := defaultStrategyMaxUnavailable
+    if spec.Strategy != nil && spec.Strategy.MaxUnavailable != nil {
+        maxUnavailable = *spec.Strategy.MaxUnavailable
+    }
+    return appsv1.StatefulSetUpdateStrategy{
+        Type: appsv1.RollingUpdateStatefulSetStrategyType,
+        RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+            MaxUnavailable: &maxUnavailable,
+        },
+    }
+}
+
+// validateStrategy checks the update strategy of the spec.
+func validateStrategy(spec RedisClusterSpec) error {
+    strategy := spec.Strategy
+    if strategy == nil {
+        return nil
+    }
+    switch strategyType(spec) {
+    case appsv1.RollingUpdateStatefulSetStrategyType:
+    case ManagedStrategyType, appsv1.OnDeleteStatefulSetStrategyType:
+        if strategy.MaxUnavailable != nil {
+            return fmt.Errorf("strategy maxUnavailable only applies to the RollingUpdate strategy")
+        }
+        return nil
+    default:
+        return fmt.Errorf("strategy type %s is invalid, it must be Managed, RollingUpdate or OnDelete", strategy.Type)
+    }
+
+    maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(updateStrategy(spec).RollingUpdate.MaxUnavailable, 100, true)
+    if err != nil {
+        return fmt.Errorf("strategy maxUnavailable: %v", err)
+    }
+    if maxUnavailable < 1 {
+        return fmt.Errorf("strategy maxUnavailable must allow at least one pod to be replaced at a time")
+    }
+    return nil
+}
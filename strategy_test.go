@@ -0,0 +1,68 @@
+package main
+
+import (
+    "testing"
+    appsv1 "k8s.io/api/apps/v1"
+    "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestUpdateStrategy(t *testing.T) {
+    two := intstr.FromInt(2)
+    percent := intstr.FromString("25%")
+    tests := []struct {
+        name           string
+        strategy       *RedisStrategySpec
+        want           appsv1.StatefulSetUpdateStrategyType
+        maxUnavailable *intstr.IntOrString
+    }{
+        {"managed by default", nil, appsv1.OnDeleteStatefulSetStrategyType, nil},
+        {"managed", &RedisStrategySpec{Type: ManagedStrategyType}, appsv1.OnDeleteStatefulSetStrategyType, nil},
+        {"on delete", &RedisStrategySpec{Type: appsv1.OnDeleteStatefulSetStrategyType}, appsv1.OnDeleteStatefulSetStrategyType, nil},
+        {"rolling update", &RedisStrategySpec{Type: appsv1.RollingUpdateStatefulSetStrategyType}, appsv1.RollingUpdateStatefulSetStrategyType, &defaultStrategyMaxUnavailable},
+        {"rolling update of 2 pods", &RedisStrategySpec{MaxUnavailable: &two}, appsv1.RollingUpdateStatefulSetStrategyType, &two},
+        {"rolling update of a quarter", &RedisStrategySpec{Type: appsv1.RollingUpdateStatefulSetStrategyType, MaxUnavailable: &percent}, appsv1.RollingUpdateStatefulSetStrategyType, &percent},
+    }
+    for _, test := range tests {
+        strategy := updateStrategy(RedisClusterSpec{Strategy: test.strategy})
+        if strategy.Type != test.want {
+            t.Errorf("%s: got %s, want %s", test.name, strategy.Type, test.want)
+            continue
+        }
+        if test.maxUnavailable == nil {
+            if strategy.RollingUpdate != nil {
+                t.Errorf("%s: got rolling update settings %+v, want none", test.name, strategy.RollingUpdate)
+            }
+            continue
+        }
+        if strategy.RollingUpdate == nil || strategy.RollingUpdate.MaxUnavailable == nil || *strategy.RollingUpdate.MaxUnavailable != *test.maxUnavailable {
+            t.Errorf("%s: got rolling update settings %+v, want maxUnavailable %s", test.name, strategy.RollingUpdate, test.maxUnavailable.String())
+        }
+    }
+}
+
+func TestValidateStrategy(t *testing.T) {
+    zero := intstr.FromInt(0)
+    none := intstr.FromString("0%")
+    one := intstr.FromInt(1)
+    tests := []struct {
+        name     string
+        strategy *RedisStrategySpec
+        valid    bool
+    }{
+        {"default", nil, true},
+        {"rolling update", &RedisStrategySpec{Type: appsv1.RollingUpdateStatefulSetStrategyType, MaxUnavailable: &one}, true},
+        {"no pod unavailable", &RedisStrategySpec{MaxUnavailable: &zero}, false},
+        {"no percent unavailable", &RedisStrategySpec{MaxUnavailable: &none}, false},
+        {"max unavailable with on delete", &RedisStrategySpec{Type: appsv1.OnDeleteStatefulSetStrategyType, MaxUnavailable: &one}, false},
+        {"unknown type", &RedisStrategySpec{Type: "Recreate"}, false},
+    }
+    for _, test := range tests {
+        err := validateStrategy(RedisClusterSpec{Strategy: test.strategy})
+        if test.valid && err != nil {
+            t.Errorf("%s: got %v, want no error", test.name, err)
+        }
+        if !test.valid && err == nil {
+            t.Errorf("%s: got no error, want the strategy rejected", test.name)
+        }
+    }
+}
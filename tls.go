@@ -0,0 +1,166 @@
+package main
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "path"
+    "strconv"
+    "sync"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+    // tlsVolumeName is the name of the TLS Secret volume.
+    tlsVolumeName = "tls"
+
+    // tlsMountPath is where the TLS Secret is mounted.
+    tlsMountPath = "/tls"
+)
+
+// tlsSecretKeys are the keys the TLS Secret must hold.
+var tlsSecretKeys = []string{corev1.ServiceAccountRootCAKey, corev1.TLSCertKey, corev1.TLSPrivateKeyKey}
+
+var (
+    // tlsConfigsMu guards tlsConfigs.
+    tlsConfigsMu sync.Mutex
+
+    // tlsConfigs are the client TLS configurations of the clusters serving
+    // TLS, built from their Secrets when the clusters are reconciled.
+    tlsConfigs = map[types.NamespacedName]*tls.Config{}
+)
+
+// tlsArgs returns the redis-server arguments serving TLS on the client port
+// in place of plain TCP.
+func tlsArgs(spec RedisClusterSpec) []string {
+    return []string{
+        "--port", "0",
+        "--tls-port", strconv.Itoa(int(clientPort(spec))),
+        "--tls-cert-file", path.Join(tlsMountPath, corev1.TLSCertKey),
+        "--tls-key-file", path.Join(tlsMountPath, corev1.TLSPrivateKeyKey),
+        "--tls-ca-cert-file", path.Join(tlsMountPath, corev1.ServiceAccountRootCAKey),
+        "--tls-replication", "yes",
+        "--tls-auth-clients", "optional",
+    }
+}
+
+// tlsCLIArgs returns the redis-cli arguments connecting to the local server over TLS.
+func tlsCLIArgs() string {
+    return fmt.Sprintf("--tls --cacert %s --cert %s --key %s",
+        path.Join(tlsMountPath, corev1.ServiceAccountRootCAKey),
+        path.Join(tlsMountPath, corev1.TLSCertKey),
+        path.Join(tlsMountPath, corev1.TLSPrivateKeyKey))
+}
+
+// tlsVolume returns the volume and mount of the TLS Secret.
+func tlsVolume(spec RedisClusterSpec) (corev1.Volume, corev1.VolumeMount) {
+    volume := corev1.Volume{
+        Name: tlsVolumeName,
+        VolumeSource: corev1.VolumeSource{
+            Secret: &corev1.SecretVolumeSource{
+                SecretName: spec.TLS.SecretName,
+            },
+        },
+    }
+    mount := corev1.VolumeMount{
+        Name:      tlsVolumeName,
+        MountPath: tlsMountPath,
+        ReadOnly:  true,
+    }
+    return volume, mount
+}
+
+// redisTLSConfig returns the TLS configuration the operator connects to the
+// nodes with, or nil if the spec does not enable TLS. A missing Secret or key
+// is an error, so that a cluster meant to be encrypted never starts without TLS.
+func redisTLSConfig(namespace string, spec RedisClusterSpec) (*tls.Config, error) {
+    if spec.TLS == nil {
+        return nil, nil
+    }
+    if spec.TLS.SecretName == "" {
+        return nil, fmt.Errorf("tls.secretName must name the Secret holding the certificates")
+    }
+
+    secret := &corev1.Secret{}
+    err := getObject(secret, namespace, spec.TLS.SecretName)
+    if apierrors.IsNotFound(err) {
+        return nil, fmt.Errorf("TLS secret %s not found", spec.TLS.SecretName)
+    }
+    if err != nil {
+        return nil, err
+    }
+    for _, key := range tlsSecretKeys {
+        if len(secret.Data[key]) == 0 {
+            return nil, fmt.Errorf("TLS secret %s has no key %s", spec.TLS.SecretName, key)
+        }
+    }
+
+    roots := x509.NewCertPool()
+    if !roots.AppendCertsFromPEM(secret.Data[corev1.ServiceAccountRootCAKey]) {
+        return nil, fmt.Errorf("TLS secret %s: %s holds no PEM certificate", spec.TLS.SecretName, corev1.ServiceAccountRootCAKey)
+    }
+    certificate, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+    if err != nil {
+        return nil, fmt.Errorf("TLS secret %s: %v", spec.TLS.SecretName, err)
+    }
+    return &tls.Config{
+        Certificates: []tls.Certificate{certificate},
+        // The nodes are dialed by pod IP, which their certificates do not
+        // name, so the chain is verified against the CA without the host name.
+        InsecureSkipVerify: true,
+        VerifyConnection: func(state tls.ConnectionState) error {
+            if len(state.PeerCertificates) == 0 {
+                return fmt.Errorf("the server presented no certificate")
+            }
+            intermediates := x509.NewCertPool()
+            for _, certificate := range state.PeerCertificates[1:] {
+                intermediates.AddCert(certificate)
+            }
+            _, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+            return err
+        },
+    }, nil
+}
+
+// setClusterTLSConfig records the client TLS configuration of a cluster. A
+// nil configuration forgets it.
+func setClusterTLSConfig(namespace, name string, config *tls.Config) {
+    tlsConfigsMu.Lock()
+    defer tlsConfigsMu.Unlock()
+
+    key := types.NamespacedName{Namespace: namespace, Name: name}
+    if config == nil {
+        delete(tlsConfigs, key)
+        return
+    }
+    tlsConfigs[key] = config
+}
+
+// podTLSConfig returns the client TLS configuration of the cluster the pod
+// belongs to, or nil if it does not serve TLS. The configuration is built
+// from the Secret if the cluster has not been reconciled yet.
+func podTLSConfig(pod *corev1.Pod) *tls.Config {
+    key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Labels["controller"]}
+    tlsConfigsMu.Lock()
+    config, ok := tlsConfigs[key]
+    tlsConfigsMu.Unlock()
+    if ok {
+        return config
+    }
+
+    // Build the configuration from the cluster
+    cluster := &RedisCluster{}
+    err := sdk.Get(cluster, key.Namespace, key.Name)
+    if err != nil {
+        return nil
+    }
+    config, err = redisTLSConfig(key.Namespace, cluster.Spec)
+    if err != nil {
+        return nil
+    }
+    setClusterTLSConfig(key.Namespace, key.Name, config)
+    return config
+}
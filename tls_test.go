@@ -0,0 +1,61 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+)
+
+func TestTLSOnlyWhenSet(t *testing.T) {
+    cluster := newTestCluster(3)
+    template := newPodTemplate(cluster, nil)
+    container := template.Spec.Containers[0]
+    if findVolume(template.Spec, tlsVolumeName) != nil || findMount(container, tlsVolumeName) != nil {
+        t.Error("got the TLS Secret mounted without TLS in the spec")
+    }
+    if argValue(container.Args, "--tls-port") != "" {
+        t.Errorf("got args %v, want no TLS without TLS in the spec", container.Args)
+    }
+    if strings.Contains(container.ReadinessProbe.Exec.Command[2], "--tls") {
+        t.Error("the readiness probe connects over TLS without TLS in the spec")
+    }
+
+    cluster.Spec.TLS = &RedisTLSSpec{SecretName: "cache-tls"}
+    template = newPodTemplate(cluster, nil)
+    container = template.Spec.Containers[0]
+    volume := findVolume(template.Spec, tlsVolumeName)
+    if volume == nil || volume.Secret == nil || volume.Secret.SecretName != "cache-tls" {
+        t.Fatalf("got volume %v, want the cache-tls Secret", volume)
+    }
+    mount := findMount(container, tlsVolumeName)
+    if mount == nil || mount.MountPath != tlsMountPath || !mount.ReadOnly {
+        t.Errorf("got mount %v, want the Secret read-only at %s", mount, tlsMountPath)
+    }
+    want := map[string]string{
+        "--port":             "0",
+        "--tls-port":         "6379",
+        "--tls-cert-file":    tlsMountPath + "/" + corev1.TLSCertKey,
+        "--tls-key-file":     tlsMountPath + "/" + corev1.TLSPrivateKeyKey,
+        "--tls-ca-cert-file": tlsMountPath + "/" + corev1.ServiceAccountRootCAKey,
+    }
+    for flag, value := range want {
+        if got := argValue(container.Args, flag); got != value {
+            t.Errorf("got %s %q, want %q", flag, got, value)
+        }
+    }
+    if !strings.Contains(container.ReadinessProbe.Exec.Command[2], "--tls") {
+        t.Error("the readiness probe does not connect over TLS")
+    }
+}
+
+func TestRedisTLSConfigMissingSecret(t *testing.T) {
+    newFakeClient(t)
+    config, err := redisTLSConfig("default", RedisClusterSpec{})
+    if config != nil || err != nil {
+        t.Errorf("got %v and %v without TLS in the spec, want neither", config, err)
+    }
+    _, err = redisTLSConfig("default", RedisClusterSpec{TLS: &RedisTLSSpec{SecretName: "cache-tls"}})
+    if err == nil || !strings.Contains(err.Error(), "not found") {
+        t.Errorf("got %v, want the missing Secret reported", err)
+    }
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ManagedStrategyType lets the operator replace the pods on updates: the
+// replicas first, then the masters once a replica took over from them.
+const ManagedStrategyType appsv1.StatefulSetUpdateStrategyType = "Managed"
+
+const (
+    // ReasonUpgrading is the reason of the event recorded when the operator
+    // replaces a pod running an outdated revision.
+    ReasonUpgrading = "Upgrading"
+
+    // ReasonFailover is the reason of the event recorded when the operator
+    // hands the master role over before replacing a master.
+    ReasonFailover = "Failover"
+)
+
+// strategyType returns the update strategy type of the spec. A strategy
+// setting only maxUnavailable keeps the rolling update it configures.
+func strategyType(spec RedisClusterSpec) appsv1.StatefulSetUpdateStrategyType {
+    switch {
+    case spec.Strategy == nil:
+        return ManagedStrategyType
+    case spec.Strategy.Type == "" && spec.Strategy.MaxUnavailable != nil:
+        return appsv1.RollingUpdateStatefulSetStrategyType
+    case spec.Strategy.Type == "":
+        return ManagedStrategyType
+    default:
+        return spec.Strategy.Type
+    }
+}
+
+// imageHasTag reports whether the image reference sets a tag or a digest.
+func imageHasTag(image string) bool {
+    return strings.Contains(image, "@") || strings.Contains(image[strings.LastIndex(image, "/")+1:], ":")
+}
+
+// validateVersion checks that the version of the spec does not conflict
+// with the tag of its image.
+func validateVersion(spec RedisClusterSpec) error {
+    if spec.Version == "" {
+        return nil
+    }
+    if spec.Image != "" && imageHasTag(spec.Image) {
+        return fmt.Errorf("version %s cannot be set along with the tagged image %s", spec.Version, spec.Image)
+    }
+    if strings.ContainsAny(spec.Version, ":@/ ") {
+        return fmt.Errorf("version %s is not a valid image tag", spec.Version)
+    }
+    return nil
+}
+
+// isReplicatedMaster reports whether the Redis server of the pod is a master
+// with replicas connected, which must hand its role over before it is replaced.
+func isReplicatedMaster(pod *corev1.Pod) (bool, error) {
+    info, err := getInfo(pod, "replication")
+    if err != nil {
+        return false, err
+    }
+    return info["role"] == "master" && info["connected_slaves"] != "" && info["connected_slaves"] != "0", nil
+}
+
+// reconcileUpgrade replaces the pods running an outdated revision of the
+// StatefulSet, one per reconcile and only while all the pods are ready. The
+// replicas go first; a master is replaced once one of its replicas took
+// over, so the cluster keeps serving writes during the upgrade.
+func (h *RedisClusterHandler) reconcileUpgrade(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    if strategyType(cluster.Spec) != ManagedStrategyType {
+        return nil
+    }
+
+    // Leave the pods to a restore in progress, which replaces them all at once
+    if cluster.ObjectMeta.Annotations[restoreAnnotation] != "" {
+        return nil
+    }
+
+    // Get the StatefulSet and its current revision
+    statefulSet := &appsv1.StatefulSet{}
+    err := sdk.Get(statefulSet, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    revision := statefulSet.Status.UpdateRevision
+    if revision == "" {
+        return nil
+    }
+
+    // Wait for the pods replaced so far to come back
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    if statefulSet.Spec.Replicas == nil || len(pods.Items) != int(*statefulSet.Spec.Replicas) {
+        return nil
+    }
+    for i := range pods.Items {
+        if !isPodReady(&pods.Items[i]) || pods.Items[i].DeletionTimestamp != nil {
+            return nil
+        }
+    }
+
+    // Split the outdated pods into replicas and masters
+    var replica, master *corev1.Pod
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if pod.Labels[appsv1.StatefulSetRevisionLabel] == revision {
+            continue
+        }
+        replicated, err := isReplicatedMaster(pod)
+        if err != nil {
+            return fmt.Errorf("reading the role of pod %s: %v", pod.Name, err)
+        }
+        if replicated {
+            if master == nil {
+                master = pod
+            }
+        } else if replica == nil {
+            replica = pod
+        }
+    }
+
+    // Replace a replica
+    if replica != nil {
+        return h.replaceOutdatedPod(ctx, namespace, cluster, replica, revision)
+    }
+    if master == nil {
+        return nil
+    }
+
+    // Hand the master role over, the old master is replaced with the
+    // replicas once it follows the new master
+    h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonFailover, "Failing over master %s before upgrading it", master.Name)
+    failoversTotal.WithLabelValues(namespace, cluster.ObjectMeta.Name, failoverReasonUpgrade).Inc()
+    switch cluster.Spec.Mode {
+    case ModeSentinel:
+        return sentinelFailover(ctx, namespace, cluster)
+    case ModeCluster:
+        return clusterFailover(pods.Items, master)
+    default:
+        cluster.Status.MasterNode = master.Name
+        err = promoteReplica(cluster, pods.Items)
+        if err != nil {
+            return err
+        }
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonPromoted, "Promoted replica %s to master in place of %s", cluster.Status.MasterNode, master.Name)
+        return h.replaceOutdatedPod(ctx, namespace, cluster, master, revision)
+    }
+}
+
+// replaceOutdatedPod deletes a pod so that the StatefulSet recreates it at the given revision.
+func (h *RedisClusterHandler) replaceOutdatedPod(ctx sdk.Context, namespace string, cluster *RedisCluster, pod *corev1.Pod, revision string) error {
+    err := ctx.GetClientset().CoreV1().Pods(namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+    if err != nil {
+        return err
+    }
+    h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonUpgrading, "Replacing pod %s with revision %s", pod.Name, revision)
+    return nil
+}
+
+// sentinelFailover asks a sentinel to fail the master over to a replica.
+func sentinelFailover(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    sentinels, err := listSentinelPods(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+    if len(sentinels) == 0 {
+        return fmt.Errorf("no sentinel is ready to fail the master over")
+    }
+    client := newSentinelClient(sentinels[0])
+    defer client.Close()
+    return client.Process(redis.NewStatusCmd("sentinel", "failover", cluster.ObjectMeta.Name))
+}
+
+// clusterFailover makes a replica of the master of a sharded cluster take
+// over its slots with CLUSTER FAILOVER.
+func clusterFailover(pods []corev1.Pod, master *corev1.Pod) error {
+    for i := range pods {
+        pod := &pods[i]
+        if pod.Name == master.Name {
+            continue
+        }
+        info, err := getInfo(pod, "replication")
+        if err != nil {
+            return err
+        }
+        if info["role"] != "slave" || info["master_host"] != master.Status.PodIP {
+            continue
+        }
+        client := newRedisClient(pod)
+        err = client.Process(redis.NewStatusCmd("cluster", "failover"))
+        client.Close()
+        return err
+    }
+    return fmt.Errorf("no replica of master %s to fail over to", master.Name)
+}
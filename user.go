@@ -0,0 +1,274 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+    "github.com/go-redis/redis"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisUser is the custom resource managing an ACL user on the nodes of a
+// RedisCluster.
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Username",type=string,JSONPath=`.spec.username`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type RedisUser struct {
+    metav1.TypeMeta   `json:",inline"`
+    metav1.ObjectMeta `json:"metadata"`
+    Spec              RedisUserSpec   `json:"spec"`
+    Status            RedisUserStatus `json:"status,omitempty"`
+}
+
+// RedisUserList is a list of RedisUser resources.
+// +kubebuilder:object:root=true
+type RedisUserList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata"`
+    Items           []RedisUser `json:"items"`
+}
+
+// RedisUserSpec is the spec for a RedisUser resource.
+type RedisUserSpec struct {
+    // ClusterName is the RedisCluster whose nodes get the user, in the
+    // namespace of the user.
+    ClusterName string `json:"clusterName"`
+
+    // Username is the name of the ACL user. It cannot be default, which the
+    // operator authenticates as.
+    Username string `json:"username"`
+
+    // Rules are the ACL rules of the user, such as ~cache:* or +@read. The
+    // user starts without any permission, so the rules grant all it can do.
+    Rules []string `json:"rules,omitempty"`
+
+    // PasswordSecretRef selects the key of a Secret holding the password of
+    // the user. A user without one can only log in with the nopass rule.
+    PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+}
+
+// RedisUserStatus is the state of the user on the nodes of its cluster.
+type RedisUserStatus struct {
+    // Phase is Synced once the user is set on all the ready nodes, or Failed.
+    Phase string `json:"phase,omitempty"`
+
+    // Message explains the phase.
+    Message string `json:"message,omitempty"`
+
+    // ObservedGeneration is the generation of the spec last applied.
+    ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+    // Nodes are the pods the user was last set on.
+    Nodes []string `json:"nodes,omitempty"`
+
+    // LastSyncTime is when the user last changed on the nodes.
+    LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+const (
+    // UserPhaseSynced is the phase of a user set on all the ready nodes.
+    UserPhaseSynced = "Synced"
+
+    // UserPhaseFailed is the phase of a user that could not be set.
+    UserPhaseFailed = "Failed"
+)
+
+// reservedUsername is the user the operator, the probes and the replicas
+// authenticate as, which a RedisUser cannot redefine.
+const reservedUsername = "default"
+
+// validateUser checks the spec of a user. Passwords are taken from Secrets,
+// so that they do not sit in the spec.
+func validateUser(user *RedisUser) error {
+    username := user.Spec.Username
+    if username == "" || strings.ContainsAny(username, " \t\r\n") {
+        return fmt.Errorf("username %q is invalid", username)
+    }
+    if username == reservedUsername {
+        return fmt.Errorf("user %s is managed by the operator", reservedUsername)
+    }
+    for _, rule := range user.Spec.Rules {
+        if rule == "" || strings.ContainsAny(rule, " \t\r\n") {
+            return fmt.Errorf("ACL rule %q must be a single word", rule)
+        }
+        if strings.HasPrefix(rule, ">") || strings.HasPrefix(rule, "#") {
+            return fmt.Errorf("ACL rule %s sets a password, use passwordSecretRef instead", rule)
+        }
+    }
+    return nil
+}
+
+// userPassword returns the password of the user, or an empty string if the
+// spec does not reference one.
+func userPassword(namespace string, user *RedisUser) (string, error) {
+    ref := user.Spec.PasswordSecretRef
+    if ref == nil {
+        return "", nil
+    }
+    secret := &corev1.Secret{}
+    err := sdk.Get(secret, namespace, ref.Name)
+    if apierrors.IsNotFound(err) {
+        return "", fmt.Errorf("password secret %s not found", ref.Name)
+    }
+    if err != nil {
+        return "", err
+    }
+    password := secret.Data[ref.Key]
+    if len(password) == 0 {
+        return "", fmt.Errorf("password secret %s has no key %s", ref.Name, ref.Key)
+    }
+    return string(password), nil
+}
+
+// aclSetUserArgs returns the ACL SETUSER command defining the user from
+// scratch, so that rules dropped from the spec are dropped from the nodes.
+func aclSetUserArgs(user *RedisUser, password string) []interface{} {
+    args := []interface{}{"acl", "setuser", user.Spec.Username, "reset", "on"}
+    if password != "" {
+        args = append(args, ">"+password)
+    }
+    for _, rule := range user.Spec.Rules {
+        args = append(args, rule)
+    }
+    return args
+}
+
+// handleUser sets a RedisUser on the nodes of its cluster, or removes it
+// from them when the RedisUser is deleted.
+func (h *RedisClusterHandler) handleUser(ctx sdk.Context, user *RedisUser) error {
+    namespace, err := objectNamespace(user)
+    if err != nil {
+        return err
+    }
+
+    // Get the RedisCluster of the user
+    cluster := &RedisCluster{}
+    err = sdk.Get(cluster, namespace, user.Spec.ClusterName)
+    if apierrors.IsNotFound(err) {
+        if user.GetDeletionTimestamp() != nil {
+            return removeFinalizer(user)
+        }
+        return setUserStatus(user, UserPhaseFailed, fmt.Sprintf("RedisCluster %s not found", user.Spec.ClusterName), nil)
+    }
+    if err != nil {
+        return err
+    }
+
+    // Remove the user from the nodes before letting the deletion through
+    if user.GetDeletionTimestamp() != nil {
+        if !hasFinalizer(user) {
+            return nil
+        }
+        err = deleteUser(ctx, namespace, cluster, user)
+        if err != nil {
+            return err
+        }
+        return removeFinalizer(user)
+    }
+
+    // Register the finalizer
+    err = addFinalizer(user)
+    if err != nil {
+        return err
+    }
+    if isPaused(cluster) {
+        return nil
+    }
+    return syncUser(ctx, namespace, cluster, user)
+}
+
+// syncUser sets the user on the ready nodes of the cluster and records them
+// in its status. Nodes lose their users when they restart, so the operator
+// sets them again on every resync.
+func syncUser(ctx sdk.Context, namespace string, cluster *RedisCluster, user *RedisUser) error {
+    err := validateUser(user)
+    if err != nil {
+        return setUserStatus(user, UserPhaseFailed, err.Error(), nil)
+    }
+    password, err := userPassword(namespace, user)
+    if err != nil {
+        return setUserStatus(user, UserPhaseFailed, err.Error(), nil)
+    }
+
+    // Set the user on each ready node
+    pods, err := listClusterPods(ctx, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+    nodes := []string{}
+    for i := range pods.Items {
+        pod := &pods.Items[i]
+        if !isPodReady(pod) {
+            continue
+        }
+        client := newRedisClient(pod)
+        err = client.Process(redis.NewStatusCmd(aclSetUserArgs(user, password)...))
+        client.Close()
+        if err != nil {
+            updateErr := setUserStatus(user, UserPhaseFailed, fmt.Sprintf("setting the user on pod %s: %v", pod.Name, err), nodes)
+            if updateErr != nil {
+                return updateErr
+            }
+            return fmt.Errorf("setting user %s on pod %s: %v", user.Spec.Username, pod.Name, err)
+        }
+        nodes = append(nodes, pod.Name)
+    }
+
+    return setUserStatus(user, UserPhaseSynced, fmt.Sprintf("The user is set on %d nodes", len(nodes)), nodes)
+}
+
+// syncClusterUsers sets the RedisUsers of a cluster on its nodes again, so
+// that restarted and replaced nodes get them back.
+func syncClusterUsers(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    users := &RedisUserList{}
+    err := sdk.List(namespace, users)
+    if err != nil {
+        return err
+    }
+    for i := range users.Items {
+        user := &users.Items[i]
+        if user.Spec.ClusterName != cluster.ObjectMeta.Name || user.GetDeletionTimestamp() != nil {
+            continue
+        }
+        err = syncUser(ctx, namespace, cluster, user)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// deleteUser removes the user from the ready nodes of the cluster.
+func deleteUser(ctx sdk.Context, namespace string, cluster *RedisCluster, user *RedisUser) error {
+    if user.Spec.Username == reservedUsername {
+        return nil
+    }
+    return forEachReadyNode(ctx, namespace, cluster.ObjectMeta.Name, func(client *redis.Client) error {
+        return client.Process(redis.NewIntCmd("acl", "deluser", user.Spec.Username))
+    })
+}
+
+// setUserStatus records the phase of a user and the nodes it is set on,
+// leaving the RedisUser untouched if nothing changed.
+func setUserStatus(user *RedisUser, phase, message string, nodes []string) error {
+    if len(nodes) == 0 {
+        nodes = nil
+    }
+    status := user.Status
+    if status.Phase == phase && status.Message == message && status.ObservedGeneration == user.Generation && reflect.DeepEqual(status.Nodes, nodes) {
+        return nil
+    }
+
+    now := metav1.Now()
+    user.Status.Phase = phase
+    user.Status.Message = message
+    user.Status.ObservedGeneration = user.Generation
+    user.Status.Nodes = nodes
+    user.Status.LastSyncTime = &now
+    return sdk.Update(user)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultMaxClusterSize is the largest cluster size accepted unless
+// MAX_CLUSTER_SIZE sets another one.
+const defaultMaxClusterSize = 100
+
+// getMaxClusterSize returns the maximum cluster size set through
+// MAX_CLUSTER_SIZE, or the default one.
+func getMaxClusterSize() int32 {
+    size, err := strconv.Atoi(os.Getenv("MAX_CLUSTER_SIZE"))
+    if err != nil || size < 1 {
+        return defaultMaxClusterSize
+    }
+    return int32(size)
+}
+
+// validateSpec checks the spec of the cluster before any resource is created
+// for it.
+func (h *RedisClusterHandler) validateSpec(cluster *RedisCluster) error {
+    size := cluster.Spec.Size
+    if size < 1 {
+        return fmt.Errorf("size %d is invalid, a cluster needs at least 1 node", size)
+    }
+    if pods := podCount(cluster.Spec); pods > h.maxClusterSize {
+        return fmt.Errorf("%d pods exceed the maximum cluster size of %d", pods, h.maxClusterSize)
+    }
+    err := validateMode(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateMinAvailable(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateConfig(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateCertificate(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateAuth(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateVersion(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateStrategy(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateScheduling(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateStorage(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateSecurityContext(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateReplicationSource(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateExposure(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateModules(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateDiagnostics(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validatePersistence(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateMaxMemory(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateLFU(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateReconcilePeriod(cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validatePodExtensions(cluster)
+    if err != nil {
+        return err
+    }
+    return validateRedisConfig(cluster.Spec)
+}
+
+// setSpecInvalid marks the cluster Degraded because its spec is invalid.
+func setSpecInvalid(namespace string, cluster *RedisCluster, specErr error) error {
+    // Get the RedisCluster
+    current := &RedisCluster{}
+    err := sdk.Get(current, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+
+    phaseChanged := current.Status.Phase != PhaseDegraded
+    current.Status.Phase = PhaseDegraded
+    conditionChanged := meta.SetStatusCondition(&current.Status.Conditions, metav1.Condition{
+        Type:    ConditionReady,
+        Status:  metav1.ConditionFalse,
+        Reason:  "InvalidSpec",
+        Message: specErr.Error(),
+    })
+    if !phaseChanged && !conditionChanged {
+        return nil
+    }
+    return updateStatus(current)
+}
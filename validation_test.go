@@ -0,0 +1,55 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestValidateSpecSize(t *testing.T) {
+    handler, _ := newTestHandler()
+    handler.maxClusterSize = 10
+    tests := []struct {
+        name  string
+        spec  RedisClusterSpec
+        valid bool
+    }{
+        {"single node", RedisClusterSpec{Size: 1}, true},
+        {"at the maximum", RedisClusterSpec{Size: 10}, true},
+        {"no node", RedisClusterSpec{Size: 0}, false},
+        {"negative size", RedisClusterSpec{Size: -3}, false},
+        {"above the maximum", RedisClusterSpec{Size: 11}, false},
+        {"cluster mode with 3 masters", RedisClusterSpec{Size: 3, Mode: ModeCluster}, true},
+        {"cluster mode with 2 masters", RedisClusterSpec{Size: 2, Mode: ModeCluster}, false},
+        {"cluster mode with replicas within the maximum", RedisClusterSpec{Size: 5, Mode: ModeCluster, Cluster: &RedisClusterModeSpec{ReplicasPerMaster: 1}}, true},
+        {"cluster mode with replicas above the maximum", RedisClusterSpec{Size: 6, Mode: ModeCluster, Cluster: &RedisClusterModeSpec{ReplicasPerMaster: 1}}, false},
+        {"unknown mode", RedisClusterSpec{Size: 3, Mode: "ring"}, false},
+    }
+    for _, test := range tests {
+        cluster := newTestCluster(0)
+        cluster.Spec = test.spec
+        err := handler.validateSpec(cluster)
+        if test.valid && err != nil {
+            t.Errorf("%s: got %v, want no error", test.name, err)
+        }
+        if !test.valid && err == nil {
+            t.Errorf("%s: got no error, want the spec rejected", test.name)
+        }
+    }
+}
+
+func TestGetMaxClusterSize(t *testing.T) {
+    tests := []struct {
+        value string
+        want  int32
+    }{
+        {"", defaultMaxClusterSize},
+        {"20", 20},
+        {"0", defaultMaxClusterSize},
+        {"many", defaultMaxClusterSize},
+    }
+    for _, test := range tests {
+        t.Setenv("MAX_CLUSTER_SIZE", test.value)
+        if got := getMaxClusterSize(); got != test.want {
+            t.Errorf("max cluster size %q: got %d, want %d", test.value, got, test.want)
+        }
+    }
+}
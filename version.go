@@ -0,0 +1,32 @@
+package main
+
+import (
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+)
+
+// Version is the version of the operator, set at build time with
+// -ldflags "-X main.Version=<version>".
+var Version = "dev"
+
+// updateManagedBy stamps the RedisCluster with the operator version, the
+// API version it was reconciled through and the reconciling instance.
+func updateManagedBy(namespace string, cluster *RedisCluster) error {
+    managedBy := RedisClusterManagedBy{
+        OperatorVersion: Version,
+        APIVersion:      cluster.TypeMeta.APIVersion,
+        Instance:        operatorIdentity(),
+    }
+    if cluster.Status.ManagedBy != nil && *cluster.Status.ManagedBy == managedBy {
+        return nil
+    }
+
+    // Get the RedisCluster
+    current := &RedisCluster{}
+    err := sdk.Get(current, namespace, cluster.ObjectMeta.Name)
+    if err != nil {
+        return err
+    }
+
+    current.Status.ManagedBy = &managedBy
+    return updateStatus(current)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+    "os"
+    "strings"
+    "github.com/operator-framework/operator-sdk/pkg/sdk"
+)
+
+// watchNamespaceEnv lists the namespaces the operator watches, separated by
+// commas. The operator watches all namespaces when it is unset or empty.
+const watchNamespaceEnv = "WATCH_NAMESPACE"
+
+// watchNamespaces returns the namespaces the operator watches, a single
+// empty namespace standing for all of them.
+func watchNamespaces() []string {
+    namespaces := []string{}
+    for _, namespace := range strings.Split(os.Getenv(watchNamespaceEnv), ",") {
+        namespace = strings.TrimSpace(namespace)
+        if namespace != "" {
+            namespaces = append(namespaces, namespace)
+        }
+    }
+    if len(namespaces) == 0 {
+        return []string{""}
+    }
+    return namespaces
+}
+
+// RegisterWatches watches the RedisClusters, their StatefulSets, the
+// RedisClusterRestores, the RedisUsers and the RedisOperations in each
+// watched namespace, delivering them again every --resync-period. main
+// calls it before running the handler.
+func RegisterWatches() {
+    period := *resyncPeriod
+    for _, namespace := range watchNamespaces() {
+        sdk.Watch(SchemeGroupVersion.String(), "RedisCluster", namespace, period)
+        sdk.Watch("apps/v1", "StatefulSet", namespace, period)
+        sdk.Watch(SchemeGroupVersion.String(), "RedisClusterRestore", namespace, period)
+        sdk.Watch(SchemeGroupVersion.String(), "RedisUser", namespace, period)
+        sdk.Watch(SchemeGroupVersion.String(), "RedisOperation", namespace, period)
+    }
+}
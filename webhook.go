@@ -0,0 +1,143 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "reflect"
+    admissionv1 "k8s.io/api/admission/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+    // validatingWebhookPath and defaultingWebhookPath are the paths the
+    // admission webhooks of the RedisClusters are served on.
+    validatingWebhookPath = "/validate-rediscluster"
+    defaultingWebhookPath = "/mutate-rediscluster"
+)
+
+// ServeWebhook serves the defaulting and validating admission webhooks of the
+// RedisClusters over TLS at the address until the server fails. main runs it
+// in the background next to the handler.
+func ServeWebhook(address, certFile, keyFile string) error {
+    validator := &RedisClusterHandler{maxClusterSize: getMaxClusterSize()}
+    mux := http.NewServeMux()
+    mux.HandleFunc(validatingWebhookPath, serveAdmission(validator.reviewValidation))
+    mux.HandleFunc(defaultingWebhookPath, serveAdmission(reviewDefaulting))
+    return http.ListenAndServeTLS(address, certFile, keyFile, mux)
+}
+
+// serveAdmission returns an HTTP handler answering AdmissionReviews with the
+// response of the review function.
+func serveAdmission(review func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        admission := &admissionv1.AdmissionReview{}
+        err := json.NewDecoder(r.Body).Decode(admission)
+        if err != nil || admission.Request == nil {
+            http.Error(w, "malformed admission review", http.StatusBadRequest)
+            return
+        }
+
+        admission.Response = review(admission.Request)
+        admission.Response.UID = admission.Request.UID
+        admission.Request = nil
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(admission)
+    }
+}
+
+// denied returns an admission response rejecting the object with the error.
+func denied(err error) *admissionv1.AdmissionResponse {
+    return &admissionv1.AdmissionResponse{
+        Allowed: false,
+        Result: &metav1.Status{
+            Status:  metav1.StatusFailure,
+            Reason:  metav1.StatusReasonInvalid,
+            Code:    http.StatusUnprocessableEntity,
+            Message: err.Error(),
+        },
+    }
+}
+
+// reviewValidation denies the specs the handler would reject.
+func (h *RedisClusterHandler) reviewValidation(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+    err := h.validateAdmission(request)
+    if err != nil {
+        return denied(err)
+    }
+    return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+// reviewDefaulting patches the spec of a created or updated RedisCluster
+// with its defaults.
+func reviewDefaulting(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+    response := &admissionv1.AdmissionResponse{Allowed: true}
+    if request.Operation != admissionv1.Create && request.Operation != admissionv1.Update {
+        return response
+    }
+    cluster := &RedisCluster{}
+    err := json.Unmarshal(request.Object.Raw, cluster)
+    if err != nil {
+        return denied(fmt.Errorf("decoding the RedisCluster: %v", err))
+    }
+    if !setDefaults(&cluster.Spec) {
+        return response
+    }
+
+    // Replace the whole spec, the patch does not depend on which fields
+    // the object sets
+    patch, err := json.Marshal([]map[string]interface{}{{
+        "op":    "add",
+        "path":  "/spec",
+        "value": cluster.Spec,
+    }})
+    if err != nil {
+        return denied(err)
+    }
+    patchType := admissionv1.PatchTypeJSONPatch
+    response.Patch = patch
+    response.PatchType = &patchType
+    return response
+}
+
+// validateAdmission checks the RedisCluster of an admission request. Updates
+// leaving the spec alone are let through, so the operator can still record
+// the status and remove the finalizer of a cluster whose spec is invalid.
+func (h *RedisClusterHandler) validateAdmission(request *admissionv1.AdmissionRequest) error {
+    if request.Operation != admissionv1.Create && request.Operation != admissionv1.Update {
+        return nil
+    }
+    cluster := &RedisCluster{}
+    err := json.Unmarshal(request.Object.Raw, cluster)
+    if err != nil {
+        return fmt.Errorf("decoding the RedisCluster: %v", err)
+    }
+    if request.Operation == admissionv1.Create {
+        return h.validateSpec(cluster)
+    }
+
+    old := &RedisCluster{}
+    err = json.Unmarshal(request.OldObject.Raw, old)
+    if err != nil {
+        return fmt.Errorf("decoding the previous RedisCluster: %v", err)
+    }
+    if reflect.DeepEqual(old.Spec, cluster.Spec) {
+        return nil
+    }
+    err = h.validateSpec(cluster)
+    if err != nil {
+        return err
+    }
+    return validateSpecUpdate(old.Spec, cluster.Spec)
+}
+
+// validateSpecUpdate checks that the spec of a cluster can change from the
+// old one. The data is not migrated between a sharded cluster and a
+// replicated one, so the mode cannot cross that line.
+func validateSpecUpdate(old, spec RedisClusterSpec) error {
+    if (old.Mode == ModeCluster) != (spec.Mode == ModeCluster) {
+        return fmt.Errorf("mode cannot change from %q to %q, the data is not migrated in or out of cluster mode", old.Mode, spec.Mode)
+    }
+    return nil
+}
@@ -2,16 +2,37 @@ package main
 
 import (
     "fmt"
+    "reflect"
+    "sort"
+    "sync"
+    "time"
     "github.com/operator-framework/operator-sdk/pkg/sdk"
-    "github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+    "golang.org/x/time/rate"
     appsv1 "k8s.io/api/apps/v1"
     corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+    "k8s.io/apimachinery/pkg/api/resource"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-    "k8s.io/apimachinery/pkg/labels"
     "k8s.io/apimachinery/pkg/types"
+    "k8s.io/apimachinery/pkg/util/intstr"
+    "k8s.io/client-go/tools/record"
 )
 
-// RedisCluster is the custom resource.
+// adoptScaleAnnotation makes the operator adopt replica count changes made
+// directly on the StatefulSet instead of reverting them.
+const adoptScaleAnnotation = "yaro.io/adopt-scale"
+
+// RedisCluster is the custom resource. Its scale subresource maps the
+// replicas to .spec.size, .status.replicas and .status.selector, so that it
+// can be scaled with kubectl scale or by a HorizontalPodAutoscaler.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.size,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.spec.size`
+// +kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type RedisCluster struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata"`
@@ -19,186 +40,1583 @@ type RedisCluster struct {
     Status            RedisClusterStatus `json:"status,omitempty"`
 }
 
+// RedisClusterList is a list of RedisCluster resources.
+// +kubebuilder:object:root=true
+type RedisClusterList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata"`
+    Items           []RedisCluster `json:"items"`
+}
+
 // RedisClusterSpec is the spec for a RedisCluster resource.
 type RedisClusterSpec struct {
+    // Size is the number of nodes, or of masters in cluster mode.
+    // +kubebuilder:validation:Minimum=1
     Size int32 `json:"size"`
+
+    // Paused freezes the reconciliation of the cluster, for maintenance
+    // done by hand. The yaro.io/paused annotation has the same effect.
+    Paused bool `json:"paused,omitempty"`
+
+    // Hibernated scales the cluster to zero pods, keeping its volume
+    // claims, Services and Secrets, for instance for development clusters
+    // out of hours. Without durable storage, the data is snapshotted to the
+    // backup bucket first and restored when the cluster resumes.
+    Hibernated bool `json:"hibernated,omitempty"`
+
+    // ReconcilePeriod is how often the unchanged cluster is reconciled
+    // again to correct drift, every resync of the operator when unset.
+    // Changes to the cluster are reconciled right away.
+    ReconcilePeriod *metav1.Duration `json:"reconcilePeriod,omitempty"`
+
+    // Mode is how the nodes are organized: standalone, the default,
+    // sentinel for a master and replicas supervised by Redis Sentinel, or
+    // cluster for a sharded Redis Cluster of Size masters.
+    // +kubebuilder:validation:Enum=standalone;sentinel;cluster
+    Mode string `json:"mode,omitempty"`
+
+    // Sentinel configures the sentinels of a cluster in sentinel mode.
+    Sentinel *RedisSentinelSpec `json:"sentinel,omitempty"`
+
+    // Cluster configures the shards of a cluster in cluster mode.
+    Cluster *RedisClusterModeSpec `json:"cluster,omitempty"`
+
+    // Image is the Redis image, redis:latest by default. Changing it rolls
+    // the pods to the new image.
+    Image string `json:"image,omitempty"`
+
+    // Version is the Redis version, used as the tag of the image. The image
+    // must not set a tag of its own.
+    // +kubebuilder:validation:Pattern=`^[^:@/ ]+$`
+    Version string `json:"version,omitempty"`
+
+    // ImagePullPolicy is the pull policy of the Redis image.
+    ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+    // MaxUnavailable is the number of unready pods the failover deletes per
+    // reconcile, 1 by default.
+    MaxUnavailable int32 `json:"maxUnavailable,omitempty"`
+
+    // MinAvailable is the number of healthy nodes below which the failover
+    // deletes no pod, a majority of the nodes by default.
+    MinAvailable *int32 `json:"minAvailable,omitempty"`
+
+    // Strategy is how the pods are replaced on updates. By default the
+    // operator replaces them one at a time, the replicas before the masters.
+    Strategy *RedisStrategySpec `json:"strategy,omitempty"`
+
+    // Resources are the compute resources of the redis container.
+    Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+    // PodSecurityContext is the security context of the pods. By default
+    // they run as the non-root redis user of the image.
+    PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+    // SecurityContext is the security context of the containers. By
+    // default they drop all capabilities and cannot escalate privileges.
+    SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+    // PasswordSecretRef selects the key of a Secret holding the Redis
+    // password. When set, clients, replicas and probes must authenticate.
+    PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+
+    // Auth protects the cluster with the password of a Secret, generated by
+    // the operator when the spec does not name one. It cannot be set along
+    // with PasswordSecretRef.
+    Auth *RedisAuthSpec `json:"auth,omitempty"`
+
+    // Storage requests a volume for the Redis data. When set, each pod gets a
+    // volume claim mounted at /data instead of an emptyDir.
+    Storage *RedisStorageSpec `json:"storage,omitempty"`
+
+    // Persistence sets how the nodes persist their data: RDB snapshots, an
+    // append only file, both or none. The image defaults apply when unset.
+    // Changes are applied to the running nodes before the pods restart.
+    Persistence *RedisPersistenceSpec `json:"persistence,omitempty"`
+
+    // Probes tunes the readiness and liveness probes of the redis container.
+    Probes *RedisProbesSpec `json:"probes,omitempty"`
+
+    // HealthCheck tunes the health check the operator runs against the nodes.
+    HealthCheck *RedisHealthCheckSpec `json:"healthCheck,omitempty"`
+
+    // Diagnostics collects the slow log and the latency events of the nodes
+    // into the metrics and the status.
+    Diagnostics *RedisDiagnosticsSpec `json:"diagnostics,omitempty"`
+
+    // NetworkPolicy restricts the access to the pods with a NetworkPolicy.
+    NetworkPolicy *RedisNetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+    // InitContainers run in each Redis pod before Redis starts, for
+    // instance to seed the data or prepare config files.
+    InitContainers []corev1.Container `json:"initContainers,omitempty"`
+
+    // Sidecars run in each Redis pod next to Redis, for instance to ship
+    // its logs.
+    Sidecars []corev1.Container `json:"sidecars,omitempty"`
+
+    // ExtraVolumes are added to the Redis pods for the init containers and
+    // sidecars to mount.
+    ExtraVolumes []corev1.Volume `json:"extraVolumes,omitempty"`
+
+    // ExtraVolumeMounts mount extra volumes into the redis container.
+    ExtraVolumeMounts []corev1.VolumeMount `json:"extraVolumeMounts,omitempty"`
+
+    // Modules are the Redis modules every node loads at startup.
+    Modules []RedisModule `json:"modules,omitempty"`
+
+    // Exposure gives each pod its own Service reachable from outside the
+    // Kubernetes cluster, and has the nodes announce its address.
+    Exposure *RedisExposureSpec `json:"exposure,omitempty"`
+
+    // ReplicationSource makes the nodes replicas of a remote master, such
+    // as the master of a RedisCluster in another region. The yaro.io/promote
+    // annotation breaks the link and removes the source.
+    ReplicationSource *RedisReplicationSource `json:"replicationSource,omitempty"`
+
+    // Port is the port Redis listens on and the client Service exposes, 6379 by default.
+    Port int32 `json:"port,omitempty"`
+
+    // ProtoMaxBulkLen is the maximum size of a single Redis string (proto-max-bulk-len).
+    ProtoMaxBulkLen *resource.Quantity `json:"protoMaxBulkLen,omitempty"`
+
+    // ActiveRehashing toggles the incremental rehashing of the main dictionary
+    // (activerehashing). Redis enables it by default.
+    ActiveRehashing *bool `json:"activeRehashing,omitempty"`
+
+    // NotifyKeyspaceEvents are the keyspace notification classes to enable
+    // (notify-keyspace-events), e.g. "KEA". Changes are applied without a restart.
+    NotifyKeyspaceEvents string `json:"notifyKeyspaceEvents,omitempty"`
+
+    // MaxMemory is the memory limit of the dataset of a node (maxmemory),
+    // at most 80% of the memory limit of the container. Changes are applied
+    // without a restart.
+    MaxMemory *resource.Quantity `json:"maxMemory,omitempty"`
+
+    // MaxMemoryPolicy is how a node evicts keys once it reaches MaxMemory
+    // (maxmemory-policy), noeviction by default in Redis. Changes are
+    // applied without a restart.
+    MaxMemoryPolicy string `json:"maxMemoryPolicy,omitempty"`
+
+    // LFU tunes the access counters of the LFU eviction policies. It may
+    // only be set with the allkeys-lfu or volatile-lfu MaxMemoryPolicy.
+    // Changes are applied without a restart.
+    LFU *RedisLFUSpec `json:"lfu,omitempty"`
+
+    // MaxMemorySamples is the number of keys sampled by the eviction
+    // algorithms (maxmemory-samples). Redis defaults to 5.
+    MaxMemorySamples int32 `json:"maxMemorySamples,omitempty"`
+
+    // MaxMemoryEvictionTenacity tunes how aggressively Redis evicts keys
+    // versus serving clients (maxmemory-eviction-tenacity), from 0 to 100.
+    // It is applied at runtime to nodes running Redis 6.2 or later.
+    MaxMemoryEvictionTenacity *int32 `json:"maxMemoryEvictionTenacity,omitempty"`
+
+    // LazyFlush makes FLUSHALL and FLUSHDB without a SYNC or ASYNC modifier
+    // free memory asynchronously (lazyfree-lazy-user-flush), so that flushing
+    // a large dataset does not block the server. It is applied at runtime to
+    // nodes running Redis 6.2 or later, and left to the config when unset.
+    // Clients can always request ASYNC, and the flushdb operation does when
+    // it is true.
+    LazyFlush *bool `json:"lazyFlush,omitempty"`
+
+    // LatencyMonitorThreshold enables the latency monitor for operations
+    // taking at least this many milliseconds (latency-monitor-threshold).
+    // Zero disables it.
+    LatencyMonitorThreshold *int32 `json:"latencyMonitorThreshold,omitempty"`
+
+    // Replica configures the replication between the nodes.
+    Replica *RedisReplicaSpec `json:"replica,omitempty"`
+
+    // WorkingDir is the directory Redis writes its RDB and AOF files to (dir).
+    // It must be within the data volume and defaults to its mount path.
+    WorkingDir string `json:"workingDir,omitempty"`
+
+    // ConfigMapRef names a ConfigMap whose redis.conf key is used as the
+    // Redis config file. The other settings of the spec override it.
+    ConfigMapRef *corev1.LocalObjectReference `json:"configMapRef,omitempty"`
+
+    // ConfigIncludes are ConfigMaps holding a redis.conf key, included in
+    // order so that later ones override earlier ones. The other settings of
+    // the spec override them, and directives the operator manages are
+    // rejected.
+    ConfigIncludes []string `json:"configIncludes,omitempty"`
+
+    // Config holds redis.conf directives, rendered into a ConfigMap included
+    // after ConfigIncludes. Directives the operator manages are rejected, and
+    // changes roll the pods.
+    Config map[string]string `json:"config,omitempty"`
+
+    // CPUAffinity pins the Redis threads to CPUs (Redis 6 or later).
+    CPUAffinity *RedisCPUAffinity `json:"cpuAffinity,omitempty"`
+
+    // ImagePullSecrets are used to pull the images of the Redis pods from
+    // private registries.
+    ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+    // ServiceAccountName is an existing service account the pods run under,
+    // for clusters whose RBAC is managed centrally. When empty, the operator
+    // generates a service account named after the cluster, with a Role
+    // reading the ConfigMaps of the cluster.
+    ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+    // Service configures the client Service.
+    Service *RedisServiceSpec `json:"service,omitempty"`
+
+    // Monitoring runs a redis_exporter sidecar next to each node.
+    Monitoring *RedisMonitoringSpec `json:"monitoring,omitempty"`
+
+    // TLS serves Redis over TLS on the client port with the certificates
+    // of a Secret. Plain TCP connections are no longer accepted.
+    TLS *RedisTLSSpec `json:"tls,omitempty"`
+
+    // Backup schedules snapshots of the data to S3-compatible object storage.
+    Backup *RedisBackupSpec `json:"backup,omitempty"`
+
+    // AntiAffinity spreads the pods across nodes so that losing one node does
+    // not take the whole cluster down. By default the spreading across nodes
+    // is preferred.
+    AntiAffinity *RedisAntiAffinitySpec `json:"antiAffinity,omitempty"`
+
+    // Scheduling places the pods on the nodes: affinity, tolerations, node
+    // selector, topology spread and priority class.
+    Scheduling *RedisSchedulingSpec `json:"scheduling,omitempty"`
+
+    // Debug holds debugging aids that should not be left on in production.
+    Debug *RedisDebugSpec `json:"debug,omitempty"`
+}
+
+// RedisTLSSpec configures TLS for the Redis nodes.
+type RedisTLSSpec struct {
+    // SecretName is the Secret holding the ca.crt, tls.crt and tls.key
+    // keys. The certificate is used by the nodes both as server and as client
+    // for the replication.
+    SecretName string `json:"secretName"`
+
+    // IssuerRef has cert-manager issue the certificates into the Secret,
+    // for the client Service and the DNS names of the pods.
+    IssuerRef *RedisIssuerRef `json:"issuerRef,omitempty"`
+}
+
+// RedisIssuerRef references the cert-manager issuer of the certificates.
+type RedisIssuerRef struct {
+    // Name is the name of the issuer.
+    Name string `json:"name"`
+
+    // Kind is Issuer, the default, or ClusterIssuer.
+    Kind string `json:"kind,omitempty"`
+}
+
+// RedisBackupSpec configures the scheduled backups of a cluster.
+type RedisBackupSpec struct {
+    // Schedule is the cron schedule of the backups, e.g. "0 3 * * *".
+    Schedule string `json:"schedule"`
+
+    // Bucket is the bucket the snapshots are uploaded to.
+    Bucket string `json:"bucket"`
+
+    // Prefix is prepended to the keys of the snapshots, which are stored
+    // under <prefix>/<namespace>/<cluster>/.
+    Prefix string `json:"prefix,omitempty"`
+
+    // Endpoint is the URL of an S3-compatible service, AWS S3 by default.
+    Endpoint string `json:"endpoint,omitempty"`
+
+    // Region is the region of the bucket.
+    Region string `json:"region,omitempty"`
+
+    // CredentialsSecretRef names a Secret holding the AWS_ACCESS_KEY_ID and
+    // AWS_SECRET_ACCESS_KEY of the bucket.
+    CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+
+    // Image is the image uploading the snapshots, which needs the aws CLI.
+    Image string `json:"image,omitempty"`
+}
+
+// RedisAntiAffinitySpec configures how the pods of a cluster are spread.
+type RedisAntiAffinitySpec struct {
+    // TopologyKey is the node label whose values the pods are spread over,
+    // kubernetes.io/hostname by default.
+    TopologyKey string `json:"topologyKey,omitempty"`
+
+    // Required refuses to schedule two pods in the same topology domain.
+    // By default the spreading is only preferred, so clusters larger than
+    // the number of nodes still schedule.
+    Required bool `json:"required,omitempty"`
+}
+
+// RedisSchedulingSpec configures where the pods of a cluster are scheduled.
+type RedisSchedulingSpec struct {
+    // Affinity replaces the affinity of the pods, including the default
+    // anti-affinity. It cannot be set along with AntiAffinity.
+    Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+    // Tolerations let the pods, and the sentinels, run on tainted nodes.
+    Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+    // NodeSelector restricts the pods, and the sentinels, to the nodes
+    // with these labels.
+    NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+    // TopologySpreadConstraints spread the pods across topology domains,
+    // such as zones. A constraint without a label selector spreads the pods
+    // of the cluster.
+    TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+    // PriorityClassName is the priority class of the pods and the sentinels.
+    PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// RedisServiceSpec configures the client Service of a RedisCluster.
+type RedisServiceSpec struct {
+    // Type is the Service type, ClusterIP by default. Changing it updates the
+    // existing Service in place.
+    Type corev1.ServiceType `json:"type,omitempty"`
+
+    // Annotations are added to the Service, e.g. to configure a load balancer.
+    // Annotations set by others on the Service are preserved.
+    Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// RedisCPUAffinity pins the Redis threads and child processes to CPUs. Each
+// list uses the Redis CPU list syntax, e.g. "0-3", "0,2,4" or "0-7:2".
+type RedisCPUAffinity struct {
+    // ServerCPUList pins the main and I/O threads (server_cpulist).
+    ServerCPUList string `json:"serverCPUList,omitempty"`
+
+    // BioCPUList pins the background I/O threads (bio_cpulist).
+    BioCPUList string `json:"bioCPUList,omitempty"`
+
+    // AOFRewriteCPUList pins the AOF rewrite child process (aof_rewrite_cpulist).
+    AOFRewriteCPUList string `json:"aofRewriteCPUList,omitempty"`
+
+    // BGSaveCPUList pins the BGSAVE child process (bgsave_cpulist).
+    BGSaveCPUList string `json:"bgsaveCPUList,omitempty"`
+}
+
+// RedisDebugSpec configures debugging aids for the Redis servers.
+type RedisDebugSpec struct {
+    // EnableCoreDumps lifts the core file size limit of redis-server and
+    // enables its crash log, so a crashing server leaves a core file in its
+    // working directory on the data volume. This only works when the nodes'
+    // kernel.core_pattern writes cores relative to the process directory.
+    EnableCoreDumps bool `json:"enableCoreDumps,omitempty"`
+}
+
+// RedisSentinelSpec configures the sentinels of a cluster.
+type RedisSentinelSpec struct {
+    // Replicas is the number of sentinels, 3 by default. It must be odd.
+    Replicas int32 `json:"replicas,omitempty"`
+
+    // Quorum is the number of sentinels that must agree the master is down
+    // to fail over, a majority of the sentinels by default.
+    Quorum int32 `json:"quorum,omitempty"`
+
+    // DownAfterMilliseconds is how long the master must be unreachable
+    // before a sentinel considers it down, 5000 by default.
+    DownAfterMilliseconds int32 `json:"downAfterMilliseconds,omitempty"`
+}
+
+// RedisClusterModeSpec configures the shards of a cluster in cluster mode.
+type RedisClusterModeSpec struct {
+    // ReplicasPerMaster is the number of replicas of each master.
+    ReplicasPerMaster int32 `json:"replicasPerMaster,omitempty"`
+}
+
+// RedisMonitoringSpec configures the metrics exporter of a RedisCluster.
+type RedisMonitoringSpec struct {
+    // Enabled runs the exporter sidecar and exposes its metrics port on
+    // the headless Service.
+    Enabled bool `json:"enabled,omitempty"`
+
+    // Image is the exporter image, oliver006/redis_exporter:latest by default.
+    Image string `json:"image,omitempty"`
+
+    // Resources are the compute resources of the exporter container.
+    Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+    // ServiceMonitor creates a Prometheus Operator ServiceMonitor scraping
+    // the exporters, when its CRD is installed.
+    ServiceMonitor bool `json:"serviceMonitor,omitempty"`
+}
+
+// RedisAuthSpec configures the password of a RedisCluster.
+type RedisAuthSpec struct {
+    // SecretName is the Secret holding the password under its password
+    // key. When empty, the operator generates <name>-auth and sets it here.
+    SecretName string `json:"secretName,omitempty"`
+
+    // RotationPeriod is how often the operator generates a new password in
+    // the Secret it generated. Secrets named in the spec are rotated by
+    // whoever manages them.
+    RotationPeriod *metav1.Duration `json:"rotationPeriod,omitempty"`
+}
+
+// RedisStrategySpec configures the update strategy of the StatefulSet.
+type RedisStrategySpec struct {
+    // Type is Managed, the default, for the operator to replace the pods,
+    // RollingUpdate for the StatefulSet to replace them in reverse ordinal
+    // order, or OnDelete to only replace pods when they are deleted.
+    Type appsv1.StatefulSetUpdateStrategyType `json:"type,omitempty"`
+
+    // MaxUnavailable is the number or percentage of pods that can be down
+    // during a rolling update, 1 by default.
+    MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// RedisStorageSpec is the persistent storage of a RedisCluster.
+type RedisStorageSpec struct {
+    // StorageClassName is the storage class of the volume claims, the default
+    // storage class when unset.
+    StorageClassName *string `json:"storageClassName,omitempty"`
+
+    // Size is the size of the volume claim of each pod.
+    Size resource.Quantity `json:"size"`
+
+    // AccessModes are the access modes of the volume claims, ReadWriteOnce
+    // by default.
+    AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+    // Ephemeral gives each pod a volume claim that is deleted with the pod,
+    // for caches that want a dedicated volume without keeping the data.
+    Ephemeral bool `json:"ephemeral,omitempty"`
+
+    // RetentionPolicy is what happens to the volume claims when the
+    // RedisCluster is deleted: Retain, the default, keeps them for a new
+    // cluster of the same name, Delete removes them with the cluster.
+    RetentionPolicy string `json:"retentionPolicy,omitempty"`
+
+    // ScaleDownPolicy is what happens to the volume claims of the pods
+    // removed when the cluster shrinks: Retain, the default, keeps them for
+    // when it grows again, Delete removes them once the pods are gone.
+    ScaleDownPolicy string `json:"scaleDownPolicy,omitempty"`
+}
+
+// RedisPersistenceSpec is how the nodes of a RedisCluster persist their data.
+type RedisPersistenceSpec struct {
+    // Save are the RDB snapshot rules (save), each "<seconds> <changes>"
+    // taking a snapshot after that many changes within that many seconds.
+    // No rules disable the snapshots.
+    Save []string `json:"save,omitempty"`
+
+    // AppendOnly logs every write to an append only file (appendonly).
+    AppendOnly bool `json:"appendOnly,omitempty"`
+
+    // AppendFsync is how often the append only file is synced to disk
+    // (appendfsync): always, everysec or no. Redis defaults to everysec.
+    // +kubebuilder:validation:Enum=always;everysec;no
+    AppendFsync string `json:"appendFsync,omitempty"`
+}
+
+// RedisProbesSpec tunes the probes of the redis container.
+type RedisProbesSpec struct {
+    Readiness *RedisProbeSpec `json:"readiness,omitempty"`
+    Liveness  *RedisProbeSpec `json:"liveness,omitempty"`
+
+    // Startup bounds the time Redis has to load its dataset before the
+    // liveness probe starts, five minutes by default.
+    Startup *RedisProbeSpec `json:"startup,omitempty"`
+}
+
+// RedisProbeSpec overrides the timing of a probe. Unset fields keep their defaults.
+type RedisProbeSpec struct {
+    InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+    PeriodSeconds       int32 `json:"periodSeconds,omitempty"`
+    TimeoutSeconds      int32 `json:"timeoutSeconds,omitempty"`
+    FailureThreshold    int32 `json:"failureThreshold,omitempty"`
+}
+
+// RedisExposureSpec exposes the pods of a RedisCluster outside Kubernetes,
+// so that external clients and replicas in other Kubernetes clusters reach
+// each node at the address it announces.
+type RedisExposureSpec struct {
+    // Type is the type of the Service of each pod, NodePort or LoadBalancer.
+    Type corev1.ServiceType `json:"type"`
+
+    // Annotations are added to the Service of each pod, for instance to
+    // configure the load balancers.
+    Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// RedisReplicationSource is a remote master the nodes of a RedisCluster replicate.
+type RedisReplicationSource struct {
+    // Host is the address of the remote master, reachable from the pods.
+    Host string `json:"host"`
+
+    // Port is the port of the remote master, 6379 by default.
+    Port int32 `json:"port,omitempty"`
+
+    // PasswordSecretRef selects the key of a Secret holding the password
+    // of the remote master.
+    PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+}
+
+// RedisModule is a Redis module loaded by the nodes, such as RedisJSON or
+// RediSearch.
+type RedisModule struct {
+    // Name identifies the module in the spec and names its init container.
+    Name string `json:"name"`
+
+    // Path is the absolute path of the shared library of the module, in
+    // Image when set and in the Redis image otherwise.
+    Path string `json:"path"`
+
+    // Image ships the module. An init container copies the module out of
+    // it for Redis to load.
+    Image string `json:"image,omitempty"`
+
+    // Args are passed to the module when it is loaded.
+    Args []string `json:"args,omitempty"`
+}
+
+// RedisHealthCheckSpec tunes the health check the operator runs against the
+// nodes on every reconcile. Unset fields keep their defaults.
+type RedisHealthCheckSpec struct {
+    // TimeoutSeconds is how long the operator waits for a node to answer,
+    // one second by default.
+    TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+    // MaxLagSeconds is how long a replica may go without hearing from its
+    // master before it is reported unhealthy, 30 seconds by default.
+    MaxLagSeconds int32 `json:"maxLagSeconds,omitempty"`
+}
+
+// RedisDiagnosticsSpec configures the collection of the slow log and the
+// latency events of the nodes. The nodes only log what slowlog-log-slower-than
+// and latency-monitor-threshold let through.
+type RedisDiagnosticsSpec struct {
+    // Enabled makes the operator collect the diagnostics.
+    Enabled bool `json:"enabled,omitempty"`
+
+    // IntervalSeconds is how often they are collected, every minute by default.
+    IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+
+    // Top is how many slow commands and latency events the status lists,
+    // 5 by default.
+    Top int32 `json:"top,omitempty"`
+}
+
+// RedisNetworkPolicySpec configures the NetworkPolicy of a RedisCluster.
+type RedisNetworkPolicySpec struct {
+    // Enabled makes the operator create a NetworkPolicy letting only the
+    // pods of the cluster, the operator and the clients below reach them.
+    Enabled bool `json:"enabled,omitempty"`
+
+    // Clients are the namespaces and pods allowed to connect to Redis and
+    // to the sentinels.
+    Clients []networkingv1.NetworkPolicyPeer `json:"clients,omitempty"`
+
+    // Monitoring are the namespaces and pods allowed to scrape the exporters.
+    Monitoring []networkingv1.NetworkPolicyPeer `json:"monitoring,omitempty"`
+}
+
+// RedisReplicaSpec is the replication configuration of a RedisCluster.
+type RedisReplicaSpec struct {
+    // PingPeriod is how often, in seconds, the master pings its replicas
+    // (repl-ping-replica-period). It must be less than the replication timeout.
+    PingPeriod int32 `json:"pingPeriod,omitempty"`
+}
+
+// RedisLFUSpec tunes the access counters of the LFU eviction policies.
+type RedisLFUSpec struct {
+    // LogFactor is how slowly the access counter of a key grows with its
+    // hits (lfu-log-factor). Redis defaults to 10.
+    LogFactor *int32 `json:"logFactor,omitempty"`
+
+    // DecayTime is how many minutes a key must stay idle for its access
+    // counter to decay (lfu-decay-time), 0 to never decay. Redis defaults
+    // to 1.
+    DecayTime *int32 `json:"decayTime,omitempty"`
 }
 
 // RedisClusterStatus is the status for a RedisCluster resource.
 type RedisClusterStatus struct {
-    Nodes []string `json:"nodes"`
+    // Phase summarizes the state of the cluster: Pending, Scaling, Ready or Degraded.
+    Phase string `json:"phase,omitempty"`
+
+    // ObservedGeneration is the generation of the spec last reconciled successfully.
+    ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+    // Nodes are the pods of the cluster with the health of their Redis
+    // server, as checked by the operator on every reconcile.
+    Nodes []RedisNodeHealth `json:"nodes,omitempty"`
+
+    // ReadyReplicas is the number of ready pods whose Redis server is healthy.
+    ReadyReplicas int32 `json:"readyReplicas"`
+
+    // Replicas is the size the cluster runs at, in the unit of Spec.Size,
+    // for the scale subresource.
+    Replicas int32 `json:"replicas"`
+
+    // Selector is the label selector of the pods, for the scale subresource.
+    Selector string `json:"selector,omitempty"`
+
+    // Replication is the replication state reported by each ready node.
+    Replication []RedisNodeStatus `json:"replication,omitempty"`
+
+    // MasterNode is the pod acting as master of the replication topology.
+    // It is kept while the master is unreachable so the failover can find it.
+    MasterNode string `json:"masterNode,omitempty"`
+
+    // Resyncs are the replication resync counters of the nodes.
+    Resyncs *RedisResyncStats `json:"resyncs,omitempty"`
+
+    // Keys are the evicted and expired key counters of the nodes.
+    Keys *RedisKeyStats `json:"keys,omitempty"`
+
+    // ExternalEndpoints are the load balancer IPs and hostnames of the client Service.
+    ExternalEndpoints []string `json:"externalEndpoints,omitempty"`
+
+    // CordonedUntil is set while the client Service is cordoned.
+    CordonedUntil *metav1.Time `json:"cordonedUntil,omitempty"`
+
+    // ManagedBy records the versions that last reconciled the cluster.
+    ManagedBy *RedisClusterManagedBy `json:"managedBy,omitempty"`
+
+    // WritesPausedUntil is set while writes are paused for maintenance.
+    WritesPausedUntil *metav1.Time `json:"writesPausedUntil,omitempty"`
+
+    // Backup is the outcome of the scheduled backups.
+    Backup *RedisBackupStatus `json:"backup,omitempty"`
+
+    // Source is the state of the link to the replication source.
+    Source *RedisSourceStatus `json:"source,omitempty"`
+
+    // PromotedAt is when the cluster last broke the link to its
+    // replication source.
+    PromotedAt *metav1.Time `json:"promotedAt,omitempty"`
+
+    // PersistenceChecksum is the checksum of the persistence settings the
+    // nodes run with.
+    PersistenceChecksum string `json:"persistenceChecksum,omitempty"`
+
+    // Hibernation is the state of a hibernated cluster.
+    Hibernation *RedisHibernationStatus `json:"hibernation,omitempty"`
+
+    // Diagnostics are the worst slow commands and latency events of the
+    // nodes, when the spec collects them.
+    Diagnostics *RedisDiagnosticsStatus `json:"diagnostics,omitempty"`
+
+    // LastOperation is the outcome of the last operation requested through
+    // the yaro.io/operation annotation.
+    LastOperation *RedisOperationStatus `json:"lastOperation,omitempty"`
+
+    // Conditions are the observed conditions of the Redis cluster.
+    Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// RedisNodeStatus is the replication state of a Redis node, from INFO REPLICATION.
+type RedisNodeStatus struct {
+    Name             string `json:"name"`
+    Role             string `json:"role,omitempty"`
+    ConnectedSlaves  int32  `json:"connectedSlaves,omitempty"`
+    MasterLinkStatus string `json:"masterLinkStatus,omitempty"`
+}
+
+// RedisNodeHealth is the health of a Redis node as checked by the operator.
+type RedisNodeHealth struct {
+    Name    string `json:"name"`
+    Role    string `json:"role,omitempty"`
+    Address string `json:"address,omitempty"`
+
+    // Healthy is set when the node answers PING, is not loading its dataset
+    // and, for a replica, is linked to its master within the allowed lag.
+    Healthy bool `json:"healthy"`
+
+    // Loading is set while the node loads its dataset.
+    Loading bool `json:"loading,omitempty"`
+
+    // LagSeconds is how long ago a replica last heard from its master.
+    LagSeconds int32 `json:"lagSeconds,omitempty"`
+
+    // FragmentationRatio is the memory fragmentation ratio of the node.
+    FragmentationRatio string `json:"fragmentationRatio,omitempty"`
+
+    // LastSeen is when the node last answered the health check.
+    LastSeen *metav1.Time `json:"lastSeen,omitempty"`
+
+    // Message explains why the node is unhealthy.
+    Message string `json:"message,omitempty"`
+}
+
+// RedisHibernationStatus is the state of a hibernated cluster.
+type RedisHibernationStatus struct {
+    // Since is when the cluster started hibernating.
+    Since *metav1.Time `json:"since,omitempty"`
+
+    // SnapshotKey is the key of the snapshot of the data in the backup
+    // bucket, restored when the cluster resumes.
+    SnapshotKey string `json:"snapshotKey,omitempty"`
+}
+
+// RedisDiagnosticsStatus are the worst offenders found in the slow log and
+// the latency events of the nodes.
+type RedisDiagnosticsStatus struct {
+    // CollectedAt is when the diagnostics were last collected.
+    CollectedAt *metav1.Time `json:"collectedAt,omitempty"`
+
+    // SlowCommands are the slowest commands in the slow logs.
+    SlowCommands []RedisSlowCommand `json:"slowCommands,omitempty"`
+
+    // LatencyEvents are the latency events with the highest spikes.
+    LatencyEvents []RedisLatencyEvent `json:"latencyEvents,omitempty"`
+}
+
+// RedisSlowCommand is an entry of the slow log of a node.
+type RedisSlowCommand struct {
+    Node                 string      `json:"node"`
+    ID                   int64       `json:"id"`
+    Command              string      `json:"command"`
+    DurationMicroseconds int64       `json:"durationMicroseconds"`
+    Time                 metav1.Time `json:"time"`
+}
+
+// RedisLatencyEvent is a latency event of a node, from LATENCY LATEST and
+// LATENCY HISTORY.
+type RedisLatencyEvent struct {
+    Node               string      `json:"node"`
+    Event              string      `json:"event"`
+    LatestMilliseconds int64       `json:"latestMilliseconds"`
+    MaxMilliseconds    int64       `json:"maxMilliseconds"`
+    Spikes             int32       `json:"spikes"`
+    Time               metav1.Time `json:"time"`
+}
+
+// RedisResyncStats are the resync counters from INFO STATS, summed over the
+// nodes, with the full resyncs of each node the rate is computed from.
+type RedisResyncStats struct {
+    SyncFull       int64            `json:"syncFull"`
+    SyncPartialErr int64            `json:"syncPartialErr"`
+    NodeSyncFull   map[string]int64 `json:"nodeSyncFull,omitempty"`
+    ObservedAt     metav1.Time      `json:"observedAt"`
+}
+
+// RedisKeyStats are the evicted and expired key counters from INFO STATS,
+// summed over the nodes, with their growth since the previous observation
+// and the counters of each node the growth is computed from.
+type RedisKeyStats struct {
+    EvictedKeys      int64            `json:"evictedKeys"`
+    ExpiredKeys      int64            `json:"expiredKeys"`
+    EvictedKeysDelta int64            `json:"evictedKeysDelta"`
+    ExpiredKeysDelta int64            `json:"expiredKeysDelta"`
+    NodeEvictedKeys  map[string]int64 `json:"nodeEvictedKeys,omitempty"`
+    NodeExpiredKeys  map[string]int64 `json:"nodeExpiredKeys,omitempty"`
+    ObservedAt       metav1.Time      `json:"observedAt"`
+}
+
+// RedisBackupStatus is the outcome of the scheduled backups of a cluster.
+type RedisBackupStatus struct {
+    // LastSuccessfulTime is when the last successful backup completed.
+    LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+    // LastFailedJob is the latest backup job if it failed.
+    LastFailedJob string `json:"lastFailedJob,omitempty"`
+}
+
+// RedisSourceStatus is the state of the link of the nodes to the remote master.
+type RedisSourceStatus struct {
+    // Address is the address of the remote master.
+    Address string `json:"address"`
+
+    // LinkStatus is Up when all the ready nodes replicate the remote
+    // master, and Down otherwise.
+    LinkStatus string `json:"linkStatus"`
+
+    // LinkedNodes is the number of ready nodes replicating the remote master.
+    LinkedNodes int32 `json:"linkedNodes"`
+
+    // DownNodes are the ready nodes whose link to the remote master is down.
+    DownNodes []string `json:"downNodes,omitempty"`
+
+    // LagSeconds is the longest time a linked node went without hearing
+    // from the remote master.
+    LagSeconds int32 `json:"lagSeconds"`
+}
+
+// RedisClusterManagedBy identifies the operator that last reconciled a cluster.
+type RedisClusterManagedBy struct {
+    OperatorVersion string `json:"operatorVersion"`
+    APIVersion      string `json:"apiVersion"`
+
+    // Instance is the operator instance that reconciled the cluster, the
+    // leader when several replicas of the operator run.
+    Instance string `json:"instance,omitempty"`
 }
 
 // RedisClusterHandler is an implementation of the RedisClusterHandler interface.
-type RedisClusterHandler struct {}
+// +kubebuilder:object:generate=false
+type RedisClusterHandler struct {
+    // failureThreshold is the number of consecutive reconcile failures after
+    // which a RedisCluster is marked Failed.
+    failureThreshold int
+
+    // clockSkewThreshold is the clock drift between nodes above which the
+    // ClockSkew condition is set.
+    clockSkewThreshold time.Duration
+
+    // maxClusterSize is the largest size accepted for a cluster.
+    maxClusterSize int32
+
+    // recorder records the events of the RedisClusters.
+    recorder record.EventRecorder
+
+    // limiter limits the rate of the reconciles of the RedisClusters.
+    limiter *rate.Limiter
+
+    mu             sync.Mutex
+    failures       map[types.NamespacedName]*reconcileFailures
+    clockChecks    map[types.NamespacedName]time.Time
+    lastReconciles map[types.NamespacedName]lastReconcile
+}
 
 // NewHandler returns a new instance of the RedisClusterHandler.
 func NewHandler() sdk.Handler {
-    return &RedisClusterHandler{}
+    return &RedisClusterHandler{
+        failureThreshold:   getFailureThreshold(),
+        clockSkewThreshold: getClockSkewThreshold(),
+        maxClusterSize:     getMaxClusterSize(),
+        recorder:           newEventRecorder(),
+        limiter:            newReconcileLimiter(),
+        failures:           map[types.NamespacedName]*reconcileFailures{},
+        clockChecks:        map[types.NamespacedName]time.Time{},
+        lastReconciles:     map[types.NamespacedName]lastReconcile{},
+    }
 }
 
 // Handle handles the RedisCluster custom resource.
 func (h *RedisClusterHandler) Handle(ctx sdk.Context, event sdk.Event) error {
+    // Leave the events to the leader
+    if !isLeader() {
+        return nil
+    }
+
+    start := time.Now()
+    err := h.handleEvent(ctx, event)
+    observeEvent(event.Object, start, err)
+    if err != nil {
+        objectLogger(event.Object).Error(err, "Handling the event failed")
+    }
+    return err
+}
+
+// handleEvent dispatches an event to the handler of its object kind.
+func (h *RedisClusterHandler) handleEvent(ctx sdk.Context, event sdk.Event) error {
     switch o := event.Object.(type) {
     case *RedisCluster:
-        return h.handleRedisCluster(ctx, o)
-    case *appsv1.Deployment:
-        return h.handleDeployment(ctx, o)
+        if o.GetDeletionTimestamp() != nil {
+            return h.finalizeRedisCluster(ctx, o)
+        }
+        start := time.Now()
+        err := h.reconcileRedisCluster(ctx, o)
+        observeReconcile(o.Namespace, o.Name, start, err)
+        return err
+    case *appsv1.StatefulSet:
+        return h.handleStatefulSet(ctx, o)
+    case *RedisClusterRestore:
+        return h.handleRestore(ctx, o)
+    case *RedisUser:
+        return h.handleUser(ctx, o)
+    case *RedisOperation:
+        return h.handleOperation(ctx, o)
     }
     return nil
 }
 
 // handleRedisCluster handles the RedisCluster custom resource.
-func (h *RedisClusterHandler) handleRedisCluster(ctx sdk.Context, cluster *RedisCluster) error {
-    // Get the namespace for the custom resource
-    namespace, err := k8sutil.GetWatchNamespace()
+func (h *RedisClusterHandler) handleRedisCluster(ctx sdk.Context, namespace string, cluster *RedisCluster) error {
+    // Record the defaults of the spec, in case the defaulting webhook is
+    // not installed
+    err := applyDefaults(cluster)
+    if err != nil {
+        return err
+    }
+
+    // Validate the spec before creating anything for it
+    err = h.validateSpec(cluster)
+    if err != nil {
+        updateErr := setSpecInvalid(namespace, cluster, err)
+        if updateErr != nil {
+            return updateErr
+        }
+        return fmt.Errorf("invalid spec: %v", err)
+    }
+
+    // Register the finalizer
+    err = addFinalizer(cluster)
     if err != nil {
         return err
     }
 
-    // Create a deployment for the Redis cluster
+    // Validate the references of the spec
+    err = validateConfigFile(namespace, cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateConfigIncludes(namespace, cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateImagePullSecrets(namespace, cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = validateServiceAccount(namespace, cluster.Spec)
+    if err != nil {
+        return err
+    }
+
+    // Render the config into its ConfigMap before the pods mount it
+    err = reconcileConfigMap(cluster, namespace)
+    if err != nil {
+        return err
+    }
+    err = validateBackup(namespace, cluster.Spec)
+    if err != nil {
+        return err
+    }
+
+    // Generate the password Secret if the spec asks for one
+    err = reconcileAuthSecret(namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Rotate the generated password when it is due
+    err = rotateGeneratedPassword(namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Read the Redis password so the operator can authenticate to the nodes,
+    // having the nodes accept it first when it changed
+    password, err := redisPassword(namespace, cluster.Spec)
+    if err != nil {
+        return err
+    }
+    err = h.acceptNewPassword(ctx, namespace, cluster, password)
+    if err != nil {
+        return err
+    }
+    setClusterPassword(namespace, cluster.ObjectMeta.Name, password)
+
+    // Have cert-manager issue the certificates if the spec asks for it
+    err = reconcileCertificate(cluster, namespace)
+    if err != nil {
+        return err
+    }
+
+    // Load the TLS certificates so the operator can connect to the nodes
+    tlsConfig, err := redisTLSConfig(namespace, cluster.Spec)
+    if err != nil {
+        return err
+    }
+    setClusterTLSConfig(namespace, cluster.ObjectMeta.Name, tlsConfig)
+
+    // Apply changed persistence settings to the nodes before the pods
+    // restart with them
+    err = h.reconcilePersistence(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Create the pod template for the Redis cluster
     name := cluster.ObjectMeta.Name
-    replicas := cluster.Spec.Size
+    replicas := podCount(cluster.Spec)
     labels := map[string]string{"app": name, "controller": name}
-    deployment := &appsv1.Deployment{
-        ObjectMeta: metav1.ObjectMeta{
-            Name:      name,
-            Namespace: namespace,
-            Labels:    labels,
-        },
-        Spec: appsv1.DeploymentSpec{
-            Replicas: &replicas,
-            Selector: &metav1.LabelSelector{
-                MatchLabels: labels,
-            },
-            Template: corev1.PodTemplateSpec{
-                ObjectMeta: metav1.ObjectMeta{
-                    Labels: labels,
-                },
-                Spec: corev1.PodSpec{
-                    Containers: []corev1.Container{{
-                        Name:  "redis",
-                        Image: "redis:latest",
-                    }},
-                },
-            },
-        },
+    template := newPodTemplate(cluster, labels)
+    setPasswordChecksum(&template, password)
+    setPersistenceChecksum(&template, cluster.Status.PersistenceChecksum)
+
+    // Cordon the cluster from new connections if requested
+    cordoned, err := reconcileCordon(namespace, cluster)
+    if err != nil {
+        return err
     }
-    
-    // Update the status of the custom resource
-    err = updateRedisClusterStatus(ctx, namespace, name, deployment.Status.Replicas)
+
+    // Make sure the client Service exists
+    err = h.reconcileService(cluster, namespace, cordoned)
     if err != nil {
         return err
     }
 
-    // Create/update the deployment
-    err = sdk.Create(deployment)
+    // Make sure the Services of the master and of the replicas exist
+    err = reconcileRoleServices(cluster, namespace, cordoned)
     if err != nil {
         return err
     }
 
-    return nil
-}
+    // Make sure the headless Service giving the pods their DNS names exists
+    err = reconcileHeadlessService(cluster, namespace)
+    if err != nil {
+        return err
+    }
 
-// handleDeployment handles the Deployment custom resource.
-func (h *RedisClusterHandler) handleDeployment(ctx sdk.Context, deployment *appsv1.Deployment) error {
-    // Get the namespace for the custom resource
-    namespace, err := k8sutil.GetWatchNamespace()
+    // Make sure the service account of the pods and its RBAC exist
+    err = reconcileServiceAccount(cluster, namespace)
     if err != nil {
         return err
     }
 
-    // Get the labels for the deployment
-    labels := deployment.Spec.Selector.MatchLabels
+    // Have the Prometheus Operator scrape the exporters if requested
+    err = reconcileServiceMonitor(cluster, namespace)
+    if err != nil {
+        return err
+    }
 
-    // Get the corresponding RedisCluster
-    cluster := &RedisCluster{}
-    err = sdk.Get(cluster, namespace, labels["controller"])
+    // Scale a hibernated cluster to zero, or hold a resuming one at zero
+    // until the restore of its snapshot is in place
+    if cluster.Spec.Hibernated {
+        return h.hibernate(ctx, namespace, cluster)
+    }
+    resuming, err := h.resume(namespace, cluster)
+    if err != nil || resuming {
+        return err
+    }
+
+    // Keep the pods being removed until their slots or the master role
+    // moved away
+    if cluster.Spec.Mode == ModeCluster {
+        replicas, err = clusterModeReplicas(ctx, namespace, cluster)
+    } else {
+        replicas, err = h.replicationReplicas(ctx, namespace, cluster)
+    }
+    if err != nil {
+        return err
+    }
+
+    // Seed the data of the replaced pods from the snapshot of a restore,
+    // leaving the replacement to the restore
+    restore, err := activeRestore(namespace, cluster)
+    if err != nil {
+        return err
+    }
+    statefulSet := newStatefulSet(cluster, namespace, replicas, labels, template)
+    if restore != nil {
+        statefulSet.Spec.Template.Spec.InitContainers = append(statefulSet.Spec.Template.Spec.InitContainers, restoreContainer(cluster.Spec, restore))
+        statefulSet.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+    }
+
+    // Create/update the StatefulSet
+    err = h.reconcileStatefulSet(cluster, statefulSet)
+    if err != nil {
+        return err
+    }
+
+    // Delete the volume claims of the removed pods if requested
+    err = deleteScaledDownVolumeClaims(ctx, namespace, cluster, replicas)
+    if err != nil {
+        return err
+    }
+
+    // Remove the Deployment the pods ran in before they moved to a StatefulSet
+    err = deleteIfExists(&appsv1.Deployment{}, namespace, name)
+    if err != nil {
+        return err
+    }
+
+    // Deploy and configure the sentinels
+    err = h.reconcileSentinel(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Limit the pods node drains may evict at once
+    err = reconcilePodDisruptionBudgets(cluster, namespace)
+    if err != nil {
+        return err
+    }
+
+    // Restrict the access to the pods if requested
+    err = reconcileNetworkPolicy(cluster, namespace)
+    if err != nil {
+        return err
+    }
+
+    // Expose each pod outside Kubernetes if requested
+    err = reconcileExposure(ctx, namespace, cluster, replicas)
+    if err != nil {
+        return err
+    }
+
+    // Join the nodes of a sharded cluster and spread the slots over them
+    err = h.reconcileClusterMode(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Replicate the remote master, or break the link if requested
+    err = h.reconcileReplicationSource(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Run the operation requested by annotation
+    err = h.reconcileOperationAnnotation(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Replace the pods running an outdated revision
+    err = h.reconcileUpgrade(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Schedule the backups
+    err = h.reconcileBackup(ctx, namespace, cluster)
     if err != nil {
         return err
     }
 
     // Update the status of the custom resource
-    err = updateRedisClusterStatus(ctx, namespace, labels["controller"], deployment.Status.Replicas)
+    err = h.updateRedisClusterStatus(ctx, namespace, name)
+    if err != nil {
+        return err
+    }
+
+    // Apply the runtime configuration to the running pods
+    err = applyLiveConfig(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Pause or resume the writes for maintenance
+    err = reconcileWritePause(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Keep replicas on draining nodes from being promoted
+    err = reconcileDrainingReplicas(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Check the clocks of the nodes for drift
+    err = h.checkClockSkew(ctx, namespace, cluster)
     if err != nil {
         return err
     }
 
-    // Perform the automatic failover
-    err = performAutomaticFailover(ctx, deployment)
+    // Record that the spec has been reconciled
+    return setObservedGeneration(namespace, name, cluster.ObjectMeta.Generation)
+}
+
+// setObservedGeneration records the generation of the spec last reconciled.
+func setObservedGeneration(namespace, name string, generation int64) error {
+    // Get the RedisCluster
+    cluster := &RedisCluster{}
+    err := sdk.Get(cluster, namespace, name)
     if err != nil {
         return err
     }
+    if cluster.Status.ObservedGeneration == generation {
+        return nil
+    }
+
+    cluster.Status.ObservedGeneration = generation
+    return updateStatus(cluster)
+}
+
+// newPodTemplate builds the pod template of the Redis cluster.
+func newPodTemplate(cluster *RedisCluster, labels map[string]string) corev1.PodTemplateSpec {
+    template := corev1.PodTemplateSpec{
+        ObjectMeta: metav1.ObjectMeta{
+            Labels: labels,
+        },
+        Spec: corev1.PodSpec{
+            ServiceAccountName:        serviceAccountName(cluster),
+            ImagePullSecrets:          cluster.Spec.ImagePullSecrets,
+            Affinity:                  podAffinity(cluster),
+            TopologySpreadConstraints: topologySpreadConstraints(cluster),
+            SecurityContext:           podSecurityContext(cluster.Spec),
+            Containers: []corev1.Container{{
+                Name:            "redis",
+                Image:           redisImage(cluster.Spec),
+                ImagePullPolicy: cluster.Spec.ImagePullPolicy,
+                Command:         redisCommand(cluster.Spec),
+                Args:            redisArgs(cluster.Spec),
+                Env:             passwordEnv(cluster.Spec),
+                Resources:       cluster.Spec.Resources,
+                SecurityContext: containerSecurityContext(cluster.Spec),
+                ReadinessProbe:  readinessProbe(cluster.Spec),
+                LivenessProbe:   livenessProbe(cluster.Spec),
+                StartupProbe:    startupProbe(cluster.Spec),
+                Ports: []corev1.ContainerPort{{
+                    Name:          redisPortName,
+                    ContainerPort: clientPort(cluster.Spec),
+                }},
+                VolumeMounts: []corev1.VolumeMount{{
+                    Name:      dataVolumeName,
+                    MountPath: dataMountPath,
+                }},
+            }},
+        },
+    }
+
+    // Schedule the pods on the selected nodes
+    setScheduling(&template.Spec, cluster.Spec)
+
+    // Add the data volume unless it comes from a volume claim template
+    if volume := dataVolume(cluster.Spec, labels); volume != nil {
+        template.Spec.Volumes = append(template.Spec.Volumes, *volume)
+    }
+
+    // Mount the config file
+    if cluster.Spec.ConfigMapRef != nil {
+        volume, mount := configFileVolume(cluster.Spec)
+        template.Spec.Volumes = append(template.Spec.Volumes, volume)
+        template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, mount)
+    }
+
+    // Mount the TLS certificates
+    if cluster.Spec.TLS != nil {
+        volume, mount := tlsVolume(cluster.Spec)
+        template.Spec.Volumes = append(template.Spec.Volumes, volume)
+        template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, mount)
+    }
+
+    // Mount the config includes
+    volumes, mounts := configIncludeVolumes(cluster.Spec)
+    template.Spec.Volumes = append(template.Spec.Volumes, volumes...)
+    template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, mounts...)
+
+    // Run the metrics exporter next to Redis
+    if monitoringEnabled(cluster.Spec) {
+        template.Spec.Containers = append(template.Spec.Containers, exporterContainer(cluster.Spec))
+    }
+
+    // Mount the rendered config and record its checksum
+    if checksum := configChecksum(cluster.Spec); checksum != "" {
+        volume, mount := renderedConfigVolume(cluster)
+        template.Spec.Volumes = append(template.Spec.Volumes, volume)
+        template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, mount)
+        template.ObjectMeta.Annotations = map[string]string{configChecksumAnnotation: checksum}
+    }
+
+    // Copy the modules shipped in their own images
+    if volume, mount := moduleVolume(cluster.Spec); volume != nil {
+        template.Spec.Volumes = append(template.Spec.Volumes, *volume)
+        template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, *mount)
+        template.Spec.InitContainers = append(template.Spec.InitContainers, moduleContainers(cluster.Spec)...)
+    }
+
+    // Add the containers and volumes of the user
+    addPodExtensions(&template, cluster.Spec)
+
+    return template
+}
+
+// updatePodTemplate brings the parts of an existing pod template the operator
+// manages in line with the desired template, and reports whether it changed
+// anything. The rest of the configuration is applied to the running pods
+// without replacing them.
+func updatePodTemplate(existing *corev1.PodTemplateSpec, template corev1.PodTemplateSpec) bool {
+    changed := false
+    desired := template.Spec.Containers[0]
+    container := &existing.Spec.Containers[0]
+
+    // Update the image
+    if container.Image != desired.Image || container.ImagePullPolicy != desired.ImagePullPolicy {
+        container.Image = desired.Image
+        container.ImagePullPolicy = desired.ImagePullPolicy
+        changed = true
+    }
+
+    // Update the startup when the password reference, the config file or the
+    // volumes change
+    if !reflect.DeepEqual(container.Env, desired.Env) || !reflect.DeepEqual(container.Command, desired.Command) || !reflect.DeepEqual(container.VolumeMounts, desired.VolumeMounts) || !sameVolumes(existing.Spec.Volumes, template.Spec.Volumes) {
+        container.Command = desired.Command
+        container.Args = desired.Args
+        container.Env = desired.Env
+        container.VolumeMounts = desired.VolumeMounts
+        existing.Spec.Volumes = template.Spec.Volumes
+        changed = true
+    }
+
+    // Roll the pods when an argument Redis only reads at startup or the
+    // ports change, such as the port or the CPU lists; the live config
+    // parameters are applied with CONFIG SET instead
+    if !reflect.DeepEqual(restartArgs(container.Args), restartArgs(desired.Args)) || !sameContainerPorts(container.Ports, desired.Ports) {
+        container.Args = desired.Args
+        container.Ports = desired.Ports
+        changed = true
+    }
+
+    // Update the probes
+    if !sameProbe(container.ReadinessProbe, desired.ReadinessProbe) || !sameProbe(container.LivenessProbe, desired.LivenessProbe) || !sameProbe(container.StartupProbe, desired.StartupProbe) {
+        container.ReadinessProbe = desired.ReadinessProbe
+        container.LivenessProbe = desired.LivenessProbe
+        container.StartupProbe = desired.StartupProbe
+        changed = true
+    }
+
+    // Update the resources and the security contexts
+    if !sameResources(container.Resources, desired.Resources) {
+        container.Resources = desired.Resources
+        changed = true
+    }
+    if !reflect.DeepEqual(container.SecurityContext, desired.SecurityContext) {
+        container.SecurityContext = desired.SecurityContext
+        changed = true
+    }
+    if !reflect.DeepEqual(existing.Spec.SecurityContext, template.Spec.SecurityContext) {
+        existing.Spec.SecurityContext = template.Spec.SecurityContext
+        changed = true
+    }
+
+    // Run the pods under the service account of the spec
+    if existing.Spec.ServiceAccountName != template.Spec.ServiceAccountName {
+        existing.Spec.ServiceAccountName = template.Spec.ServiceAccountName
+        changed = true
+    }
+
+    // Add, update or remove the sidecars
+    if updateSidecars(existing, template) {
+        changed = true
+    }
+
+    // Add or remove the init containers
+    if !sameContainers(corev1.PodSpec{InitContainers: existing.Spec.InitContainers}, corev1.PodSpec{InitContainers: template.Spec.InitContainers}) {
+        existing.Spec.InitContainers = template.Spec.InitContainers
+        changed = true
+    }
+
+    // Roll the pods when the rendered config, the password or the
+    // persistence settings change
+    for _, annotation := range []string{configChecksumAnnotation, passwordChecksumAnnotation, persistenceChecksumAnnotation} {
+        checksum := template.ObjectMeta.Annotations[annotation]
+        if existing.ObjectMeta.Annotations[annotation] == checksum {
+            continue
+        }
+        if existing.ObjectMeta.Annotations == nil {
+            existing.ObjectMeta.Annotations = map[string]string{}
+        }
+        if checksum == "" {
+            delete(existing.ObjectMeta.Annotations, annotation)
+        } else {
+            existing.ObjectMeta.Annotations[annotation] = checksum
+        }
+        container.Args = desired.Args
+        changed = true
+    }
+
+    // Place the pods again when the scheduling changes
+    if updateScheduling(existing, template) {
+        changed = true
+    }
+
+    return changed
+}
+
+// reconcileExternalScale handles a workload scaled outside of the operator,
+// replicas pointing to its replica count. By default Spec.Size is re-asserted
+// on the workload; with the adopt-scale annotation the new replica count is
+// adopted into the RedisCluster instead. Either way an event records it.
+// Scaling the RedisCluster itself, through its scale subresource, changes
+// Spec.Size and needs neither.
+func (h *RedisClusterHandler) reconcileExternalScale(ctx sdk.Context, namespace string, cluster *RedisCluster, workload sdk.Object, replicas *int32) error {
+    if replicas == nil || *replicas == podCount(cluster.Spec) {
+        return nil
+    }
+
+    // The replicas of a sharded cluster follow the slot migrations and are
+    // reconciled with the RedisCluster
+    if cluster.Spec.Mode == ModeCluster {
+        return nil
+    }
+
+    // So does a scale-down held until the master moved off the pods being
+    // removed
+    held, err := scaleDownHeld(ctx, namespace, cluster, *replicas)
+    if err != nil || held {
+        return err
+    }
+
+    // Adopt the new size into the custom resource
+    name := workload.(metav1.Object).GetName()
+    scaled := *replicas
+    if cluster.ObjectMeta.Annotations[adoptScaleAnnotation] == "true" {
+        previous := cluster.Spec.Size
+        cluster.Spec.Size = scaled
+        err = updateObject(cluster)
+        if err != nil {
+            return err
+        }
+        h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonScaleAdopted, "Adopted the %d replicas of %s as the size, previously %d", scaled, name, previous)
+        return nil
+    }
 
+    // Scale the workload back to the size of the custom resource
+    *replicas = cluster.Spec.Size
+    err = updateObject(workload)
+    if err != nil {
+        return err
+    }
+    h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonDriftCorrected, "Scaled %s back from %d to %d replicas, the size of the RedisCluster", name, scaled, cluster.Spec.Size)
     return nil
 }
 
 // updateRedisClusterStatus updates the status of the RedisCluster custom resource.
-func updateRedisClusterStatus(ctx sdk.Context, namespace, name string, replicas *int32) error {
+func (h *RedisClusterHandler) updateRedisClusterStatus(ctx sdk.Context, namespace, name string) error {
     // Get the RedisCluster
     cluster := &RedisCluster{}
     err := sdk.Get(cluster, namespace, name)
     if err != nil {
         return err
     }
+    previous := cluster.Status.DeepCopy()
 
-    // Update the status of the custom resource
-    cluster.Status.Nodes = make([]string, *replicas)
-    for i := 0; i < int(*replicas); i++ {
-        cluster.Status.Nodes[i] = fmt.Sprintf("%s-%d", name, i)
+    // Check the health of the nodes of the cluster
+    pods, err := listClusterPods(ctx, namespace, name)
+    if err != nil {
+        return err
+    }
+    sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+    cluster.Status.Nodes = checkNodesHealth(cluster, pods.Items)
+
+    // Set the phase from the ready and desired pod counts, counting the
+    // ready pods whose Redis server is healthy
+    ready := 0
+    for i := range pods.Items {
+        if health := nodeHealth(cluster.Status.Nodes, pods.Items[i].Name); isPodReady(&pods.Items[i]) && health != nil && health.Healthy {
+            ready++
+        }
     }
+    cluster.Status.ReadyReplicas = int32(ready)
+    cluster.Status.Replicas = scaleReplicas(cluster.Spec, len(pods.Items))
+    cluster.Status.Selector = scaleSelector(name)
+    readyNodes.WithLabelValues(namespace, name).Set(float64(ready))
+    phase := clusterPhase(cluster.Status.Phase, podCount(cluster.Spec), len(pods.Items), ready)
+    if cluster.Spec.Hibernated && cluster.Status.Hibernation != nil {
+        phase = hibernationPhase(len(pods.Items))
+    }
+    setPhase(cluster, phase, ready)
 
-    err = sdk.Update(cluster)
+    // Record the replication state of the nodes
+    cluster.Status.Replication, err = getReplicationStatus(ctx, namespace, name)
     if err != nil {
         return err
     }
+    setReplicaDisconnectedCondition(cluster)
+    if master := masterNode(cluster.Status.Replication); master != "" {
+        cluster.Status.MasterNode = master
+    }
 
-    return nil
-}
+    // Record the state of the link to the replication source
+    replication, err := getClusterInfo(ctx, namespace, name, "replication")
+    if err != nil {
+        return err
+    }
+    setSourceStatus(cluster, replication)
 
-// performAutomaticFailover performs the automatic failover for the Redis cluster.
-func performAutomaticFailover(ctx sdk.Context, deployment *appsv1.Deployment) error {
-    // Get the namespace for the custom resource
-    namespace, err := k8sutil.GetWatchNamespace()
+    // Label the pods with their roles for the master and replica Services
+    err = labelPodRoles(pods.Items, cluster.Status.Replication)
     if err != nil {
         return err
     }
 
-    // Get the labels for the deployment
-    labels := deployment.Spec.Selector.MatchLabels
+    // Track the resyncs and key counters of the nodes
+    stats, err := getClusterInfo(ctx, namespace, name, "stats")
+    if err != nil {
+        return err
+    }
+    h.updateResyncStats(cluster, stats)
+    updateKeyStats(cluster, stats)
+
+    // Warn before nodes start rejecting writes
+    memory, err := getClusterInfo(ctx, namespace, name, "memory")
+    if err != nil {
+        return err
+    }
+    h.setWritesWillBeRejectedCondition(cluster, memory)
+
+    // Check that the nodes load the same modules
+    err = setModulesInconsistentCondition(ctx, namespace, cluster)
+    if err != nil {
+        return err
+    }
+
+    // Collect the slow log and the latency events
+    err = collectDiagnostics(namespace, cluster, pods.Items)
+    if err != nil {
+        return err
+    }
+
+    // Leave the status alone when nothing changed, so that the reconcile
+    // does not raise a watch event for itself
+    if equality.Semantic.DeepEqual(*previous, cluster.Status) {
+        return nil
+    }
+    err = updateStatus(cluster)
+    if err != nil {
+        return err
+    }
+    observeKeyStats(namespace, cluster)
 
+    return nil
+}
+
+// performAutomaticFailover performs the automatic failover for the Redis cluster.
+func (h *RedisClusterHandler) performAutomaticFailover(ctx sdk.Context, namespace, name string) error {
     // Get the corresponding RedisCluster
     cluster := &RedisCluster{}
-    err = sdk.Get(cluster, namespace, labels["controller"])
+    err := getObject(cluster, namespace, name)
     if err != nil {
         return err
     }
 
-    // Get the pods for the deployment
-    selector := labels.AsSelector()
-    pods, err := ctx.GetClientset().CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+    // Get the pods for the cluster
+    pods, err := listClusterPods(ctx, namespace, name)
     if err != nil {
         return err
     }
 
-    // Perform the automatic failover
+    // Skip the failover when too few nodes are healthy, deleting more would
+    // not bring the cluster back and could be fighting a node drain
+    now := time.Now()
+    healthy := 0
+    failed := []corev1.Pod{}
     for _, pod := range pods.Items {
-        // Check if the pod is ready
-        ready := false
-        for _, condition := range pod.Status.Conditions {
-            if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
-                ready = true
-                break
-            }
+        if isPodReady(&pod) {
+            healthy++
+        } else if isFailedNode(&pod, nodeHealth(cluster.Status.Nodes, pod.Name), now) {
+            failed = append(failed, pod)
         }
+    }
+    if healthy < minAvailable(cluster.Spec) {
+        return nil
+    }
 
-        // If the pod is not ready, delete it
-        if !ready {
-            err = ctx.GetClientset().CoreV1().Pods(namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+    // Perform the automatic failover, deleting at most MaxUnavailable pods
+    // per reconcile and leaving the rest to the next reconcile
+    budget := maxUnavailable(cluster.Spec)
+    for _, pod := range failed {
+        if budget == 0 {
+            return nil
+        }
+
+        // Promote a replica before deleting an unhealthy master, unless the
+        // sentinels or the cluster nodes take care of it, or the nodes all
+        // replicate a remote master
+        if pod.Name == cluster.Status.MasterNode && cluster.Spec.Mode != ModeSentinel && cluster.Spec.Mode != ModeCluster && cluster.Spec.ReplicationSource == nil {
+            master := pod.Name
+            err = promoteReplica(cluster, pods.Items)
             if err != nil {
                 return err
             }
+            h.recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonPromoted, "Promoted replica %s to master in place of %s", cluster.Status.MasterNode, master)
+            failoversTotal.WithLabelValues(namespace, name, failoverReasonFailure).Inc()
+        }
+
+        // Delete the pod that is not ready
+        err = deleteObject(&pod)
+        if err != nil {
+            return err
         }
+        h.recorder.Eventf(cluster, corev1.EventTypeWarning, ReasonFailoverDeletedPod, "Deleted pod %s whose Redis server was down", pod.Name)
+        failoverPodDeletionsTotal.WithLabelValues(namespace, name).Inc()
+        budget--
     }
 
     return nil
@@ -0,0 +1,60 @@
+package main
+
+import (
+    "testing"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// newTestTemplate returns the pod template of the cluster.
+func newTestTemplate(cluster *RedisCluster) corev1.PodTemplateSpec {
+    return newPodTemplate(cluster, map[string]string{"app": cluster.ObjectMeta.Name, "controller": cluster.ObjectMeta.Name})
+}
+
+func TestUpdatePodTemplatePort(t *testing.T) {
+    cluster := newTestCluster(3)
+    existing := newTestTemplate(cluster)
+    existing.Spec.Containers[0].Ports[0].Protocol = corev1.ProtocolTCP
+    if updatePodTemplate(&existing, newTestTemplate(cluster)) {
+        t.Fatal("got the unchanged template updated")
+    }
+
+    cluster.Spec.Port = 6380
+    if !updatePodTemplate(&existing, newTestTemplate(cluster)) {
+        t.Fatal("got the template unchanged, want the pods rolled to the new port")
+    }
+    container := existing.Spec.Containers[0]
+    if got := argValue(container.Args, "--port"); got != "6380" {
+        t.Errorf("got --port %q, want 6380", got)
+    }
+    if container.Ports[0].ContainerPort != 6380 {
+        t.Errorf("got container port %d, want 6380", container.Ports[0].ContainerPort)
+    }
+}
+
+func TestUpdatePodTemplateLiveConfig(t *testing.T) {
+    cluster := newTestCluster(3)
+    existing := newTestTemplate(cluster)
+
+    cluster.Spec.MaxMemorySamples = 10
+    if updatePodTemplate(&existing, newTestTemplate(cluster)) {
+        t.Error("got the pods rolled for maxmemory-samples, which is applied with CONFIG SET")
+    }
+}
+
+func TestActiveRehashingChange(t *testing.T) {
+    cluster := newTestCluster(3)
+    existing := newTestTemplate(cluster)
+
+    enabled := false
+    cluster.Spec.ActiveRehashing = &enabled
+    template := newTestTemplate(cluster)
+    if got := argValue(template.Spec.Containers[0].Args, "--activerehashing"); got != "no" {
+        t.Errorf("got --activerehashing %q, want no", got)
+    }
+    if !liveConfigParameters["activerehashing"] {
+        t.Error("activerehashing is not applied to the running pods")
+    }
+    if updatePodTemplate(&existing, template) {
+        t.Error("got the pods rolled for activerehashing, which is applied with CONFIG SET")
+    }
+}